@@ -64,21 +64,40 @@ var _ Reader = (*Blockchain)(nil)
 
 // Blockchain is responsible for keeping track of all things related to the Starknet blockchain
 type Blockchain struct {
-	network  utils.Network
-	database db.DB
+	network   utils.Network
+	database  db.DB
+	stateOpts []core.StateOption
 
 	log utils.SimpleLogger
 }
 
-func New(database db.DB, network utils.Network, log utils.SimpleLogger) *Blockchain {
+// New returns the blockchain stored in database. The state of the blockchain is configured with
+// stateOpts, e.g. [core.WithClassLeafVersion].
+func New(database db.DB, network utils.Network, log utils.SimpleLogger, stateOpts ...core.StateOption) *Blockchain {
 	registerCoreTypesToEncoder()
 	return &Blockchain{
-		database: database,
-		network:  network,
-		log:      log,
+		database:  database,
+		network:   network,
+		stateOpts: stateOpts,
+		log:       log,
 	}
 }
 
+// newState returns the state of the blockchain on txn
+func (b *Blockchain) newState(txn db.Transaction) *core.State {
+	return core.NewState(txn, b.stateOpts...)
+}
+
+// VerifyClassLeafVersion returns [core.ErrClassLeafVersionMismatch] if the state in the database was
+// built with a classes trie leaf version other than the one the blockchain uses, and stores the
+// version if the database doesn't have one yet. It is meant to be called when the database is
+// opened, before anything is stored.
+func (b *Blockchain) VerifyClassLeafVersion() error {
+	return b.database.Update(func(txn db.Transaction) error {
+		return b.newState(txn).InitClassLeafVersion()
+	})
+}
+
 func (b *Blockchain) Network() utils.Network {
 	return b.network
 }
@@ -89,7 +108,7 @@ func (b *Blockchain) StateCommitment() (*felt.Felt, error) {
 	var commitment *felt.Felt
 	return commitment, b.database.View(func(txn db.Transaction) error {
 		var err error
-		commitment, err = core.NewState(txn).Root()
+		commitment, err = b.newState(txn).Root()
 		return err
 	})
 }
@@ -296,7 +315,7 @@ func (b *Blockchain) Store(block *core.Block, stateUpdate *core.StateUpdate, new
 		if err := b.verifyBlock(txn, block); err != nil {
 			return err
 		}
-		if err := core.NewState(txn).Update(block.Number, stateUpdate, newClasses); err != nil {
+		if err := b.newState(txn).Update(block.Number, stateUpdate, newClasses); err != nil {
 			return err
 		}
 		if err := storeBlockHeader(txn, block.Header); err != nil {
@@ -679,7 +698,7 @@ func (b *Blockchain) HeadState() (core.StateReader, StateCloser, error) {
 		return nil, nil, db.CloseAndWrapOnError(txn.Discard, err)
 	}
 
-	return core.NewState(txn), txn.Discard, nil
+	return b.newState(txn), txn.Discard, nil
 }
 
 // StateAtBlockNumber returns a StateReader that provides a stable view to the state at the given block number
@@ -690,7 +709,7 @@ func (b *Blockchain) StateAtBlockNumber(blockNumber uint64) (core.StateReader, S
 		return nil, nil, db.CloseAndWrapOnError(txn.Discard, err)
 	}
 
-	return core.NewStateSnapshot(core.NewState(txn), blockNumber), txn.Discard, nil
+	return core.NewStateSnapshot(b.newState(txn), blockNumber), txn.Discard, nil
 }
 
 // StateAtBlockHash returns a StateReader that provides a stable view to the state at the given block hash
@@ -701,7 +720,7 @@ func (b *Blockchain) StateAtBlockHash(blockHash *felt.Felt) (core.StateReader, S
 		return nil, nil, db.CloseAndWrapOnError(txn.Discard, err)
 	}
 
-	return core.NewStateSnapshot(core.NewState(txn), header.Number), txn.Discard, nil
+	return core.NewStateSnapshot(b.newState(txn), header.Number), txn.Discard, nil
 }
 
 // EventFilter returns an EventFilter object that is tied to a snapshot of the blockchain
@@ -734,7 +753,7 @@ func (b *Blockchain) revertHead(txn db.Transaction) error {
 		return err
 	}
 
-	state := core.NewState(txn)
+	state := b.newState(txn)
 	// revert state
 	if err = state.Revert(blockNumber, stateUpdate); err != nil {
 		return err
@@ -854,6 +873,6 @@ func (b *Blockchain) PendingState() (core.StateReader, StateCloser, error) {
 
 	return NewPendingState(
 		pending,
-		core.NewState(txn),
+		b.newState(txn),
 	), txn.Discard, nil
 }
@@ -618,6 +618,38 @@ func TestL1Update(t *testing.T) {
 	}
 }
 
+func TestVerifyClassLeafVersion(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	chain := blockchain.New(testDB, utils.MAINNET, utils.NewNopZapLogger())
+	require.NoError(t, chain.VerifyClassLeafVersion())
+
+	var stored []byte
+	require.NoError(t, testDB.View(func(txn db.Transaction) error {
+		return txn.Get(db.ClassLeafVersion.Key(), func(val []byte) error {
+			stored = append(stored, val...)
+			return nil
+		})
+	}))
+	assert.Equal(t, new(felt.Felt).SetBytes([]byte("CONTRACT_CLASS_LEAF_V0")).Marshal(), stored)
+	require.NoError(t, chain.VerifyClassLeafVersion())
+
+	otherVersion := new(felt.Felt).SetBytes([]byte("CONTRACT_CLASS_LEAF_V1"))
+	t.Run("blockchain configured with another version", func(t *testing.T) {
+		other := blockchain.New(testDB, utils.MAINNET, utils.NewNopZapLogger(), core.WithClassLeafVersion(otherVersion))
+		require.ErrorIs(t, other.VerifyClassLeafVersion(), core.ErrClassLeafVersionMismatch)
+
+		other = blockchain.New(pebble.NewMemTest(), utils.MAINNET, utils.NewNopZapLogger(), core.WithClassLeafVersion(otherVersion))
+		require.NoError(t, other.VerifyClassLeafVersion())
+	})
+
+	t.Run("database built with another version", func(t *testing.T) {
+		require.NoError(t, testDB.Update(func(txn db.Transaction) error {
+			return txn.Set(db.ClassLeafVersion.Key(), otherVersion.Marshal())
+		}))
+		require.ErrorIs(t, chain.VerifyClassLeafVersion(), core.ErrClassLeafVersionMismatch)
+	})
+}
+
 func TestPending(t *testing.T) {
 	testDB := pebble.NewMemTest()
 	t.Cleanup(func() {
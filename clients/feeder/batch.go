@@ -0,0 +1,133 @@
+package feeder
+
+import (
+	"context"
+	"strconv"
+)
+
+// BatchResult is a single result of a batch fetch. Value is nil if Err is set.
+type BatchResult[T any] struct {
+	Number uint64
+	Value  *T
+	Err    error
+}
+
+type batchConfig struct {
+	concurrency   int
+	flushOnCancel bool
+}
+
+// BatchOption configures [Client.Blocks] and [Client.StateUpdates].
+type BatchOption func(*batchConfig)
+
+// WithBatchConcurrency sets the maximum number of queries in flight during a batch fetch. The default is 1.
+func WithBatchConcurrency(concurrency int) BatchOption {
+	return func(cfg *batchConfig) {
+		if concurrency > 0 {
+			cfg.concurrency = concurrency
+		}
+	}
+}
+
+// FlushOnCancel makes a batch fetch deliver the results that completed successfully before its
+// context was cancelled, instead of closing the channel right away. The caller must keep draining
+// the channel until it is closed.
+func FlushOnCancel() BatchOption {
+	return func(cfg *batchConfig) {
+		cfg.flushOnCancel = true
+	}
+}
+
+// Blocks fetches the blocks from `from` to `to`, both inclusive, and delivers them in order on the
+// returned channel. The channel is closed after the last block, after the first failed fetch, whose
+// error is delivered, or when ctx is cancelled.
+func (c *Client) Blocks(ctx context.Context, from, to uint64, opts ...BatchOption) <-chan BatchResult[Block] {
+	return fetchBatch(ctx, from, to, opts, func(ctx context.Context, number uint64) (*Block, error) {
+		return c.Block(ctx, strconv.FormatUint(number, 10))
+	})
+}
+
+// StateUpdates fetches the state updates from `from` to `to`, both inclusive, and delivers them in
+// order on the returned channel. See [Client.Blocks] for when the channel is closed.
+func (c *Client) StateUpdates(ctx context.Context, from, to uint64, opts ...BatchOption) <-chan BatchResult[StateUpdate] {
+	return fetchBatch(ctx, from, to, opts, func(ctx context.Context, number uint64) (*StateUpdate, error) {
+		return c.StateUpdate(ctx, strconv.FormatUint(number, 10))
+	})
+}
+
+func fetchBatch[T any](ctx context.Context, from, to uint64, opts []BatchOption,
+	fetch func(context.Context, uint64) (*T, error),
+) <-chan BatchResult[T] {
+	cfg := batchConfig{concurrency: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	results := make(chan BatchResult[T])
+	if to < from {
+		close(results)
+		return results
+	}
+
+	// every fetch reports to its own slot so that the results can be delivered in order
+	slots := make([]chan BatchResult[T], to-from+1)
+	for i := range slots {
+		slots[i] = make(chan BatchResult[T], 1)
+	}
+
+	fetchCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		sem := make(chan struct{}, cfg.concurrency)
+		for i := range slots {
+			select {
+			case sem <- struct{}{}:
+			case <-fetchCtx.Done():
+				// fill the remaining slots so that nobody waits on them
+				for ; i < len(slots); i++ {
+					slots[i] <- BatchResult[T]{Number: from + uint64(i), Err: fetchCtx.Err()}
+				}
+				return
+			}
+
+			go func(i int) {
+				defer func() { <-sem }()
+				number := from + uint64(i)
+				value, err := fetch(fetchCtx, number)
+				slots[i] <- BatchResult[T]{Number: number, Value: value, Err: err}
+			}(i)
+		}
+	}()
+
+	go func() {
+		defer close(results)
+		defer cancel()
+
+		for _, slot := range slots {
+			result := <-slot
+			if ctx.Err() != nil {
+				if !cfg.flushOnCancel {
+					return
+				}
+				// keep the results that completed before the cancellation
+				if result.Err == nil {
+					results <- result
+				}
+				continue
+			}
+
+			select {
+			case results <- result:
+			case <-ctx.Done():
+				if !cfg.flushOnCancel {
+					return
+				}
+				results <- result
+			}
+
+			if result.Err != nil {
+				return
+			}
+		}
+	}()
+	return results
+}
@@ -2,6 +2,12 @@ package feeder
 
 import "github.com/NethermindEth/juno/core/felt"
 
+// isRevertedStatus reports whether a block status means the block was reorged out or aborted.
+// Gateways that don't report a status leave it empty, which is treated as not reverted.
+func isRevertedStatus(status string) bool {
+	return status == "REVERTED" || status == "ABORTED"
+}
+
 // Block object returned by the feeder in JSON format for "get_block" endpoint
 type Block struct {
 	Hash             *felt.Felt            `json:"block_hash"`
@@ -16,3 +22,21 @@ type Block struct {
 	Receipts         []*TransactionReceipt `json:"transaction_receipts"`
 	SequencerAddress *felt.Felt            `json:"sequencer_address"`
 }
+
+// IsReverted reports whether the gateway marked the block as reverted
+func (b *Block) IsReverted() bool {
+	return isRevertedStatus(b.Status)
+}
+
+// BlockHeader is the header of a [Block], as pushed by the feeder's head stream
+type BlockHeader struct {
+	Hash             *felt.Felt `json:"block_hash"`
+	ParentHash       *felt.Felt `json:"parent_block_hash"`
+	Number           uint64     `json:"block_number"`
+	StateRoot        *felt.Felt `json:"state_root"`
+	Status           string     `json:"status"`
+	GasPrice         *felt.Felt `json:"gas_price"`
+	Timestamp        uint64     `json:"timestamp"`
+	Version          string     `json:"starknet_version"`
+	SequencerAddress *felt.Felt `json:"sequencer_address"`
+}
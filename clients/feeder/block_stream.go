@@ -0,0 +1,178 @@
+package feeder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// BlockStream fetches a block like [Client.Block] but decodes its transactions one at a time while
+// the response body is read, passing each of them to fn instead of collecting them, so that big
+// blocks are never held in memory as a whole. The receipts are skipped. The header is returned once
+// the whole body has been read.
+//
+// Decoding stops at the first error returned by fn, which is then returned. Since the body is not
+// buffered, the response is neither cached nor coalesced with other queries, and the transactions
+// are decoded with encoding/json rather than the decoder set with [Client.WithDecoder].
+func (c *Client) BlockStream(ctx context.Context, blockID string, fn func(tx *Transaction) error) (*BlockHeader, error) {
+	const endpoint = "get_block"
+	body, err := c.get(ctx, endpoint, map[string]string{
+		"blockNumber": blockID,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var reader io.Reader = body
+	if limit := c.maxResponseBytesFor(endpoint); limit > 0 {
+		reader = &limitedBody{r: body, remaining: limit, err: &ResponseTooLargeError{Endpoint: endpoint, Limit: limit}}
+	}
+
+	header, err := c.decodeBlockStream(json.NewDecoder(reader), fn)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.rejectReverted && isRevertedStatus(header.Status) {
+		return nil, fmt.Errorf("%w: block %s", ErrBlockReverted, blockID)
+	}
+	return header, nil
+}
+
+// decodeBlockStream walks the block object read by dec, streaming its transactions to fn, skipping
+// its receipts and collecting the other fields into the returned header.
+func (c *Client) decodeBlockStream(dec *json.Decoder, fn func(tx *Transaction) error) (*BlockHeader, error) {
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+
+	headerFields := make(map[string]json.RawMessage)
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		field, ok := token.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected block field name %v", token)
+		}
+
+		switch field {
+		case "transactions":
+			err = streamArray(dec, func() error {
+				tx := new(Transaction)
+				if decodeErr := dec.Decode(tx); decodeErr != nil {
+					return decodeErr
+				}
+				return fn(tx)
+			})
+		case "transaction_receipts":
+			err = skipValue(dec)
+		default:
+			var value json.RawMessage
+			if err = dec.Decode(&value); err == nil {
+				headerFields[field] = value
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, err
+	}
+
+	// the header fields are small, so re-encode them to decode the header with the client's decoder
+	headerJSON, err := json.Marshal(headerFields)
+	if err != nil {
+		return nil, err
+	}
+	header := new(BlockHeader)
+	if err = c.decoder(bytes.NewReader(headerJSON), header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// streamArray calls fn for every element of the array read by dec, which must decode the element.
+// A null is treated as an empty array.
+func streamArray(dec *json.Decoder, fn func() error) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected an array, got %v", token)
+	}
+
+	for dec.More() {
+		if err = fn(); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+// skipValue reads past the next value of dec without keeping it
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		if delim, ok := token.(json.Delim); ok {
+			switch delim {
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+			}
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != want {
+		return fmt.Errorf("expected %q, got %v", want, token)
+	}
+	return nil
+}
+
+// limitedBody reads from r and fails with err once more than remaining bytes have been read
+type limitedBody struct {
+	r         io.Reader
+	remaining int64
+	err       error
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, l.err
+	}
+	if int64(len(p)) > l.remaining+1 {
+		// read one byte past the limit to tell a body of exactly the limit from a larger one
+		p = p[:l.remaining+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, l.err
+	}
+	return n, err
+}
@@ -0,0 +1,141 @@
+package feeder
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/sourcegraph/conc/pool"
+)
+
+// Cache stores the raw responses of feeder queries whose result never changes, e.g. blocks by
+// number and classes by hash. Keys don't depend on the feeder URL that served the response.
+// Implementations must be safe for concurrent use.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Put(key string, body []byte)
+}
+
+// MemoryCache is an in-memory [Cache] that holds up to a maximum number of responses, evicting the
+// least recently used one to make room for a new one.
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	recency    *list.List // front is the most recently used
+}
+
+type memoryCacheEntry struct {
+	key  string
+	body []byte
+}
+
+// NewMemoryCache returns a [MemoryCache] that holds up to maxEntries responses. A maxEntries of zero
+// or less leaves it unbounded.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		recency:    list.New(),
+	}
+}
+
+// Get : see Cache.Get
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	c.recency.MoveToFront(elem)
+	return elem.Value.(*memoryCacheEntry).body, true
+}
+
+// Put : see Cache.Put
+func (c *MemoryCache) Put(key string, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, found := c.entries[key]; found {
+		elem.Value.(*memoryCacheEntry).body = body
+		c.recency.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.recency.PushFront(&memoryCacheEntry{key: key, body: body})
+	if c.maxEntries > 0 && c.recency.Len() > c.maxEntries {
+		oldest := c.recency.Back()
+		c.recency.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+}
+
+// WithCache makes the client serve the queries of immutable data from cache when possible, and
+// store their responses in it otherwise. Blocks and state updates are only cached when queried by
+// number, never as "latest" or "pending".
+func (c *Client) WithCache(cache Cache) *Client {
+	c.cache = cache
+	return c
+}
+
+// cacheKey returns the cache key of a query, or false if its response may change over time
+func cacheKey(endpoint string, args map[string]string) (string, bool) {
+	switch endpoint {
+	case "get_block", "get_state_update":
+		if _, err := strconv.ParseUint(args["blockNumber"], 10, 64); err != nil {
+			return "", false
+		}
+	case "get_class_by_hash", "get_compiled_class_by_class_hash":
+	default:
+		return "", false
+	}
+
+	params := url.Values{}
+	for k, v := range args {
+		params.Add(k, v)
+	}
+	return endpoint + "?" + params.Encode(), true
+}
+
+// PrefetchRange fetches the blocks and state updates from `from` to `to`, both inclusive, into the
+// cache set with [Client.WithCache], skipping the ones that are already cached. It is meant to warm
+// the cache at startup. Only [WithBatchConcurrency] applies, the default concurrency is 1. The
+// errors of all failed fetches are returned.
+func (c *Client) PrefetchRange(ctx context.Context, from, to uint64, opts ...BatchOption) error {
+	if c.cache == nil {
+		return errors.New("prefetch requires a cache")
+	}
+
+	cfg := batchConfig{concurrency: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if to < from {
+		return nil
+	}
+
+	p := pool.New().WithErrors().WithMaxGoroutines(cfg.concurrency)
+	for i := uint64(0); i <= to-from; i++ {
+		args := map[string]string{"blockNumber": strconv.FormatUint(from+i, 10)}
+		for _, endpoint := range []string{"get_block", "get_state_update"} {
+			key, _ := cacheKey(endpoint, args)
+			if _, found := c.cache.Get(key); found {
+				continue
+			}
+
+			endpoint := endpoint
+			p.Go(func() error {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				_, _, err := c.getBody(ctx, endpoint, args, nil)
+				return err
+			})
+		}
+	}
+	return p.Wait()
+}
@@ -0,0 +1,92 @@
+package feeder
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/NethermindEth/juno/utils"
+)
+
+var ErrCircuitOpen = errors.New("feeder circuit breaker is open")
+
+type breakerState uint8
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker stops queries to the feeder after a number of consecutive failed queries.
+// While open, queries fail fast until the cooldown passes. Then a single probe query is let
+// through: the breaker closes if it succeeds and opens again otherwise.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	state     breakerState
+	openedAt  time.Time
+}
+
+// allow returns [ErrCircuitOpen] if the query with ctx must not be sent to the feeder at time now.
+func (cb *circuitBreaker) allow(ctx context.Context, now time.Time, log utils.SimpleLogger) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case breakerOpen:
+		if now.Sub(cb.openedAt) < cb.cooldown {
+			return ErrCircuitOpen
+		}
+		cb.state = breakerHalfOpen
+		log.Infow("Feeder circuit breaker half-open, probing feeder", withTag(ctx, nil)...)
+		return nil
+	case breakerHalfOpen:
+		// a probe is already in flight
+		return ErrCircuitOpen
+	default:
+		return nil
+	}
+}
+
+// rejecting reports whether the breaker would reject a query at time now, without letting a probe through
+func (cb *circuitBreaker) rejecting(now time.Time) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state == breakerHalfOpen || (cb.state == breakerOpen && now.Sub(cb.openedAt) < cb.cooldown)
+}
+
+// record updates the breaker with the result of the query with ctx that was allowed and completed at time now.
+func (cb *circuitBreaker) record(ctx context.Context, now time.Time, err error, log utils.SimpleLogger) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch {
+	case err == nil || errors.Is(err, ErrBlockNotFound):
+		if cb.state != breakerClosed {
+			log.Infow("Feeder circuit breaker closed", withTag(ctx, nil)...)
+		}
+		cb.state = breakerClosed
+		cb.failures = 0
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		// the feeder was not necessarily at fault, let the next query probe again
+		if cb.state == breakerHalfOpen {
+			cb.state = breakerOpen
+		}
+	case cb.state == breakerHalfOpen:
+		cb.state = breakerOpen
+		cb.openedAt = now
+		log.Warnw("Feeder circuit breaker opened, probe failed", withTag(ctx, []any{"cooldown", cb.cooldown.String()})...)
+	default:
+		cb.failures++
+		if cb.failures >= cb.threshold {
+			cb.state = breakerOpen
+			cb.openedAt = now
+			log.Warnw("Feeder circuit breaker opened",
+				withTag(ctx, []any{"failures", cb.failures, "cooldown", cb.cooldown.String()})...)
+		}
+	}
+}
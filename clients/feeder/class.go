@@ -2,6 +2,7 @@ package feeder
 
 import (
 	"encoding/json"
+	"errors"
 
 	"github.com/NethermindEth/juno/core/felt"
 )
@@ -37,6 +38,28 @@ type Cairo0Definition struct {
 	Program json.RawMessage `json:"program"`
 }
 
+var ErrUnexpectedClassVersion = errors.New("unexpected class version")
+
+// ClassVersion tells whether a [ClassDefinition] holds a legacy Cairo 0 class or a Sierra class.
+type ClassVersion uint8
+
+const (
+	UnknownClass ClassVersion = iota
+	LegacyClass
+	SierraClass
+)
+
+func (v ClassVersion) String() string {
+	switch v {
+	case LegacyClass:
+		return "legacy"
+	case SierraClass:
+		return "sierra"
+	default:
+		return "unknown"
+	}
+}
+
 type ClassDefinition struct {
 	V0 *Cairo0Definition
 	V1 *SierraDefinition
@@ -55,3 +78,15 @@ func (c *ClassDefinition) UnmarshalJSON(data []byte) error {
 	c.V0 = new(Cairo0Definition)
 	return json.Unmarshal(data, c.V0)
 }
+
+// Version returns the version of the class held by the definition.
+func (c *ClassDefinition) Version() ClassVersion {
+	switch {
+	case c.V1 != nil:
+		return SierraClass
+	case c.V0 != nil:
+		return LegacyClass
+	default:
+		return UnknownClass
+	}
+}
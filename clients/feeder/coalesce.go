@@ -0,0 +1,80 @@
+package feeder
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// coalescer shares a single fetch between concurrent queries of the same URL, see [Client.WithCoalescing]
+type coalescer struct {
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+type coalescedCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+
+	raw             []byte
+	networkDuration time.Duration
+	err             error
+}
+
+// do calls fetch for key unless a fetch for key is already in flight, in which case its result is
+// shared. The fetch is detached from the callers' contexts and only cancelled once all of them gave up.
+func (co *coalescer) do(ctx context.Context, key string,
+	fetch func(context.Context) ([]byte, time.Duration, error),
+) ([]byte, time.Duration, error) {
+	co.mu.Lock()
+	call, found := co.calls[key]
+	if !found {
+		// the fetch keeps the priority and the tag of the caller that started it
+		detached := WithPriority(context.Background(), priorityFrom(ctx))
+		if tag := TagFromContext(ctx); tag != "" {
+			detached = ContextWithTag(detached, tag)
+		}
+		fetchCtx, cancel := context.WithCancel(detached)
+		call = &coalescedCall{
+			done:   make(chan struct{}),
+			cancel: cancel,
+		}
+		co.calls[key] = call
+
+		go func() {
+			defer cancel()
+			call.raw, call.networkDuration, call.err = fetch(fetchCtx)
+
+			co.mu.Lock()
+			co.forget(key, call)
+			co.mu.Unlock()
+			close(call.done)
+		}()
+	}
+	call.waiters++
+	co.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.raw, call.networkDuration, call.err
+	case <-ctx.Done():
+		co.mu.Lock()
+		defer co.mu.Unlock()
+
+		call.waiters--
+		if call.waiters == 0 {
+			// nobody is interested in the result anymore, later queries start a new fetch
+			co.forget(key, call)
+			call.cancel()
+		}
+		return nil, 0, ctx.Err()
+	}
+}
+
+// forget removes call from the in-flight calls, unless another call for key replaced it already
+func (co *coalescer) forget(key string, call *coalescedCall) {
+	if co.calls[key] == call {
+		delete(co.calls, key)
+	}
+}
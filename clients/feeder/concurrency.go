@@ -0,0 +1,152 @@
+package feeder
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Priority orders requests that wait for a slot when the concurrency is limited, see [WithPriority]
+type Priority uint8
+
+const (
+	// PriorityNormal is the priority of requests without a priority, e.g. bulk backfill
+	PriorityNormal Priority = iota
+	// PriorityHigh is for latency-sensitive requests, e.g. polling the chain head
+	PriorityHigh
+
+	numPriorities = int(PriorityHigh) + 1
+)
+
+type priorityKey struct{}
+
+// WithPriority returns a context that gives the feeder requests made with it the given priority.
+// With [Client.WithMaxConcurrency], requests waiting for a slot get it in order of priority, and in
+// the order they started waiting among requests of the same priority. Requests that are already in
+// flight are never interrupted, so a high priority request waits at most for the first in-flight
+// request to finish, while normal priority requests wait as long as high priority ones keep coming.
+// Without a concurrency limit, the priority has no effect.
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+func priorityFrom(ctx context.Context) Priority {
+	if priority, ok := ctx.Value(priorityKey{}).(Priority); ok && int(priority) < numPriorities {
+		return priority
+	}
+	return PriorityNormal
+}
+
+// semaphore limits the number of requests to the feeder that are in flight at the same time. Waiting
+// requests are queued by priority.
+type semaphore struct {
+	mu      sync.Mutex
+	limit   int
+	used    int
+	waiters [numPriorities][]chan struct{}
+}
+
+func newSemaphore(n int) *semaphore {
+	return &semaphore{limit: n}
+}
+
+// acquire blocks until a slot is handed to the caller or ctx is done
+func (s *semaphore) acquire(ctx context.Context) error {
+	priority := priorityFrom(ctx)
+
+	s.mu.Lock()
+	if s.used < s.limit {
+		s.used++
+		s.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	s.waiters[priority] = append(s.waiters[priority], ready)
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		select {
+		case <-ready:
+			// the slot was handed over while giving up, pass it on
+			s.handOver()
+		default:
+			s.removeWaiter(priority, ready)
+		}
+		return ctx.Err()
+	}
+}
+
+func (s *semaphore) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handOver()
+}
+
+// handOver gives a slot that is being released to the first waiter with the highest priority, or
+// frees it if nobody is waiting. s.mu must be held.
+func (s *semaphore) handOver() {
+	for priority := numPriorities - 1; priority >= 0; priority-- {
+		if queue := s.waiters[priority]; len(queue) > 0 {
+			s.waiters[priority] = queue[1:]
+			close(queue[0])
+			return
+		}
+	}
+	s.used--
+}
+
+// removeWaiter removes a waiter that gave up from its queue. s.mu must be held.
+func (s *semaphore) removeWaiter(priority Priority, ready chan struct{}) {
+	queue := s.waiters[priority]
+	for i, waiter := range queue {
+		if waiter == ready {
+			s.waiters[priority] = append(queue[:i:i], queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// WithMaxConcurrency limits the number of requests to the feeder that are in flight at the same time
+// to n, e.g. to avoid running out of file descriptors when many goroutines share the client. A
+// request holds its slot from the moment it is sent until its response body is closed, waits between
+// retries don't. Requests block until a slot is free or their context is done, see [WithPriority]
+// for the order in which waiting requests get a slot. Head streams are not limited.
+func (c *Client) WithMaxConcurrency(n int) *Client {
+	if n <= 0 {
+		panic("max concurrency must be positive")
+	}
+	c.inFlight = newSemaphore(n)
+	return c
+}
+
+// acquireSlot waits for a request slot if the concurrency is limited and returns the function that
+// frees it
+func (c *Client) acquireSlot(ctx context.Context) (func(), error) {
+	if c.inFlight == nil {
+		return func() {}, nil
+	}
+
+	if err := c.inFlight.acquire(ctx); err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	return func() {
+		once.Do(c.inFlight.release)
+	}, nil
+}
+
+// releasingBody frees the request slot of the response when it is closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
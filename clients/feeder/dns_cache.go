@@ -0,0 +1,115 @@
+package feeder
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// dnsCache remembers the addresses that feeder hosts resolve to for a fixed time, so that new
+// connections don't wait for a DNS lookup.
+type dnsCache struct {
+	ttl      time.Duration
+	now      func() time.Time
+	resolver *net.Resolver
+
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+}
+
+// WithDNSCache caches the addresses that the feeder hosts resolve to for ttl, instead of resolving
+// them for every new connection. Cached addresses are dialled in order until one accepts the
+// connection, and are resolved again if none does. Lookups are done for the network set with
+// [Client.WithNetworkPreference], so a tcp4 preference only resolves IPv4 addresses.
+func (c *Client) WithDNSCache(ttl time.Duration) *Client {
+	c.dnsCache = &dnsCache{
+		ttl:      ttl,
+		now:      func() time.Time { return c.clock.Now() },
+		resolver: net.DefaultResolver,
+		entries:  make(map[string]dnsEntry),
+	}
+	c.applyTransportSettings()
+	return c
+}
+
+// dial connects to addr on the given network with dialContext, resolving the host through the cache
+func (d *dnsCache) dial(ctx context.Context, dialContext dialFunc, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return dialContext(ctx, network, addr)
+	}
+
+	addrs, err := d.lookup(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialErr error
+	for _, ip := range addrs {
+		var conn net.Conn
+		if conn, err = dialContext(ctx, network, net.JoinHostPort(ip, port)); err == nil {
+			return conn, nil
+		}
+		dialErr = errors.Join(dialErr, err)
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	// the host may have moved, resolve it again for the next connection
+	d.evict(network, host)
+	return nil, dialErr
+}
+
+// lookup returns the cached addresses of host, resolving it if they are missing or expired
+func (d *dnsCache) lookup(ctx context.Context, network, host string) ([]string, error) {
+	key := network + "/" + host
+	d.mu.Lock()
+	entry, found := d.entries[key]
+	d.mu.Unlock()
+	if found && d.now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	ipNetwork := "ip"
+	switch network {
+	case "tcp4":
+		ipNetwork = "ip4"
+	case "tcp6":
+		ipNetwork = "ip6"
+	}
+
+	ips, err := d.resolver.LookupIP(ctx, ipNetwork, host)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = ip.String()
+	}
+
+	d.mu.Lock()
+	d.entries[key] = dnsEntry{addrs: addrs, expires: d.now().Add(d.ttl)}
+	d.mu.Unlock()
+	return addrs, nil
+}
+
+func (d *dnsCache) evict(network, host string) {
+	d.mu.Lock()
+	delete(d.entries, network+"/"+host)
+	d.mu.Unlock()
+}
@@ -0,0 +1,75 @@
+package feeder
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// ContentDecoder returns a reader of the decoded contents of a response body that was compressed
+// with a content encoding.
+type ContentDecoder func(body io.Reader) (io.ReadCloser, error)
+
+func gzipDecoder(body io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(body)
+}
+
+func brotliDecoder(body io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(brotli.NewReader(body)), nil
+}
+
+// WithBrotli makes the client advertise "Accept-Encoding: gzip, br" and decode brotli-encoded
+// responses, which some CDN-fronted gateways negotiate. Brotli compresses large payloads, like
+// class definitions, notably better than gzip.
+func (c *Client) WithBrotli() *Client {
+	return c.WithContentDecoder("br", brotliDecoder)
+}
+
+// WithContentDecoder makes the client advertise the given content encoding, e.g. "br", in the
+// Accept-Encoding header of its queries and decode the responses that use it with decoder.
+//
+// Advertising an encoding turns off the transparent gzip handling of net/http, so gzip is then
+// advertised and decoded by the client itself.
+func (c *Client) WithContentDecoder(encoding string, decoder ContentDecoder) *Client {
+	if c.contentDecoders == nil {
+		c.contentDecoders = map[string]ContentDecoder{"gzip": gzipDecoder}
+		c.acceptEncoding = "gzip"
+	}
+
+	encoding = strings.ToLower(encoding)
+	if _, found := c.contentDecoders[encoding]; !found {
+		c.acceptEncoding += ", " + encoding
+	}
+	c.contentDecoders[encoding] = decoder
+	return c
+}
+
+// decodedBody closes both the decoder and the underlying response body
+type decodedBody struct {
+	io.ReadCloser
+	raw io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	return errors.Join(b.ReadCloser.Close(), b.raw.Close())
+}
+
+// decodeBody returns the body of res, decoded if it uses one of the content encodings set
+// with [Client.WithContentDecoder].
+func (c *Client) decodeBody(res *http.Response) (io.ReadCloser, error) {
+	encoding := strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding")))
+	decoder, found := c.contentDecoders[encoding]
+	if encoding == "" || !found {
+		return res.Body, nil
+	}
+
+	decoded, err := decoder(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &decodedBody{ReadCloser: decoded, raw: res.Body}, nil
+}
@@ -1,32 +1,196 @@
 package feeder
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"mime"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/NethermindEth/juno/core/felt"
 	"github.com/NethermindEth/juno/utils"
+	"github.com/sourcegraph/conc/pool"
 )
 
 type Backoff func(wait time.Duration) time.Duration
 
+// Clock is the source of time for the client's retries and timings
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Decoder decodes the JSON read from r into v.
+type Decoder func(r io.Reader, v any) error
+
+func jsonDecode(r io.Reader, v any) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// TimingsHook is called after every successful query with the endpoint that was queried, the tag of
+// the query set with [ContextWithTag], if any, the time spent fetching the response body (including
+// retries) and the time spent decoding it.
+type TimingsHook func(endpoint, tag string, networkDuration, decodeDuration time.Duration)
+
 type Client struct {
-	url        string
+	// urls holds the primary feeder URL followed by the fallback ones, active is the index of the one in use
+	urls       []string
+	active     atomic.Int32
 	client     *http.Client
 	backoff    Backoff
 	maxRetries int
 	maxWait    time.Duration
 	minWait    time.Duration
 	log        utils.SimpleLogger
+	clock      Clock
+	decoder    Decoder
+
+	requestIDFunc   func() string
+	timingsHook     TimingsHook
+	network         string
+	keepAlive       time.Duration
+	idleConnTimeout time.Duration
+	dnsCache        *dnsCache
+	http2Streams    int
+	breakers        map[string]*circuitBreaker
+	breakerLimit    int
+	breakerCooldown time.Duration
+	latency         *latencyTracker
+
+	maxResponseBytes         int64
+	endpointMaxResponseBytes map[string]int64
+	rejectReverted           bool
+	pendingDedup             *pendingDedup
+	contentDecoders          map[string]ContentDecoder
+	acceptEncoding           string
+	coalescer                *coalescer
+	cache                    Cache
+	gateways                 *gatewaySelector
+	staleOnError             bool
+	dryRun                   Responder
+	urlSigner                URLSigner
+	serverSkew               atomic.Int64
+	health                   map[string]*hostHealth
+	failbackInterval         time.Duration
+	lastFailback             atomic.Int64
+	strictDecode             bool
+	inFlight                 *semaphore
+	slowRequestThreshold     time.Duration
+	endpointResolver         EndpointResolver
+	serverErrorBackoff       *serverErrorBackoff
+	artificialLatency        time.Duration
+	rateLimitObserver        RateLimitObserver
+	lastRateLimit            atomic.Pointer[RateLimitInfo]
+	bodyWrapper              BodyWrapper
+	successStatusCodes       map[int]struct{}
+
+	// backgroundCtx is cancelled by [Client.Close] to stop the goroutines in background
+	backgroundCtx  context.Context
+	stopBackground context.CancelFunc
+	background     sync.WaitGroup
+	closed         atomic.Bool
+	// closeMu orders closing the client and starting work in background
+	closeMu sync.Mutex
+}
+
+var ErrNotModified = errors.New("not modified")
+
+// pendingDedup remembers the content hash of the last pending block returned by [Client.BlockPending]
+type pendingDedup struct {
+	mu       sync.Mutex
+	lastHash [sha256.Size]byte
+	seen     bool
+}
+
+func (d *pendingDedup) unchanged(contentHash [sha256.Size]byte) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.seen && d.lastHash == contentHash
+}
+
+func (d *pendingDedup) record(contentHash [sha256.Size]byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastHash = contentHash
+	d.seen = true
+}
+
+var ErrBlockReverted = errors.New("block was reverted")
+
+var ErrUnexpectedContentType = errors.New("unexpected content type")
+
+// ErrEmptyResponse is returned when the feeder responds with an empty body. Such responses are retried.
+var ErrEmptyResponse = errors.New("empty response body")
+
+// ErrBlockNotFound is returned when the feeder reports that the requested block doesn't exist, e.g.
+// because it is past the chain head. Such responses are not retried.
+var ErrBlockNotFound = errors.New("block not found")
+
+// maxBodySnippetBytes is the number of bytes of the body kept in an [UnexpectedContentTypeError]
+const maxBodySnippetBytes = 256
+
+// UnexpectedContentTypeError is returned when the feeder responds with something other than JSON.
+// It matches [ErrUnexpectedContentType] with errors.Is. Such responses are retried.
+type UnexpectedContentTypeError struct {
+	ContentType string
+	BodySnippet string
+}
+
+func (e *UnexpectedContentTypeError) Error() string {
+	return fmt.Sprintf("%s %q: %q", ErrUnexpectedContentType, e.ContentType, e.BodySnippet)
+}
+
+func (e *UnexpectedContentTypeError) Is(target error) bool {
+	return target == ErrUnexpectedContentType
+}
+
+// RequestStats describes how a single call to the feeder went, see [Client.BlockWithStats].
+type RequestStats struct {
+	// Attempts is the number of requests sent, including the first one
+	Attempts int
+	// TotalWait is the time spent waiting between attempts
+	TotalWait time.Duration
+	// StatusCodes holds the HTTP status of every attempt that got a response, in order
+	StatusCodes []int
+	// EffectiveURL is the URL that the successful response came from, after following redirects,
+	// and empty if the call failed
+	EffectiveURL string
+}
+
+// ResponseTooLargeError is returned when the body of a response exceeds the limit configured for
+// its endpoint with [Client.WithMaxResponseBytes] or [Client.WithMaxResponseBytesFor].
+type ResponseTooLargeError struct {
+	Endpoint string
+	Limit    int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("response from %s exceeds the limit of %d bytes", e.Endpoint, e.Limit)
 }
 
 func (c *Client) WithBackoff(b Backoff) *Client {
@@ -39,6 +203,42 @@ func (c *Client) WithMaxRetries(num int) *Client {
 	return c
 }
 
+// WithArtificialLatency makes the client wait for d before sending every request to the feeder,
+// including retries, to simulate a slow gateway in tests of timeouts and backoffs. The wait is cut
+// short if the query's context is done. It is disabled by default.
+func (c *Client) WithArtificialLatency(d time.Duration) *Client {
+	c.artificialLatency = d
+	return c
+}
+
+// serverErrorBackoff is the backoff applied after 5xx responses
+type serverErrorBackoff struct {
+	backoff Backoff
+	minWait time.Duration
+	maxWait time.Duration
+}
+
+// WithServerErrorBackoff sets a separate backoff, bounded by minWait and maxWait, for retries after
+// the feeder answers with a 5xx status. Such responses usually mean the gateway is overloaded, so it
+// is worth backing off harder than after connection errors and other failures, which keep using the
+// backoff set with [Client.WithBackoff]. By default, every failure uses the same backoff.
+func (c *Client) WithServerErrorBackoff(b Backoff, minWait, maxWait time.Duration) *Client {
+	c.serverErrorBackoff = &serverErrorBackoff{backoff: b, minWait: minWait, maxWait: maxWait}
+	return c
+}
+
+// next returns the wait before the retry that follows a 5xx response
+func (b *serverErrorBackoff) next(wait time.Duration) time.Duration {
+	if wait < b.minWait {
+		wait = b.minWait
+	}
+	wait = b.backoff(wait)
+	if wait > b.maxWait {
+		wait = b.maxWait
+	}
+	return wait
+}
+
 func (c *Client) WithMaxWait(d time.Duration) *Client {
 	c.maxWait = d
 	return c
@@ -54,6 +254,370 @@ func (c *Client) WithLogger(log utils.SimpleLogger) *Client {
 	return c
 }
 
+// WithClock sets the clock used to wait between retries and to measure durations, so that tests
+// can control time instead of sleeping.
+func (c *Client) WithClock(clock Clock) *Client {
+	c.clock = clock
+	return c
+}
+
+// LastServerSkew returns how far ahead of the local clock the clock of the feeder was, according to
+// the Date header of the last successful response. A negative skew means that the feeder is behind.
+// The Date header has a resolution of a second, so skews below that are not meaningful. Zero is
+// returned until a response with a Date header is received.
+func (c *Client) LastServerSkew() time.Duration {
+	return time.Duration(c.serverSkew.Load())
+}
+
+// recordServerSkew stores the skew between the Date header of res and the local clock, if res has one
+func (c *Client) recordServerSkew(res *http.Response) {
+	serverTime, err := http.ParseTime(res.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+	c.serverSkew.Store(int64(serverTime.Sub(c.clock.Now())))
+}
+
+// URLSigner adds authentication to the URL of a query, e.g. a signature query parameter.
+type URLSigner func(u *url.URL) error
+
+// WithURLSigner sets a function that signs the URL of every request sent to the feeder. It is called
+// again for every retry, so signatures that depend on the time stay fresh. The URLs returned by
+// [Client.BuildURL] are not signed.
+func (c *Client) WithURLSigner(signer URLSigner) *Client {
+	c.urlSigner = signer
+	return c
+}
+
+// newRequest returns a GET request of queryURL, signed with the URL signer if there is one.
+// [ErrClientClosed] is returned once the client is closed, so that retries stop too.
+func (c *Client) newRequest(ctx context.Context, queryURL string) (*http.Request, error) {
+	if c.closed.Load() {
+		return nil, ErrClientClosed
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", queryURL, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.urlSigner != nil {
+		if err = c.urlSigner(req.URL); err != nil {
+			return nil, fmt.Errorf("sign feeder URL: %w", err)
+		}
+	}
+	return req, nil
+}
+
+// WithSuccessStatusCodes sets the status codes of the responses that are accepted as successful,
+// e.g. to accept the 202 of endpoints that queue their work. Responses with other status codes are
+// retried, so 200 must be included to keep accepting it. By default, only 200 is accepted.
+func (c *Client) WithSuccessStatusCodes(codes ...int) *Client {
+	c.successStatusCodes = make(map[int]struct{}, len(codes))
+	for _, code := range codes {
+		c.successStatusCodes[code] = struct{}{}
+	}
+	return c
+}
+
+func (c *Client) isSuccessStatus(code int) bool {
+	if c.successStatusCodes == nil {
+		return code == http.StatusOK
+	}
+	_, found := c.successStatusCodes[code]
+	return found
+}
+
+// BodyWrapper wraps the response body of a query to the given endpoint, e.g. to count, hash or log
+// the bytes read from it. Closing the returned reader must close r.
+type BodyWrapper func(endpoint string, r io.ReadCloser) io.ReadCloser
+
+// WithBodyWrapper sets a function that wraps the body of every response before it is read, after it
+// has been decompressed. Bodies served from the cache are not read again and so are not wrapped.
+func (c *Client) WithBodyWrapper(wrapper BodyWrapper) *Client {
+	c.bodyWrapper = wrapper
+	return c
+}
+
+// wrapBody applies the body wrapper, if there is one, to the response body of a query to endpoint
+func (c *Client) wrapBody(endpoint string, body io.ReadCloser) io.ReadCloser {
+	if c.bodyWrapper == nil {
+		return body
+	}
+	return c.bodyWrapper(endpoint, body)
+}
+
+// WithDecoder sets the function that decodes the JSON responses of the feeder, e.g. to use a
+// faster JSON library than encoding/json. It must honour the json.Unmarshaler implementations of
+// the decoded types. The default decodes with a json.Decoder.
+func (c *Client) WithDecoder(decoder Decoder) *Client {
+	c.decoder = decoder
+	return c
+}
+
+// WithSlowRequestThreshold makes the client log a warning with the endpoint, the duration and the
+// number of attempts of every query that takes longer than d, including retries and fail overs. The
+// time spent reading the response body is not included. A zero threshold, the default, disables it.
+func (c *Client) WithSlowRequestThreshold(d time.Duration) *Client {
+	c.slowRequestThreshold = d
+	return c
+}
+
+// WithStrictDecode makes the client check responses for fields that the decoded types don't have,
+// which usually means that the feeder's schema changed and data is being dropped. Every unknown
+// field is logged as a warning with the endpoint it was found in, and the response is then decoded
+// as usual, so queries don't fail. Responses are decoded with encoding/json and json.Decoder's
+// DisallowUnknownFields, the decoder set with [Client.WithDecoder] only decodes the ones with unknown
+// fields. Types that implement json.Unmarshaler are only checked as far as their implementation
+// disallows unknown fields.
+func (c *Client) WithStrictDecode() *Client {
+	c.strictDecode = true
+	return c
+}
+
+// WithHTTPClient sets the http.Client used to query the feeder. The transport settings of the
+// client, e.g. [Client.WithNetworkPreference], are only applied if the transport of the given client
+// is an *http.Transport: any other RoundTripper is used as is.
+func (c *Client) WithHTTPClient(client *http.Client) *Client {
+	c.client = client
+	c.applyTransportSettings()
+	return c
+}
+
+// WithNetworkPreference forces connections to the feeder to be made over the given network,
+// either "tcp4" or "tcp6". The default, "tcp", allows both. The preference takes precedence
+// over the dialer of a client set with [Client.WithHTTPClient].
+func (c *Client) WithNetworkPreference(network string) *Client {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		panic("Unknown network preference " + network)
+	}
+
+	c.network = network
+	c.applyTransportSettings()
+	return c
+}
+
+// WithKeepAlive sets the interval between keep-alive probes of the connections to the feeder.
+func (c *Client) WithKeepAlive(d time.Duration) *Client {
+	c.keepAlive = d
+	c.applyTransportSettings()
+	return c
+}
+
+// WithIdleConnTimeout sets how long idle connections to the feeder are kept open for reuse.
+func (c *Client) WithIdleConnTimeout(d time.Duration) *Client {
+	c.idleConnTimeout = d
+	c.applyTransportSettings()
+	return c
+}
+
+// applyTransportSettings replaces the client with a copy whose transport dials on the preferred
+// network, resolves hosts through the DNS cache, uses the configured keep-alive and idle
+// connection timeout and attempts HTTP/2 with a bounded number of streams. Clients whose transport
+// is not an *http.Transport are left untouched.
+func (c *Client) applyTransportSettings() {
+	if c.network == "" && c.keepAlive == 0 && c.idleConnTimeout == 0 && c.dnsCache == nil && c.http2Streams == 0 {
+		return
+	}
+
+	base := c.client.Transport
+	if limiter, ok := base.(*streamLimiter); ok {
+		// the settings are applied again, limit the streams of the underlying transport anew
+		base = limiter.next
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	transport, ok := base.(*http.Transport)
+	if !ok || transport == nil {
+		// a custom RoundTripper, e.g. middleware, is used as is rather than dropped
+		return
+	}
+	transport = transport.Clone()
+
+	if c.network != "" || c.keepAlive != 0 || c.dnsCache != nil {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}
+		if c.keepAlive != 0 {
+			dialer.KeepAlive = c.keepAlive
+		}
+
+		network := c.network
+		cache := c.dnsCache
+		dialContext := dialer.DialContext
+		transport.DialContext = func(ctx context.Context, defaultNetwork, addr string) (net.Conn, error) {
+			dialNetwork := network
+			if dialNetwork == "" {
+				dialNetwork = defaultNetwork
+			}
+			if cache != nil {
+				return cache.dial(ctx, dialContext, dialNetwork, addr)
+			}
+			return dialContext(ctx, dialNetwork, addr)
+		}
+	}
+
+	if c.idleConnTimeout != 0 {
+		transport.IdleConnTimeout = c.idleConnTimeout
+	}
+
+	client := *c.client
+	client.Transport = transport
+	if c.http2Streams > 0 {
+		transport.ForceAttemptHTTP2 = true
+		client.Transport = &streamLimiter{next: transport, streams: newSemaphore(c.http2Streams)}
+	}
+	c.client = &client
+}
+
+// WithCircuitBreaker makes queries fail fast with [ErrCircuitOpen] for the cooldown period after
+// failureThreshold consecutive queries have failed, i.e. exhausted all their retries.
+// Once the cooldown passes, a single query probes the feeder to decide whether to resume.
+//
+// With [Client.WithFallbackURLs], every feeder URL has its own breaker.
+func (c *Client) WithCircuitBreaker(failureThreshold int, cooldown time.Duration) *Client {
+	c.breakerLimit = failureThreshold
+	c.breakerCooldown = cooldown
+	c.resetBreakers()
+	return c
+}
+
+// WithFallbackURLs sets the feeder URLs to fail over to when a query to the active URL exhausts its
+// retries or the circuit breaker of the active URL is open. The healthiest of the other URLs, i.e. the
+// one with the fewest consecutive failed queries and then the most recent successful one, takes over,
+// with earlier URLs preferred among equally healthy ones. It stays active for later queries until it
+// fails too. A single query tries every URL at most once. See [Client.WithFailbackInterval] to
+// return to the primary URL once it recovers.
+func (c *Client) WithFallbackURLs(urls ...string) *Client {
+	c.urls = append(c.urls[:1:1], urls...)
+	c.gateways = nil
+	c.active.Store(0)
+	c.resetHealth()
+	if c.breakers != nil {
+		c.resetBreakers()
+	}
+	return c
+}
+
+// resetBreakers gives every feeder URL a fresh circuit breaker
+func (c *Client) resetBreakers() {
+	c.breakers = make(map[string]*circuitBreaker, len(c.urls))
+	for _, baseURL := range c.urls {
+		c.breakers[baseURL] = &circuitBreaker{
+			threshold: c.breakerLimit,
+			cooldown:  c.breakerCooldown,
+		}
+	}
+}
+
+// ActiveURL returns the feeder URL that queries are currently sent to
+func (c *Client) ActiveURL() string {
+	return c.urls[c.active.Load()]
+}
+
+// failover makes the healthiest URL that the query has not tried yet active, or the healthiest URL
+// other than the one at index `from` if it tried them all, unless another query has already failed
+// over from it.
+func (c *Client) failover(ctx context.Context, from int32, tried []bool, err error) {
+	next := c.healthiest(func(index int32) bool { return tried[index] })
+	if next == -1 {
+		next = c.healthiest(func(index int32) bool { return index == from })
+	}
+	if next != -1 && c.active.CompareAndSwap(from, next) {
+		c.lastFailback.Store(c.clock.Now().UnixNano())
+		c.log.Warnw("Feeder failed, failing over", withTag(ctx, []any{"from", c.urls[from], "to", c.urls[next], "err", err})...)
+	}
+}
+
+// WithAdaptiveBackoff seeds the wait after the first failure of a query with twice the average
+// latency of successful queries, instead of minWait. Later retries use the configured backoff.
+// The wait is always clamped by minWait and maxWait.
+func (c *Client) WithAdaptiveBackoff() *Client {
+	c.latency = new(latencyTracker)
+	return c
+}
+
+// WithMaxResponseBytes limits the size of response bodies for all endpoints that don't have
+// a limit set with [Client.WithMaxResponseBytesFor]. A limit of 0 disables it.
+func (c *Client) WithMaxResponseBytes(n int64) *Client {
+	c.maxResponseBytes = n
+	return c
+}
+
+// WithMaxResponseBytesFor limits the size of response bodies for the given endpoint, e.g.
+// "get_class_by_hash", overriding the limit set with [Client.WithMaxResponseBytes].
+// A limit of 0 disables it for the endpoint.
+func (c *Client) WithMaxResponseBytesFor(endpoint string, n int64) *Client {
+	if c.endpointMaxResponseBytes == nil {
+		c.endpointMaxResponseBytes = make(map[string]int64)
+	}
+	c.endpointMaxResponseBytes[endpoint] = n
+	return c
+}
+
+// maxResponseBytesFor returns the most specific response size limit for the endpoint
+func (c *Client) maxResponseBytesFor(endpoint string) int64 {
+	if limit, found := c.endpointMaxResponseBytes[endpoint]; found {
+		return limit
+	}
+	return c.maxResponseBytes
+}
+
+// WithPendingDedup makes [Client.BlockPending] return [ErrNotModified] when the pending block is
+// identical to the one it returned last, so that callers can skip re-processing it.
+func (c *Client) WithPendingDedup() *Client {
+	c.pendingDedup = new(pendingDedup)
+	return c
+}
+
+// Responder produces the response body of a query in dry-run mode, see [Client.WithDryRun].
+type Responder func(endpoint string, args map[string]string) ([]byte, error)
+
+// WithDryRun makes the client answer queries with responder instead of sending them to the feeder,
+// e.g. to check which queries some code makes without running a server. The responder is called
+// once per query: errors it returns are not retried and don't count towards the circuit breaker.
+// Everything that happens to the response afterwards, like caching and decoding, is unchanged.
+// [Client.SubscribeHead] is not affected.
+func (c *Client) WithDryRun(responder Responder) *Client {
+	c.dryRun = responder
+	return c
+}
+
+// WithCoalescing makes concurrent identical queries, i.e. queries of the same URL, share a single
+// round-trip to the feeder. Every caller gets the shared result or error, unless its own context is
+// cancelled first. The shared round-trip is only cancelled once all of its callers gave up.
+// Calls that report per-call statistics, like [Client.BlockWithStats], are never coalesced.
+func (c *Client) WithCoalescing() *Client {
+	c.coalescer = &coalescer{calls: make(map[string]*coalescedCall)}
+	return c
+}
+
+// WithStrictReorgCheck makes [Client.Block] and [Client.StateUpdate] return [ErrBlockReverted]
+// when the gateway marks the block as reverted, so that reorgs are noticed before the state root
+// mismatches. Gateways that don't report a status are never considered reverted.
+func (c *Client) WithStrictReorgCheck() *Client {
+	c.rejectReverted = true
+	return c
+}
+
+// WithRequestIDFunc sets a function that generates an ID for every query. The ID is sent to
+// the feeder in the X-Request-Id header and attached to retry logs, so that a single fetch
+// can be traced across services. All retries of a query share the same ID.
+func (c *Client) WithRequestIDFunc(f func() string) *Client {
+	c.requestIDFunc = f
+	return c
+}
+
+// WithTimingsHook sets a hook that reports network and decoding durations of every query.
+func (c *Client) WithTimingsHook(hook TimingsHook) *Client {
+	c.timingsHook = hook
+	return c
+}
+
 func ExponentialBackoff(wait time.Duration) time.Duration {
 	return wait * 2
 }
@@ -119,6 +683,10 @@ func newTestServer(network utils.Network) *httptest.Server {
 		case strings.HasSuffix(r.URL.Path, "get_compiled_class_by_class_hash"):
 			dir = "compiled_class"
 			queryArg = "classHash"
+		case strings.HasSuffix(r.URL.Path, "head_stream"):
+			// like the feeder gateway, the test server doesn't expose a head stream
+			w.WriteHeader(http.StatusNotFound)
+			return
 		}
 
 		fileName, found := queryMap[queryArg]
@@ -134,6 +702,7 @@ func newTestServer(network utils.Network) *httptest.Server {
 			return
 		}
 
+		w.Header().Set("Content-Type", "application/json")
 		_, err = w.Write(read)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -142,22 +711,56 @@ func newTestServer(network utils.Network) *httptest.Server {
 }
 
 func NewClient(clientURL string) *Client {
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
 	return &Client{
-		url:        clientURL,
-		client:     http.DefaultClient,
-		backoff:    ExponentialBackoff,
-		maxRetries: 35, // ~3.5 minutes with default backoff and maxWait (block time on mainnet is 1-2 minutes)
-		maxWait:    10 * time.Second,
-		minWait:    time.Second,
-		log:        utils.NewNopZapLogger(),
+		urls:           []string{clientURL},
+		client:         http.DefaultClient,
+		backoff:        ExponentialBackoff,
+		maxRetries:     35, // ~3.5 minutes with default backoff and maxWait (block time on mainnet is 1-2 minutes)
+		maxWait:        10 * time.Second,
+		minWait:        time.Second,
+		log:            utils.NewNopZapLogger(),
+		clock:          realClock{},
+		decoder:        jsonDecode,
+		health:         map[string]*hostHealth{clientURL: new(hostHealth)},
+		backgroundCtx:  backgroundCtx,
+		stopBackground: stopBackground,
+	}
+}
+
+// EndpointResolver maps the endpoint names used by the client, e.g. "get_block", to the paths that
+// are queried on the feeder URLs, for gateways that don't follow the feeder's naming.
+type EndpointResolver interface {
+	Path(endpoint string) string
+}
+
+// WithEndpointResolver sets the resolver of the paths that are queried for every endpoint. The
+// endpoint names are kept everywhere else, e.g. in logs, metrics, caches and [Client.WithDryRun]
+// responders. By default, the endpoint name is the path.
+func (c *Client) WithEndpointResolver(resolver EndpointResolver) *Client {
+	c.endpointResolver = resolver
+	return c
+}
+
+// endpointPath returns the path that is queried for the given endpoint
+func (c *Client) endpointPath(endpoint string) string {
+	if c.endpointResolver == nil {
+		return endpoint
 	}
+	return c.endpointResolver.Path(endpoint)
+}
+
+// BuildURL returns the URL that is queried for the given endpoint and arguments on the active feeder
+// URL, with the arguments encoded as query parameters. An error is returned if the feeder base URL
+// is malformed.
+func (c *Client) BuildURL(endpoint string, args map[string]string) (string, error) {
+	return buildURL(c.ActiveURL(), c.endpointPath(endpoint), args)
 }
 
-// buildQueryString builds the query url with encoded parameters
-func (c *Client) buildQueryString(endpoint string, args map[string]string) string {
-	base, err := url.Parse(c.url)
+func buildURL(baseURL, endpoint string, args map[string]string) (string, error) {
+	base, err := url.Parse(baseURL)
 	if err != nil {
-		panic("Malformed feeder base URL")
+		return "", fmt.Errorf("malformed feeder base URL: %w", err)
 	}
 
 	base.Path += endpoint
@@ -168,134 +771,629 @@ func (c *Client) buildQueryString(endpoint string, args map[string]string) strin
 	}
 	base.RawQuery = params.Encode()
 
-	return base.String()
+	return base.String(), nil
 }
 
-// get performs a "GET" http request with the given URL and returns the response body
-func (c *Client) get(ctx context.Context, queryURL string) (io.ReadCloser, error) {
+// get performs a "GET" http request for the given endpoint and arguments and returns the response
+// body, failing over to the next feeder URL if the active one fails. If stats is not nil, the
+// attempts made are recorded in it.
+func (c *Client) get(ctx context.Context, endpoint string, args map[string]string,
+	stats *RequestStats,
+) (io.ReadCloser, error) {
+	if c.closed.Load() {
+		return nil, ErrClientClosed
+	}
+
+	if c.dryRun != nil {
+		body, err := c.dryRun(endpoint, args)
+		if err != nil {
+			return nil, err
+		}
+		return c.wrapBody(endpoint, io.NopCloser(bytes.NewReader(body))), nil
+	}
+
+	if c.slowRequestThreshold > 0 {
+		if stats == nil {
+			stats = new(RequestStats)
+		}
+		start := c.clock.Now()
+		defer func() {
+			if elapsed := c.clock.Now().Sub(start); elapsed > c.slowRequestThreshold {
+				logFields := []any{"endpoint", endpoint, "duration", elapsed.String(), "attempts", stats.Attempts}
+				c.log.Warnw("Slow feeder request", withTag(ctx, logFields)...)
+			}
+		}()
+	}
+
+	// the ID is shared by all the attempts of the query, including the ones on fallback URLs
+	var requestID string
+	if c.requestIDFunc != nil {
+		requestID = c.requestIDFunc()
+	}
+
+	var err error
+	tried := make([]bool, len(c.urls))
+	for range c.urls {
+		target := c.active.Load()
+		switch {
+		case c.gateways != nil:
+			target = c.weightedTarget(tried)
+		case target != 0 && !tried[0] && c.failbackDue():
+			target = 0
+		case tried[target]:
+			// another query failed over to a URL that this one has already tried
+			target = c.healthiest(func(index int32) bool { return tried[index] })
+		}
+		tried[target] = true
+
+		var queryURL string
+		if queryURL, err = buildURL(c.urls[target], c.endpointPath(endpoint), args); err != nil {
+			return nil, err
+		}
+
+		var body io.ReadCloser
+		body, err = c.getFrom(ctx, c.urls[target], endpoint, queryURL, requestID, stats)
+		c.recordHealth(target, err)
+		if err == nil {
+			if target == 0 && c.active.Swap(0) != 0 {
+				c.log.Infow("Primary feeder recovered, failing back", withTag(ctx, []any{"to", c.urls[0]})...)
+			}
+			return c.wrapBody(endpoint, body), nil
+		}
+
+		if ctx.Err() != nil || len(c.urls) == 1 || errors.Is(err, ErrBlockNotFound) {
+			return nil, err
+		}
+		if c.gateways == nil {
+			c.failover(ctx, target, tried, err)
+		}
+	}
+	return nil, err
+}
+
+// getFrom queries the given URL on the feeder at baseURL, going through the circuit breaker of baseURL
+func (c *Client) getFrom(ctx context.Context, baseURL, endpoint, queryURL, requestID string,
+	stats *RequestStats,
+) (io.ReadCloser, error) {
+	breaker := c.breakers[baseURL]
+	if breaker == nil {
+		return c.getWithRetries(ctx, endpoint, queryURL, requestID, stats)
+	}
+
+	if err := breaker.allow(ctx, c.clock.Now(), c.log); err != nil {
+		return nil, err
+	}
+	body, err := c.getWithRetries(ctx, endpoint, queryURL, requestID, stats)
+	breaker.record(ctx, c.clock.Now(), err, c.log)
+	return body, err
+}
+
+// getWithRetries performs the request to endpoint, retrying up to maxRetries times on failure.
+// requestID, if not empty, is sent with every attempt.
+func (c *Client) getWithRetries(ctx context.Context, endpoint, queryURL, requestID string,
+	stats *RequestStats,
+) (io.ReadCloser, error) {
 	var res *http.Response
 	var err error
+
 	wait := time.Duration(0)
 	for i := 0; i <= c.maxRetries; i++ {
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
-		case <-time.After(wait):
+		case <-c.clock.After(wait):
 			var req *http.Request
-			req, err = http.NewRequestWithContext(ctx, "GET", queryURL, http.NoBody)
+			req, err = c.newRequest(ctx, queryURL)
 			if err != nil {
 				return nil, err
 			}
+			if requestID != "" {
+				req.Header.Set("X-Request-Id", requestID)
+			}
+			if c.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", c.acceptEncoding)
+			}
+
+			if stats != nil {
+				stats.Attempts++
+				stats.TotalWait += wait
+			}
+
+			if c.artificialLatency > 0 {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-c.clock.After(c.artificialLatency):
+				}
+			}
+
+			var release func()
+			if release, err = c.acquireSlot(ctx); err != nil {
+				return nil, err
+			}
 
+			serverError := false
+			start := c.clock.Now()
 			res, err = c.client.Do(req)
 			if err == nil {
-				if res.StatusCode == http.StatusOK {
-					return res.Body, nil
-				} else {
+				serverError = res.StatusCode >= http.StatusInternalServerError
+				c.recordRateLimit(res)
+				if stats != nil {
+					stats.StatusCodes = append(stats.StatusCodes, res.StatusCode)
+				}
+				if !c.isSuccessStatus(res.StatusCode) {
 					err = errors.New(res.Status)
+					if blockNotFound(res, endpoint) {
+						err = ErrBlockNotFound
+					}
+				} else if err = checkContentType(res); err == nil {
+					var body io.ReadCloser
+					if body, err = c.decodeBody(res); err == nil {
+						if body, err = nonEmpty(body); err == nil {
+							c.recordServerSkew(res)
+							if stats != nil && res.Request != nil {
+								stats.EffectiveURL = res.Request.URL.String()
+							}
+							if c.latency != nil {
+								c.latency.observe(c.clock.Now().Sub(start))
+							}
+							return &releasingBody{ReadCloser: body, release: release}, nil
+						}
+					}
 				}
 
 				res.Body.Close()
 			}
+			release()
+
+			if errors.Is(err, ErrBlockNotFound) {
+				// the block doesn't exist (yet), retrying won't help
+				return nil, err
+			}
 
+			if serverError && c.serverErrorBackoff != nil {
+				wait = c.serverErrorBackoff.next(wait)
+			} else {
+				wait = c.nextWait(wait)
+			}
+			logFields := []any{"retryAfter", wait.String()}
+			if requestID != "" {
+				logFields = append(logFields, "requestID", requestID)
+			}
+			c.log.Warnw("failed query to feeder, retrying...", withTag(ctx, logFields)...)
+		}
+	}
+	return nil, err
+}
+
+// nonEmpty returns a body that reads the same as body, or [ErrEmptyResponse] if body is empty, e.g.
+// when the feeder responds with an empty 200 while it is being deployed. body is closed on error.
+func nonEmpty(body io.ReadCloser) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(body)
+	if _, err := buffered.Peek(1); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = ErrEmptyResponse
+		}
+		body.Close()
+		return nil, err
+	}
+	return &peekedBody{Reader: buffered, Closer: body}, nil
+}
+
+// peekedBody reads a body through the buffer that was used to peek into it
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// blockNotFound reports whether the feeder responded to a query of endpoint that the requested block
+// doesn't exist: either with the gateway's BLOCK_NOT_FOUND error code or with a 404 on an endpoint
+// that serves blocks. endpoint is the name the query was made with, not the resolved path.
+func blockNotFound(res *http.Response, endpoint string) bool {
+	if res.StatusCode != http.StatusBadRequest && res.StatusCode != http.StatusNotFound {
+		return false
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		switch endpoint {
+		case "get_block", "get_state_update":
+			return true
+		}
+	}
+
+	var gatewayErr struct {
+		Code string `json:"code"`
+	}
+	snippet, _ := io.ReadAll(io.LimitReader(res.Body, maxBodySnippetBytes))
+	return json.Unmarshal(snippet, &gatewayErr) == nil && gatewayErr.Code == "StarknetErrorCode.BLOCK_NOT_FOUND"
+}
+
+// checkContentType returns an [UnexpectedContentTypeError] if the response doesn't hold JSON,
+// e.g. when the feeder serves an HTML maintenance page with a 200 status.
+func checkContentType(res *http.Response) error {
+	contentType := res.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) {
+		return nil
+	}
+
+	snippet, _ := io.ReadAll(io.LimitReader(res.Body, maxBodySnippetBytes))
+	return &UnexpectedContentTypeError{
+		ContentType: contentType,
+		BodySnippet: string(snippet),
+	}
+}
+
+// nextWait returns how long to wait before retrying a failed query, given the previous wait
+func (c *Client) nextWait(wait time.Duration) time.Duration {
+	if wait == 0 && c.latency != nil {
+		if average, ok := c.latency.averageLatency(); ok {
+			wait = 2 * average
 			if wait < c.minWait {
 				wait = c.minWait
 			}
-			wait = c.backoff(wait)
 			if wait > c.maxWait {
 				wait = c.maxWait
 			}
-			c.log.Warnw("failed query to feeder, retrying...", "retryAfter", wait.String())
+			return wait
 		}
 	}
-	return nil, err
+
+	if wait < c.minWait {
+		wait = c.minWait
+	}
+	wait = c.backoff(wait)
+	if wait > c.maxWait {
+		wait = c.maxWait
+	}
+	return wait
 }
 
-func (c *Client) StateUpdate(ctx context.Context, blockID string) (*StateUpdate, error) {
-	queryURL := c.buildQueryString("get_state_update", map[string]string{
-		"blockNumber": blockID,
+// getAndDecode queries the given endpoint and decodes the JSON response into v. The body is fully
+// read before decoding so that the network and decoding durations can be reported separately.
+func (c *Client) getAndDecode(ctx context.Context, endpoint string, args map[string]string, v any) error {
+	raw, networkDuration, err := c.getBody(ctx, endpoint, args, nil)
+	if err != nil {
+		return err
+	}
+	return c.decode(ctx, endpoint, raw, networkDuration, v)
+}
+
+// getBody queries the given endpoint and returns the response body together with the time it took to fetch it.
+// If stats is not nil, the attempts made are recorded in it. The returned body may be shared with other
+// callers, so it must not be modified.
+func (c *Client) getBody(ctx context.Context, endpoint string, args map[string]string,
+	stats *RequestStats,
+) ([]byte, time.Duration, error) {
+	if c.closed.Load() {
+		return nil, 0, ErrClientClosed
+	}
+
+	key, cacheable := cacheKey(endpoint, args)
+	cacheable = cacheable && c.cache != nil
+	if cacheable {
+		if raw, found := c.cache.Get(key); found {
+			return raw, 0, nil
+		}
+	}
+
+	raw, networkDuration, err := c.queryBody(ctx, endpoint, args, stats)
+	if err == nil && cacheable {
+		c.cache.Put(key, raw)
+	}
+	return raw, networkDuration, err
+}
+
+// queryBody is getBody without caching
+func (c *Client) queryBody(ctx context.Context, endpoint string, args map[string]string,
+	stats *RequestStats,
+) ([]byte, time.Duration, error) {
+	if c.coalescer == nil || stats != nil {
+		return c.fetchBody(ctx, endpoint, args, stats)
+	}
+
+	queryURL, err := c.BuildURL(endpoint, args)
+	if err != nil {
+		return nil, 0, err
+	}
+	return c.coalescer.do(ctx, queryURL, func(ctx context.Context) ([]byte, time.Duration, error) {
+		return c.fetchBody(ctx, endpoint, args, nil)
 	})
+}
 
-	body, err := c.get(ctx, queryURL)
+// fetchBody is getBody without coalescing
+func (c *Client) fetchBody(ctx context.Context, endpoint string, args map[string]string,
+	stats *RequestStats,
+) ([]byte, time.Duration, error) {
+	start := c.clock.Now()
+	body, err := c.get(ctx, endpoint, args, stats)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer body.Close()
 
-	update := new(StateUpdate)
-	if err = json.NewDecoder(body).Decode(update); err != nil {
-		return nil, err
+	var reader io.Reader = body
+	limit := c.maxResponseBytesFor(endpoint)
+	if limit > 0 {
+		// read one byte past the limit to tell a body of exactly `limit` bytes from a larger one
+		reader = io.LimitReader(body, limit+1)
+	}
+
+	raw, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, 0, err
 	}
-	return update, nil
+	if limit > 0 && int64(len(raw)) > limit {
+		return nil, 0, &ResponseTooLargeError{Endpoint: endpoint, Limit: limit}
+	}
+	return raw, c.clock.Now().Sub(start), nil
 }
 
-func (c *Client) Transaction(ctx context.Context, transactionHash *felt.Felt) (*TransactionStatus, error) {
-	queryURL := c.buildQueryString("get_transaction", map[string]string{
-		"transactionHash": transactionHash.String(),
-	})
+// decode decodes the JSON response of the given endpoint into v and reports the timings
+func (c *Client) decode(ctx context.Context, endpoint string, raw []byte, networkDuration time.Duration, v any) error {
+	start := c.clock.Now()
+	if c.strictDecode {
+		decoded, err := c.decodeStrict(ctx, endpoint, raw, v)
+		if err != nil {
+			return err
+		} else if !decoded {
+			if err = c.decoder(bytes.NewReader(raw), v); err != nil {
+				return err
+			}
+		}
+	} else if err := c.decoder(bytes.NewReader(raw), v); err != nil {
+		return err
+	}
+
+	if c.timingsHook != nil {
+		c.timingsHook(endpoint, TagFromContext(ctx), networkDuration, c.clock.Now().Sub(start))
+	}
+	return nil
+}
 
-	body, err := c.get(ctx, queryURL)
+// decodeStrict decodes raw into v, disallowing unknown fields. If there is one, it is logged, v is
+// reset and false is returned so that raw is decoded again without the check.
+func (c *Client) decodeStrict(ctx context.Context, endpoint string, raw []byte, v any) (bool, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err == nil {
+		return true, nil
+	}
+
+	// encoding/json doesn't export an error type for unknown fields
+	field, unknown := strings.CutPrefix(err.Error(), "json: unknown field ")
+	if !unknown {
+		return false, err
+	}
+	c.log.Warnw("Feeder response has an unknown field, the feeder schema may have changed",
+		withTag(ctx, []any{"endpoint", endpoint, "field", strings.Trim(field, `"`)})...)
+
+	value := reflect.ValueOf(v).Elem()
+	value.Set(reflect.Zero(value.Type()))
+	return false, nil
+}
+
+// Raw queries any feeder endpoint with the given arguments and returns the response body as it was
+// received, e.g. to proxy endpoints that the client has no typed method for. The query is retried,
+// cached, coalesced and bounded by the response size limit of the endpoint like the typed queries
+// are, see [Client.WithMaxResponseBytesFor].
+func (c *Client) Raw(ctx context.Context, endpoint string, args map[string]string) (json.RawMessage, error) {
+	raw, _, err := c.getBody(ctx, endpoint, args, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer body.Close()
+	return bytes.Clone(raw), nil
+}
+
+func (c *Client) StateUpdate(ctx context.Context, blockID string) (*StateUpdate, error) {
+	update, _, err := c.stateUpdate(ctx, blockID)
+	return update, err
+}
 
+// StateUpdateRaw is like [Client.StateUpdate] but also returns the response body as it was
+// received, see [Client.BlockRaw].
+func (c *Client) StateUpdateRaw(ctx context.Context, blockID string) (*StateUpdate, json.RawMessage, error) {
+	update, raw, err := c.stateUpdate(ctx, blockID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return update, bytes.Clone(raw), nil
+}
+
+// stateUpdate fetches and decodes a state update, returning the response body too. The body may be
+// shared with the cache and other callers, so it must not be modified.
+func (c *Client) stateUpdate(ctx context.Context, blockID string) (*StateUpdate, []byte, error) {
+	const endpoint = "get_state_update"
+	args := map[string]string{
+		"blockNumber": blockID,
+	}
+	raw, networkDuration, err := c.getBody(ctx, endpoint, args, nil)
+	if err != nil {
+		if raw = c.staleBody(endpoint, args, err); raw == nil {
+			return nil, nil, err
+		}
+		err = &StaleError{Err: err}
+	}
+
+	update := new(StateUpdate)
+	if decodeErr := c.decode(ctx, endpoint, raw, networkDuration, update); decodeErr != nil {
+		return nil, nil, decodeErr
+	}
+
+	if c.rejectReverted && update.IsReverted() {
+		return nil, nil, fmt.Errorf("%w: state update of block %s", ErrBlockReverted, blockID)
+	}
+	return update, raw, err
+}
+
+func (c *Client) Transaction(ctx context.Context, transactionHash *felt.Felt) (*TransactionStatus, error) {
 	txStatus := new(TransactionStatus)
-	if err = json.NewDecoder(body).Decode(txStatus); err != nil {
+	if err := c.getAndDecode(ctx, "get_transaction", map[string]string{
+		"transactionHash": transactionHash.String(),
+	}, txStatus); err != nil {
 		return nil, err
 	}
 	return txStatus, nil
 }
 
+// TransactionStatuses fetches the statuses of the given transactions with at most `concurrency`
+// queries in flight. Unlike [Client.Transaction], a failed lookup doesn't abort the others: the
+// statuses that could be fetched are returned together with a combined error for the failed ones.
+func (c *Client) TransactionStatuses(ctx context.Context, hashes []*felt.Felt,
+	concurrency int,
+) (map[felt.Felt]*TransactionStatus, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var mu sync.Mutex
+	statuses := make(map[felt.Felt]*TransactionStatus, len(hashes))
+	var errs []error
+
+	p := pool.New().WithMaxGoroutines(concurrency)
+	for _, hash := range hashes {
+		hash := hash
+		p.Go(func() {
+			status, err := c.Transaction(ctx, hash)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("transaction %s: %w", hash, err))
+				return
+			}
+			statuses[*hash] = status
+		})
+	}
+	p.Wait()
+
+	return statuses, errors.Join(errs...)
+}
+
 func (c *Client) Block(ctx context.Context, blockID string) (*Block, error) {
-	queryURL := c.buildQueryString("get_block", map[string]string{
+	block, _, err := c.block(ctx, blockID, nil)
+	return block, err
+}
+
+// BlockRaw is like [Client.Block] but also returns the response body as it was received, e.g. to
+// serve it to clients that expect byte-identical feeder output. The body is read once and is
+// bounded by the response size limit of the endpoint, see [Client.WithMaxResponseBytes].
+func (c *Client) BlockRaw(ctx context.Context, blockID string) (*Block, json.RawMessage, error) {
+	block, raw, err := c.block(ctx, blockID, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return block, bytes.Clone(raw), nil
+}
+
+// BlockWithStats is like [Client.Block] but also reports how many attempts the call took, how long
+// it waited between them and the status codes it got. The stats are returned even if the call fails.
+func (c *Client) BlockWithStats(ctx context.Context, blockID string) (*Block, RequestStats, error) {
+	var stats RequestStats
+	block, _, err := c.block(ctx, blockID, &stats)
+	return block, stats, err
+}
+
+// block fetches and decodes a block, returning the response body too. The body may be shared with
+// the cache and other callers, so it must not be modified.
+func (c *Client) block(ctx context.Context, blockID string, stats *RequestStats) (*Block, []byte, error) {
+	const endpoint = "get_block"
+	args := map[string]string{
 		"blockNumber": blockID,
-	})
+	}
+	raw, networkDuration, err := c.getBody(ctx, endpoint, args, stats)
+	if err != nil {
+		if raw = c.staleBody(endpoint, args, err); raw == nil {
+			return nil, nil, err
+		}
+		err = &StaleError{Err: err}
+	}
+
+	block := new(Block)
+	if decodeErr := c.decode(ctx, endpoint, raw, networkDuration, block); decodeErr != nil {
+		return nil, nil, decodeErr
+	}
+
+	if c.rejectReverted && block.IsReverted() {
+		return nil, nil, fmt.Errorf("%w: block %s", ErrBlockReverted, blockID)
+	}
+	return block, raw, err
+}
 
-	body, err := c.get(ctx, queryURL)
+// BlockPending fetches the pending block. With [Client.WithPendingDedup], [ErrNotModified] is returned
+// instead if the pending block is identical to the one returned by the previous call.
+func (c *Client) BlockPending(ctx context.Context) (*Block, error) {
+	const endpoint = "get_block"
+	raw, networkDuration, err := c.getBody(ctx, endpoint, map[string]string{
+		"blockNumber": "pending",
+	}, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer body.Close()
+
+	var contentHash [sha256.Size]byte
+	if c.pendingDedup != nil {
+		contentHash = sha256.Sum256(raw)
+		if c.pendingDedup.unchanged(contentHash) {
+			return nil, ErrNotModified
+		}
+	}
 
 	block := new(Block)
-	if err = json.NewDecoder(body).Decode(block); err != nil {
+	if err = c.decode(ctx, endpoint, raw, networkDuration, block); err != nil {
 		return nil, err
 	}
+
+	if c.pendingDedup != nil {
+		c.pendingDedup.record(contentHash)
+	}
 	return block, nil
 }
 
 func (c *Client) ClassDefinition(ctx context.Context, classHash *felt.Felt) (*ClassDefinition, error) {
-	queryURL := c.buildQueryString("get_class_by_hash", map[string]string{
+	class := new(ClassDefinition)
+	if err := c.getAndDecode(ctx, "get_class_by_hash", map[string]string{
 		"classHash": classHash.String(),
-	})
+	}, class); err != nil {
+		return nil, err
+	}
+	return class, nil
+}
 
-	body, err := c.get(ctx, queryURL)
+// LegacyClassDefinition fetches the class with the given hash and returns its Cairo 0 definition.
+// [ErrUnexpectedClassVersion] is returned if the class is a Sierra class.
+func (c *Client) LegacyClassDefinition(ctx context.Context, classHash *felt.Felt) (*Cairo0Definition, error) {
+	class, err := c.ClassDefinition(ctx, classHash)
 	if err != nil {
 		return nil, err
 	}
-	defer body.Close()
 
-	class := new(ClassDefinition)
-	if err = json.NewDecoder(body).Decode(class); err != nil {
-		return nil, err
+	if version := class.Version(); version != LegacyClass {
+		return nil, fmt.Errorf("%w: class %s is a %s class", ErrUnexpectedClassVersion, classHash, version)
 	}
-	return class, nil
+	return class.V0, nil
 }
 
-func (c *Client) CompiledClassDefinition(ctx context.Context, classHash *felt.Felt) (json.RawMessage, error) {
-	queryURL := c.buildQueryString("get_compiled_class_by_class_hash", map[string]string{
-		"classHash": classHash.String(),
-	})
-
-	body, err := c.get(ctx, queryURL)
+// SierraClassDefinition fetches the class with the given hash and returns its Sierra definition.
+// [ErrUnexpectedClassVersion] is returned if the class is a legacy class.
+func (c *Client) SierraClassDefinition(ctx context.Context, classHash *felt.Felt) (*SierraDefinition, error) {
+	class, err := c.ClassDefinition(ctx, classHash)
 	if err != nil {
 		return nil, err
 	}
-	defer body.Close()
 
+	if version := class.Version(); version != SierraClass {
+		return nil, fmt.Errorf("%w: class %s is a %s class", ErrUnexpectedClassVersion, classHash, version)
+	}
+	return class.V1, nil
+}
+
+func (c *Client) CompiledClassDefinition(ctx context.Context, classHash *felt.Felt) (json.RawMessage, error) {
 	var class json.RawMessage
-	if err = json.NewDecoder(body).Decode(&class); err != nil {
+	if err := c.getAndDecode(ctx, "get_compiled_class_by_class_hash", map[string]string{
+		"classHash": classHash.String(),
+	}, &class); err != nil {
 		return nil, err
 	}
 	return class, nil
@@ -1,16 +1,31 @@
 package feeder_test
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
+	"net/url"
+	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/NethermindEth/juno/clients/feeder"
 	"github.com/NethermindEth/juno/core/felt"
 	"github.com/NethermindEth/juno/utils"
+	"github.com/andybalholm/brotli"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -221,14 +236,14 @@ func TestClassV1Unmarshal(t *testing.T) {
 }
 
 func TestBuildQueryString_WithErrorUrl(t *testing.T) {
-	defer func() {
-		if r := recover(); r == nil {
-			require.Fail(t, "The code did not panic")
-		}
-	}()
 	baseURL := "https\t://mock_feeder.io"
 	client := feeder.NewClient(baseURL)
-	_, _ = client.Block(context.Background(), strconv.Itoa(0))
+
+	_, err := client.BuildURL("get_block", map[string]string{"blockNumber": "0"})
+	require.ErrorContains(t, err, "malformed feeder base URL")
+
+	_, err = client.Block(context.Background(), strconv.Itoa(0))
+	require.ErrorContains(t, err, "malformed feeder base URL")
 }
 
 func TestStateUpdate(t *testing.T) {
@@ -303,6 +318,28 @@ func TestTransaction(t *testing.T) {
 	})
 }
 
+func TestTransactionStatuses(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	known := []*felt.Felt{
+		utils.HexToFelt(t, "0x93f542728e403f1edcea4a41f1509a39be35ebcad7d4b5aa77623e5e6480d"),
+		utils.HexToFelt(t, "0x631333277e88053336d8c302630b4420dc3ff24018a1c464da37d5e36ea19df"),
+		utils.HexToFelt(t, "0x6d3e06989ee2245139cd677f59b4da7f360a27b2b614a4eb088fdf5862d23ee"),
+	}
+	unknown := utils.HexToFelt(t, "0xffff")
+
+	statuses, err := client.TransactionStatuses(context.Background(), append(known, unknown), 2)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), unknown.String())
+
+	require.Len(t, statuses, len(known))
+	for _, hash := range known {
+		require.Contains(t, statuses, *hash)
+		assert.Equal(t, hash, statuses[*hash].Transaction.Hash)
+	}
+}
+
 func TestBlock(t *testing.T) {
 	client, closeFn := feeder.NewTestClient(utils.MAINNET)
 	t.Cleanup(closeFn)
@@ -343,6 +380,446 @@ func TestClassDefinition(t *testing.T) {
 	})
 }
 
+func TestClassDefinitionVersion(t *testing.T) {
+	legacyHash := utils.HexToFelt(t, "0x1efa8f84fd4dff9e2902ec88717cf0dafc8c188f80c3450615944a469428f7f")
+	sierraHash := utils.HexToFelt(t, "0x4e70b19333ae94bd958625f7b61ce9eec631653597e68645e13780061b2136c")
+
+	t.Run("legacy class", func(t *testing.T) {
+		client, closeFn := feeder.NewTestClient(utils.MAINNET)
+		t.Cleanup(closeFn)
+
+		class, err := client.ClassDefinition(context.Background(), legacyHash)
+		require.NoError(t, err)
+		assert.Equal(t, feeder.LegacyClass, class.Version())
+
+		legacy, err := client.LegacyClassDefinition(context.Background(), legacyHash)
+		require.NoError(t, err)
+		assert.Equal(t, class.V0, legacy)
+
+		_, err = client.SierraClassDefinition(context.Background(), legacyHash)
+		assert.ErrorIs(t, err, feeder.ErrUnexpectedClassVersion)
+	})
+
+	t.Run("sierra class", func(t *testing.T) {
+		client, closeFn := feeder.NewTestClient(utils.INTEGRATION)
+		t.Cleanup(closeFn)
+
+		class, err := client.ClassDefinition(context.Background(), sierraHash)
+		require.NoError(t, err)
+		assert.Equal(t, feeder.SierraClass, class.Version())
+
+		sierra, err := client.SierraClassDefinition(context.Background(), sierraHash)
+		require.NoError(t, err)
+		assert.Equal(t, class.V1, sierra)
+
+		_, err = client.LegacyClassDefinition(context.Background(), sierraHash)
+		assert.ErrorIs(t, err, feeder.ErrUnexpectedClassVersion)
+	})
+
+	t.Run("empty definition", func(t *testing.T) {
+		assert.Equal(t, feeder.UnknownClass, new(feeder.ClassDefinition).Version())
+	})
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	classHash := utils.HexToFelt(t, "0x1efa8f84fd4dff9e2902ec88717cf0dafc8c188f80c3450615944a469428f7f")
+	client.WithMaxResponseBytes(1024).WithMaxResponseBytesFor("get_class_by_hash", 0)
+
+	t.Run("global limit", func(t *testing.T) {
+		_, err := client.Block(context.Background(), "0")
+		var tooLarge *feeder.ResponseTooLargeError
+		require.ErrorAs(t, err, &tooLarge)
+		assert.Equal(t, "get_block", tooLarge.Endpoint)
+		assert.Equal(t, int64(1024), tooLarge.Limit)
+	})
+
+	t.Run("endpoint without limit", func(t *testing.T) {
+		_, err := client.ClassDefinition(context.Background(), classHash)
+		require.NoError(t, err)
+	})
+
+	t.Run("endpoint limit overrides global limit", func(t *testing.T) {
+		client.WithMaxResponseBytesFor("get_block", 1<<30).WithMaxResponseBytesFor("get_class_by_hash", 1024)
+
+		_, err := client.Block(context.Background(), "0")
+		require.NoError(t, err)
+
+		_, err = client.ClassDefinition(context.Background(), classHash)
+		var tooLarge *feeder.ResponseTooLargeError
+		require.ErrorAs(t, err, &tooLarge)
+		assert.Equal(t, "get_class_by_hash", tooLarge.Endpoint)
+	})
+}
+
+func TestBuildURL(t *testing.T) {
+	t.Run("encodes arguments", func(t *testing.T) {
+		client := feeder.NewClient("https://feeder.example/feeder_gateway/")
+
+		queryURL, err := client.BuildURL("get_block", map[string]string{
+			"blockNumber": "latest",
+			"with":        "a b",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "https://feeder.example/feeder_gateway/get_block?blockNumber=latest&with=a+b", queryURL)
+	})
+
+	t.Run("malformed base URL", func(t *testing.T) {
+		client := feeder.NewClient("http://[::1")
+
+		_, err := client.BuildURL("get_block", nil)
+		require.Error(t, err)
+
+		_, err = client.Block(context.Background(), "latest")
+		require.Error(t, err)
+	})
+}
+
+func TestUnexpectedContentType(t *testing.T) {
+	maxRetries := 2
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, err := w.Write([]byte("<html><body>Down for maintenance</body></html>"))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(maxRetries)
+	_, err := client.Block(context.Background(), "latest")
+	require.ErrorIs(t, err, feeder.ErrUnexpectedContentType)
+
+	var contentTypeErr *feeder.UnexpectedContentTypeError
+	require.ErrorAs(t, err, &contentTypeErr)
+	assert.Equal(t, "text/html; charset=utf-8", contentTypeErr.ContentType)
+	assert.Contains(t, contentTypeErr.BodySnippet, "Down for maintenance")
+	assert.Equal(t, maxRetries+1, calls)
+}
+
+func TestBlocks(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	var numbers []uint64
+	for result := range client.Blocks(context.Background(), 0, 2, feeder.WithBatchConcurrency(2)) {
+		require.NoError(t, result.Err)
+		assert.Equal(t, result.Number, result.Value.Number)
+		numbers = append(numbers, result.Number)
+	}
+	assert.Equal(t, []uint64{0, 1, 2}, numbers)
+
+	t.Run("failed fetch ends the batch", func(t *testing.T) {
+		var results []feeder.BatchResult[feeder.StateUpdate]
+		for result := range client.StateUpdates(context.Background(), 2, 4) {
+			results = append(results, result)
+		}
+		require.Len(t, results, 2)
+		require.NoError(t, results[0].Err)
+		require.Error(t, results[1].Err)
+	})
+}
+
+func TestBlocksFlushOnCancel(t *testing.T) {
+	blockRequested := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("blockNumber") == "2" {
+			close(blockRequested)
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte("{}"))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(0)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// with a concurrency of 1, blocks 0 and 1 have been fetched once block 2 is requested
+	results := client.Blocks(ctx, 0, 4, feeder.FlushOnCancel())
+	<-blockRequested
+	cancel()
+
+	var numbers []uint64
+	for result := range results {
+		require.NoError(t, result.Err)
+		numbers = append(numbers, result.Number)
+	}
+	assert.Equal(t, []uint64{0, 1}, numbers)
+}
+
+func TestRevertedBlock(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		status := ""
+		switch r.URL.Query().Get("blockNumber") {
+		case "1":
+			status = `"status": "REVERTED"`
+		case "2":
+			status = `"status": "ACCEPTED_ON_L2"`
+		}
+		_, err := w.Write([]byte("{" + status + "}"))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(0)
+
+	t.Run("status is exposed", func(t *testing.T) {
+		for blockID, reverted := range map[string]bool{"0": false, "1": true, "2": false} {
+			block, err := client.Block(context.Background(), blockID)
+			require.NoError(t, err)
+			assert.Equal(t, reverted, block.IsReverted(), blockID)
+
+			update, err := client.StateUpdate(context.Background(), blockID)
+			require.NoError(t, err)
+			assert.Equal(t, reverted, update.IsReverted(), blockID)
+		}
+	})
+
+	t.Run("strict reorg check", func(t *testing.T) {
+		client.WithStrictReorgCheck()
+
+		_, err := client.Block(context.Background(), "1")
+		require.ErrorIs(t, err, feeder.ErrBlockReverted)
+
+		_, err = client.StateUpdate(context.Background(), "1")
+		require.ErrorIs(t, err, feeder.ErrBlockReverted)
+
+		_, err = client.Block(context.Background(), "0")
+		require.NoError(t, err)
+	})
+}
+
+type fakeClock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+
+	fired := make(chan time.Time, 1)
+	fired <- c.now
+	return fired
+}
+
+func TestWithClock(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(srv.Close)
+
+	clock := new(fakeClock)
+	client := feeder.NewClient(srv.URL).
+		WithClock(clock).
+		WithBackoff(feeder.ExponentialBackoff).
+		WithMinWait(time.Second).
+		WithMaxWait(5 * time.Second).
+		WithMaxRetries(4)
+
+	_, err := client.Block(context.Background(), "0")
+	require.EqualError(t, err, "500 Internal Server Error")
+	assert.Equal(t, []time.Duration{0, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}, clock.waits)
+}
+
+func TestRawResponses(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	t.Run("block", func(t *testing.T) {
+		expected, err := os.ReadFile("testdata/mainnet/block/0.json")
+		require.NoError(t, err)
+
+		block, raw, err := client.BlockRaw(context.Background(), "0")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), block.Number)
+		assert.Equal(t, expected, []byte(raw))
+	})
+
+	t.Run("state update", func(t *testing.T) {
+		expected, err := os.ReadFile("testdata/mainnet/state_update/0.json")
+		require.NoError(t, err)
+
+		update, raw, err := client.StateUpdateRaw(context.Background(), "0")
+		require.NoError(t, err)
+		assert.Equal(t, utils.HexToFelt(t, "0x21870ba80540e7831fb21c591ee93481f5ae1bb71ff85a86ddd465be4eddee6"), update.NewRoot)
+		assert.Equal(t, expected, []byte(raw))
+	})
+
+	t.Run("response size limit", func(t *testing.T) {
+		client, closeFn := feeder.NewTestClient(utils.MAINNET)
+		t.Cleanup(closeFn)
+		client.WithMaxResponseBytes(16)
+
+		_, _, err := client.BlockRaw(context.Background(), "0")
+		var tooLarge *feeder.ResponseTooLargeError
+		require.ErrorAs(t, err, &tooLarge)
+	})
+}
+
+func TestBlockNotFound(t *testing.T) {
+	t.Run("past the head of the fixtures", func(t *testing.T) {
+		client, closeFn := feeder.NewTestClient(utils.MAINNET)
+		t.Cleanup(closeFn)
+		client.WithMaxRetries(3).WithMinWait(0)
+
+		_, stats, err := client.BlockWithStats(context.Background(), "999999999")
+		require.ErrorIs(t, err, feeder.ErrBlockNotFound)
+		assert.Equal(t, 1, stats.Attempts)
+
+		_, err = client.StateUpdate(context.Background(), "999999999")
+		require.ErrorIs(t, err, feeder.ErrBlockNotFound)
+	})
+
+	var calls atomic.Int32
+	body := `{"code": "StarknetErrorCode.BLOCK_NOT_FOUND", "message": "Block number 10 was not found."}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, err := w.Write([]byte(body))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+	client := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(2).WithMinWait(0)
+
+	t.Run("gateway error code", func(t *testing.T) {
+		_, err := client.Block(context.Background(), "10")
+		require.ErrorIs(t, err, feeder.ErrBlockNotFound)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("other bad requests are retried", func(t *testing.T) {
+		calls.Store(0)
+		body = `{"code": "StarknetErrorCode.MALFORMED_REQUEST"}`
+		_, err := client.Block(context.Background(), "10")
+		require.EqualError(t, err, "400 Bad Request")
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("404 on a resolved path", func(t *testing.T) {
+		notFound := httptest.NewServer(http.NotFoundHandler())
+		t.Cleanup(notFound.Close)
+		resolved := feeder.NewClient(notFound.URL + "/").WithBackoff(feeder.NopBackoff).WithMaxRetries(0).
+			WithEndpointResolver(prefixResolver{"get_block": "blocks/by_id"})
+
+		_, err := resolved.Block(context.Background(), "10")
+		require.ErrorIs(t, err, feeder.ErrBlockNotFound)
+	})
+}
+
+func TestBlockWithStats(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			_, err := w.Write([]byte(`{"block_number": 1}`))
+			require.NoError(t, err)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := feeder.NewClient(srv.URL).
+		WithClock(new(fakeClock)).
+		WithBackoff(feeder.ExponentialBackoff).
+		WithMinWait(time.Second).
+		WithMaxWait(5 * time.Second).
+		WithMaxRetries(4)
+
+	block, stats, err := client.BlockWithStats(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), block.Number)
+	assert.Equal(t, feeder.RequestStats{
+		Attempts:     3,
+		TotalWait:    6 * time.Second,
+		StatusCodes:  []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+		EffectiveURL: srv.URL + "/get_block?blockNumber=1",
+	}, stats)
+
+	t.Run("redirected call", func(t *testing.T) {
+		target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, err := w.Write([]byte(`{"block_number": 1}`))
+			require.NoError(t, err)
+		}))
+		t.Cleanup(target.Close)
+		redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, target.URL+"/gateway/get_block?"+r.URL.RawQuery, http.StatusFound)
+		}))
+		t.Cleanup(redirecting.Close)
+
+		client := feeder.NewClient(redirecting.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(0)
+		_, stats, err := client.BlockWithStats(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, target.URL+"/gateway/get_block?blockNumber=1", stats.EffectiveURL)
+	})
+
+	t.Run("failed call", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		t.Cleanup(failing.Close)
+
+		client := feeder.NewClient(failing.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(2)
+		_, stats, err := client.BlockWithStats(context.Background(), "1")
+		require.EqualError(t, err, "500 Internal Server Error")
+		assert.Equal(t, 3, stats.Attempts)
+		assert.Equal(t, []int{500, 500, 500}, stats.StatusCodes)
+		assert.Empty(t, stats.EffectiveURL)
+	})
+}
+
+func TestBlockPendingDedup(t *testing.T) {
+	var pending atomic.Value
+	pending.Store(`{"status": "PENDING", "timestamp": 1}`)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(pending.Load().(string)))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	t.Run("without dedup", func(t *testing.T) {
+		client := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(0)
+		for i := 0; i < 2; i++ {
+			block, err := client.BlockPending(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, "PENDING", block.Status)
+		}
+	})
+
+	t.Run("with dedup", func(t *testing.T) {
+		client := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(0).WithPendingDedup()
+
+		block, err := client.BlockPending(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), block.Timestamp)
+
+		_, err = client.BlockPending(context.Background())
+		require.ErrorIs(t, err, feeder.ErrNotModified)
+
+		pending.Store(`{"status": "PENDING", "timestamp": 2}`)
+		block, err = client.BlockPending(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), block.Timestamp)
+	})
+}
+
 func TestHttpError(t *testing.T) {
 	maxRetries := 2
 	callCount := make(map[string]int)
@@ -403,3 +880,1970 @@ func TestCompiledClassDefinition(t *testing.T) {
 	require.NoError(t, err)
 	require.True(t, json.Valid(class))
 }
+
+func TestRequestID(t *testing.T) {
+	maxRetries := 2
+	var gotIDs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotIDs = append(gotIDs, r.Header.Get("X-Request-Id"))
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(srv.Close)
+
+	generated := 0
+	client := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(maxRetries).
+		WithRequestIDFunc(func() string {
+			generated++
+			return "request-" + strconv.Itoa(generated)
+		})
+
+	_, err := client.Block(context.Background(), strconv.Itoa(0))
+	require.Error(t, err)
+	_, err = client.StateUpdate(context.Background(), strconv.Itoa(0))
+	require.Error(t, err)
+
+	assert.Equal(t, 2, generated)
+	assert.Equal(t, []string{"request-1", "request-1", "request-1", "request-2", "request-2", "request-2"}, gotIDs)
+}
+
+func TestRequestIDAcrossFailover(t *testing.T) {
+	var mu sync.Mutex
+	var gotIDs []string
+	failing := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		gotIDs = append(gotIDs, r.Header.Get("X-Request-Id"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	primary := httptest.NewServer(failing)
+	t.Cleanup(primary.Close)
+	fallback := httptest.NewServer(failing)
+	t.Cleanup(fallback.Close)
+
+	generated := 0
+	client := feeder.NewClient(primary.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(1).
+		WithFallbackURLs(fallback.URL).
+		WithRequestIDFunc(func() string {
+			generated++
+			return "request-" + strconv.Itoa(generated)
+		})
+
+	_, err := client.Block(context.Background(), strconv.Itoa(0))
+	require.Error(t, err)
+
+	assert.Equal(t, 1, generated)
+	assert.Equal(t, []string{"request-1", "request-1", "request-1", "request-1"}, gotIDs)
+}
+
+func TestTimingsHook(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	var endpoints []string
+	client.WithTimingsHook(func(endpoint, _ string, networkDuration, decodeDuration time.Duration) {
+		endpoints = append(endpoints, endpoint)
+		assert.Positive(t, networkDuration)
+		assert.Positive(t, decodeDuration)
+	})
+
+	_, err := client.Block(context.Background(), strconv.Itoa(11817))
+	require.NoError(t, err)
+	_, err = client.StateUpdate(context.Background(), strconv.Itoa(0))
+	require.NoError(t, err)
+
+	t.Run("hook is not called on failed queries", func(t *testing.T) {
+		_, err = client.Block(context.Background(), strconv.Itoa(1000000))
+		require.Error(t, err)
+	})
+
+	assert.Equal(t, []string{"get_block", "get_state_update"}, endpoints)
+}
+
+func TestNetworkPreference(t *testing.T) {
+	t.Run("ipv4", func(t *testing.T) {
+		client, closeFn := feeder.NewTestClient(utils.MAINNET)
+		t.Cleanup(closeFn)
+		client.WithNetworkPreference("tcp4")
+
+		_, err := client.Block(context.Background(), strconv.Itoa(11817))
+		require.NoError(t, err)
+	})
+
+	t.Run("ipv6 can't reach an ipv4 server", func(t *testing.T) {
+		client, closeFn := feeder.NewTestClient(utils.MAINNET)
+		t.Cleanup(closeFn)
+		client.WithNetworkPreference("tcp6")
+
+		_, err := client.Block(context.Background(), strconv.Itoa(11817))
+		require.Error(t, err)
+	})
+
+	t.Run("preference survives a custom http client", func(t *testing.T) {
+		client, closeFn := feeder.NewTestClient(utils.MAINNET)
+		t.Cleanup(closeFn)
+		client.WithNetworkPreference("tcp6").WithHTTPClient(&http.Client{})
+
+		_, err := client.Block(context.Background(), strconv.Itoa(11817))
+		require.Error(t, err)
+	})
+
+	t.Run("custom round tripper is kept", func(t *testing.T) {
+		client, closeFn := feeder.NewTestClient(utils.MAINNET)
+		t.Cleanup(closeFn)
+
+		var calls int
+		client.WithNetworkPreference("tcp6").WithHTTPClient(&http.Client{
+			Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calls++
+				return http.DefaultTransport.RoundTrip(req)
+			}),
+		})
+
+		_, err := client.Block(context.Background(), strconv.Itoa(11817))
+		require.NoError(t, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("unknown network", func(t *testing.T) {
+		assert.Panics(t, func() {
+			feeder.NewClient("http://localhost").WithNetworkPreference("udp")
+		})
+	})
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestConnectionSettings(t *testing.T) {
+	var newConns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte("{}"))
+		require.NoError(t, err)
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	fetchTwice := func(t *testing.T, client *feeder.Client) int32 {
+		newConns.Store(0)
+		for i := 0; i < 2; i++ {
+			_, err := client.Block(context.Background(), "0")
+			require.NoError(t, err)
+			time.Sleep(100 * time.Millisecond)
+		}
+		return newConns.Load()
+	}
+
+	t.Run("idle connections are reused", func(t *testing.T) {
+		client := feeder.NewClient(srv.URL).WithMaxRetries(0).WithKeepAlive(time.Minute).WithHTTPClient(&http.Client{})
+		assert.Equal(t, int32(1), fetchTwice(t, client))
+	})
+
+	t.Run("idle connections time out", func(t *testing.T) {
+		client := feeder.NewClient(srv.URL).WithMaxRetries(0).WithIdleConnTimeout(10 * time.Millisecond)
+		assert.Equal(t, int32(2), fetchTwice(t, client))
+	})
+}
+
+func TestDNSCache(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"block_number": 1}`))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	// the test server only listens on 127.0.0.1
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+	hostURL := "http://localhost:" + port
+
+	t.Run("hosts are resolved", func(t *testing.T) {
+		client := feeder.NewClient(hostURL).
+			WithMaxRetries(0).
+			WithIdleConnTimeout(time.Millisecond).
+			WithNetworkPreference("tcp4").
+			WithDNSCache(time.Minute)
+
+		for i := 0; i < 2; i++ {
+			block, err := client.Block(context.Background(), "1")
+			require.NoError(t, err)
+			assert.Equal(t, uint64(1), block.Number)
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("network preference is respected", func(t *testing.T) {
+		client := feeder.NewClient(hostURL).
+			WithMaxRetries(0).
+			WithDNSCache(time.Minute).
+			WithNetworkPreference("tcp6")
+
+		_, err := client.Block(context.Background(), "1")
+		require.Error(t, err)
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		client := feeder.NewClient(hostURL).WithMaxRetries(0).WithDNSCache(time.Minute)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := client.Block(ctx, "1")
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			peak := maxInFlight.Load()
+			if current <= peak || maxInFlight.CompareAndSwap(peak, current) {
+				break
+			}
+		}
+
+		<-unblock
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"block_number": 1}`))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := feeder.NewClient(srv.URL).WithMaxRetries(0).WithMaxConcurrency(2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Block(context.Background(), "1")
+			assert.NoError(t, err)
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		return inFlight.Load() == 2
+	}, time.Second, 10*time.Millisecond)
+
+	t.Run("blocked requests respect the context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := client.Block(ctx, "1")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	close(unblock)
+	wg.Wait()
+	assert.Equal(t, int32(2), maxInFlight.Load())
+
+	t.Run("invalid limit", func(t *testing.T) {
+		assert.Panics(t, func() {
+			feeder.NewClient(srv.URL).WithMaxConcurrency(0)
+		})
+	})
+}
+
+func TestPriority(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		number := r.URL.Query().Get("blockNumber")
+		mu.Lock()
+		order = append(order, number)
+		mu.Unlock()
+
+		<-unblock
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"block_number": ` + number + `}`))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := feeder.NewClient(srv.URL).WithMaxRetries(0).WithMaxConcurrency(1)
+
+	var wg sync.WaitGroup
+	fetch := func(ctx context.Context, number string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Block(ctx, number)
+			assert.NoError(t, err)
+		}()
+		// let the request take its place in the queue
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	fetch(context.Background(), "0")
+	fetch(context.Background(), "1")
+	fetch(context.Background(), "2")
+	fetch(feeder.WithPriority(context.Background(), feeder.PriorityHigh), "3")
+	fetch(feeder.WithPriority(context.Background(), feeder.PriorityNormal), "4")
+
+	close(unblock)
+	wg.Wait()
+	assert.Equal(t, []string{"0", "3", "1", "2", "4"}, order)
+}
+
+func TestSubscribeHead(t *testing.T) {
+	t.Run("streaming unsupported", func(t *testing.T) {
+		client, closeFn := feeder.NewTestClient(utils.MAINNET)
+		t.Cleanup(closeFn)
+
+		_, err := client.SubscribeHead(context.Background())
+		require.ErrorIs(t, err, feeder.ErrStreamingUnsupported)
+	})
+
+	t.Run("reconnects after disconnect", func(t *testing.T) {
+		connections := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			connections++
+			w.Header().Set("Content-Type", "text/event-stream")
+			if connections == 1 {
+				_, err := w.Write([]byte("data: {\"block_number\": 1}\n\n: comment\ndata: {\"block_number\": 2}\n\n"))
+				require.NoError(t, err)
+				return
+			}
+
+			_, err := w.Write([]byte("data: {\"block_number\": 3}\n\n"))
+			require.NoError(t, err)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}))
+		t.Cleanup(srv.Close)
+
+		client := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff)
+		ctx, cancel := context.WithCancel(context.Background())
+		heads, err := client.SubscribeHead(ctx)
+		require.NoError(t, err)
+
+		for expected := uint64(1); expected <= 3; expected++ {
+			head := <-heads
+			require.NotNil(t, head)
+			assert.Equal(t, expected, head.Number)
+		}
+
+		cancel()
+		_, open := <-heads
+		assert.False(t, open)
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var calls int
+	var mu sync.Mutex
+	healthy := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if !healthy {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte("{}"))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	cooldown := time.Minute
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	client := feeder.NewClient(srv.URL).WithClock(clock).WithBackoff(feeder.NopBackoff).WithMaxRetries(1).
+		WithCircuitBreaker(2, cooldown)
+
+	for i := 0; i < 2; i++ {
+		_, err := client.Block(context.Background(), "0")
+		require.EqualError(t, err, "500 Internal Server Error")
+	}
+	assert.Equal(t, 4, calls)
+
+	t.Run("open breaker fails fast", func(t *testing.T) {
+		_, err := client.Block(context.Background(), "0")
+		require.ErrorIs(t, err, feeder.ErrCircuitOpen)
+		assert.Equal(t, 4, calls)
+	})
+
+	t.Run("breaker stays open during the cooldown", func(t *testing.T) {
+		clock.now = clock.now.Add(cooldown - time.Second)
+		_, err := client.Block(context.Background(), "0")
+		require.ErrorIs(t, err, feeder.ErrCircuitOpen)
+		assert.Equal(t, 4, calls)
+	})
+
+	t.Run("failed probe opens the breaker again", func(t *testing.T) {
+		clock.now = clock.now.Add(time.Second)
+		_, err := client.Block(context.Background(), "0")
+		require.EqualError(t, err, "500 Internal Server Error")
+		assert.Equal(t, 6, calls)
+
+		_, err = client.Block(context.Background(), "0")
+		require.ErrorIs(t, err, feeder.ErrCircuitOpen)
+	})
+
+	t.Run("successful probe closes the breaker", func(t *testing.T) {
+		mu.Lock()
+		healthy = true
+		mu.Unlock()
+
+		clock.now = clock.now.Add(cooldown)
+		_, err := client.Block(context.Background(), "0")
+		require.NoError(t, err)
+
+		_, err = client.Block(context.Background(), "0")
+		require.NoError(t, err)
+		assert.Equal(t, 8, calls)
+	})
+}
+
+func TestFallbackURLs(t *testing.T) {
+	var primaryCalls, fallbackCalls atomic.Int32
+	var primaryHealthy atomic.Bool
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		primaryCalls.Add(1)
+		if !primaryHealthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"block_number": 1}`))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(primary.Close)
+
+	var fallbackHealthy atomic.Bool
+	fallbackHealthy.Store(true)
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fallbackCalls.Add(1)
+		if !fallbackHealthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"block_number": 2}`))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(fallback.Close)
+
+	client := feeder.NewClient(primary.URL).
+		WithBackoff(feeder.NopBackoff).
+		WithMaxRetries(1).
+		WithFallbackURLs(fallback.URL)
+	require.Equal(t, primary.URL, client.ActiveURL())
+
+	block, stats, err := client.BlockWithStats(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), block.Number)
+	assert.Equal(t, fallback.URL, client.ActiveURL())
+	assert.Equal(t, 3, stats.Attempts)
+	assert.Equal(t, int32(2), primaryCalls.Load())
+
+	t.Run("fallback stays active", func(t *testing.T) {
+		primaryHealthy.Store(true)
+		block, err := client.Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), block.Number)
+		assert.Equal(t, int32(2), primaryCalls.Load())
+	})
+
+	t.Run("wraps around to the primary", func(t *testing.T) {
+		fallbackHealthy.Store(false)
+		block, err := client.Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), block.Number)
+		assert.Equal(t, primary.URL, client.ActiveURL())
+	})
+
+	t.Run("every url is tried at most once", func(t *testing.T) {
+		primaryHealthy.Store(false)
+		primaryCalls.Store(0)
+		fallbackCalls.Store(0)
+
+		_, err := client.Block(context.Background(), "1")
+		require.EqualError(t, err, "503 Service Unavailable")
+		assert.Equal(t, int32(2), primaryCalls.Load())
+		assert.Equal(t, int32(2), fallbackCalls.Load())
+	})
+
+	t.Run("open circuit breaker fails over", func(t *testing.T) {
+		primaryHealthy.Store(false)
+		fallbackHealthy.Store(true)
+		client := feeder.NewClient(primary.URL).
+			WithBackoff(feeder.NopBackoff).
+			WithMaxRetries(0).
+			WithCircuitBreaker(1, time.Hour).
+			WithFallbackURLs(fallback.URL, primary.URL)
+
+		// opens the breaker of the primary URL, which is also the last fallback
+		_, err := client.Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, fallback.URL, client.ActiveURL())
+
+		fallbackHealthy.Store(false)
+		primaryCalls.Store(0)
+		_, err = client.Block(context.Background(), "1")
+		require.ErrorIs(t, err, feeder.ErrCircuitOpen)
+		assert.Equal(t, int32(0), primaryCalls.Load())
+	})
+}
+
+func TestHostHealthFailover(t *testing.T) {
+	newServer := func(number int) (*httptest.Server, *atomic.Bool, *atomic.Int32) {
+		var healthy atomic.Bool
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			calls.Add(1)
+			if !healthy.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, err := fmt.Fprintf(w, `{"block_number": %d}`, number)
+			require.NoError(t, err)
+		}))
+		t.Cleanup(srv.Close)
+		return srv, &healthy, &calls
+	}
+	primary, primaryHealthy, _ := newServer(0)
+	backup1, backup1Healthy, backup1Calls := newServer(1)
+	backup2, backup2Healthy, _ := newServer(2)
+	backup2Healthy.Store(true)
+
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	client := feeder.NewClient(primary.URL).
+		WithBackoff(feeder.NopBackoff).
+		WithMaxRetries(0).
+		WithClock(clock).
+		WithFallbackURLs(backup1.URL, backup2.URL).
+		WithFailbackInterval(time.Minute)
+
+	block, err := client.Block(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), block.Number)
+
+	status := client.HostStatus()
+	require.Len(t, status, 3)
+	assert.Equal(t, feeder.HostHealth{
+		URL:                 primary.URL,
+		ConsecutiveFailures: 1,
+		LastFailure:         clock.now,
+	}, status[0])
+	assert.Equal(t, 1, status[1].ConsecutiveFailures)
+	assert.Equal(t, feeder.HostHealth{
+		URL:         backup2.URL,
+		Active:      true,
+		LastSuccess: clock.now,
+	}, status[2])
+
+	t.Run("primary is not probed before the interval", func(t *testing.T) {
+		primaryHealthy.Store(true)
+		clock.now = clock.now.Add(30 * time.Second)
+		block, err := client.Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), block.Number)
+		assert.Equal(t, backup2.URL, client.ActiveURL())
+	})
+
+	t.Run("fails back to the primary", func(t *testing.T) {
+		clock.now = clock.now.Add(time.Minute)
+		block, err := client.Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), block.Number)
+		assert.Equal(t, primary.URL, client.ActiveURL())
+	})
+
+	t.Run("fails over to the healthiest backup", func(t *testing.T) {
+		primaryHealthy.Store(false)
+		backup1Healthy.Store(true)
+		backup1Calls.Store(0)
+
+		// backup1 is next in order, but unlike backup2 it failed the last time it was queried
+		block, err := client.Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), block.Number)
+		assert.Equal(t, backup2.URL, client.ActiveURL())
+		assert.Equal(t, int32(0), backup1Calls.Load())
+	})
+
+	t.Run("failed probe continues with the active url", func(t *testing.T) {
+		clock.now = clock.now.Add(time.Minute)
+		block, err := client.Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), block.Number)
+		assert.Equal(t, backup2.URL, client.ActiveURL())
+		assert.Equal(t, 2, client.HostStatus()[0].ConsecutiveFailures)
+	})
+}
+
+type retryLogger struct {
+	utils.SimpleLogger
+	retryAfter []string
+}
+
+func (l *retryLogger) Warnw(msg string, keysAndValues ...any) {
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		if keysAndValues[i] == "retryAfter" {
+			l.retryAfter = append(l.retryAfter, keysAndValues[i+1].(string))
+		}
+	}
+}
+
+func TestAdaptiveBackoff(t *testing.T) {
+	latency := 50 * time.Millisecond
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		if calls == 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		time.Sleep(latency)
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte("{}"))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	log := &retryLogger{SimpleLogger: utils.NewNopZapLogger()}
+	client := feeder.NewClient(srv.URL).WithMinWait(time.Millisecond).WithMaxWait(time.Second).
+		WithAdaptiveBackoff().WithLogger(log)
+
+	_, err := client.Block(context.Background(), "0")
+	require.NoError(t, err)
+	_, err = client.Block(context.Background(), "0")
+	require.NoError(t, err)
+
+	require.Len(t, log.retryAfter, 1)
+	wait, err := time.ParseDuration(log.retryAfter[0])
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, wait, 2*latency)
+	assert.Less(t, wait, time.Second)
+}
+
+func TestContentDecoder(t *testing.T) {
+	body := []byte(`{"block_number": 7}`)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var buf bytes.Buffer
+		switch accepted := r.Header.Get("Accept-Encoding"); {
+		case strings.Contains(accepted, "deflate"):
+			fw, err := flate.NewWriter(&buf, flate.BestCompression)
+			require.NoError(t, err)
+			_, err = fw.Write(body)
+			require.NoError(t, err)
+			require.NoError(t, fw.Close())
+			w.Header().Set("Content-Encoding", "deflate")
+		case strings.Contains(accepted, "gzip"):
+			gw := gzip.NewWriter(&buf)
+			_, err := gw.Write(body)
+			require.NoError(t, err)
+			require.NoError(t, gw.Close())
+			w.Header().Set("Content-Encoding", "gzip")
+		default:
+			buf.Write(body)
+		}
+
+		_, err := w.Write(buf.Bytes())
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	var closed atomic.Int32
+	client := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(0).
+		WithContentDecoder("deflate", func(r io.Reader) (io.ReadCloser, error) {
+			return &closeCounter{ReadCloser: flate.NewReader(r), closed: &closed}, nil
+		})
+
+	block, err := client.Block(context.Background(), "7")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(7), block.Number)
+	assert.Equal(t, int32(1), closed.Load())
+
+	t.Run("gzip is still decoded", func(t *testing.T) {
+		client := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(0).
+			WithContentDecoder("x-unused", func(r io.Reader) (io.ReadCloser, error) {
+				return io.NopCloser(r), nil
+			})
+
+		block, err := client.Block(context.Background(), "7")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(7), block.Number)
+	})
+}
+
+func TestBrotli(t *testing.T) {
+	body := []byte(`{"block_number": 7}`)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gzip, br", r.Header.Get("Accept-Encoding"))
+
+		var buf bytes.Buffer
+		bw := brotli.NewWriter(&buf)
+		_, err := bw.Write(body)
+		require.NoError(t, err)
+		require.NoError(t, bw.Close())
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "br")
+		_, err = w.Write(buf.Bytes())
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(0).WithBrotli()
+
+	block, err := client.Block(context.Background(), "7")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(7), block.Number)
+}
+
+type closeCounter struct {
+	io.ReadCloser
+	closed *atomic.Int32
+}
+
+func (c *closeCounter) Close() error {
+	c.closed.Add(1)
+	return c.ReadCloser.Close()
+}
+
+func TestCoalescing(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"block_number": ` + r.URL.Query().Get("blockNumber") + `}`))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(0).WithCoalescing()
+
+	const numCallers = 5
+	var wg sync.WaitGroup
+	blocks := make([]*feeder.Block, numCallers)
+	errs := make([]error, numCallers)
+	for i := 0; i < numCallers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			blocks[i], errs[i] = client.Block(context.Background(), "3")
+		}(i)
+	}
+
+	// a different query is not coalesced
+	other := make(chan *feeder.Block)
+	go func() {
+		block, err := client.Block(context.Background(), "4")
+		require.NoError(t, err)
+		other <- block
+	}()
+
+	require.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, time.Millisecond)
+	// give the remaining callers time to join the fetch in flight
+	time.Sleep(50 * time.Millisecond)
+
+	// a caller that gives up doesn't affect the others
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := client.Block(ctx, "3")
+	require.ErrorIs(t, err, context.Canceled)
+
+	close(release)
+	wg.Wait()
+
+	for i := 0; i < numCallers; i++ {
+		require.NoError(t, errs[i])
+		assert.Equal(t, uint64(3), blocks[i].Number)
+	}
+	assert.Equal(t, uint64(4), (<-other).Number)
+	assert.Equal(t, int32(2), calls.Load())
+
+	t.Run("later queries fetch again", func(t *testing.T) {
+		block, err := client.Block(context.Background(), "3")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(3), block.Number)
+		assert.Equal(t, int32(3), calls.Load())
+	})
+}
+
+func TestWithDecoder(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	var decoded []string
+	client.WithDecoder(func(r io.Reader, v any) error {
+		decoded = append(decoded, fmt.Sprintf("%T", v))
+		return json.NewDecoder(r).Decode(v)
+	})
+
+	block, err := client.Block(context.Background(), "0")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), block.Number)
+
+	_, err = client.StateUpdate(context.Background(), "0")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"*feeder.Block", "*feeder.StateUpdate"}, decoded)
+
+	t.Run("decoder errors are returned", func(t *testing.T) {
+		decodeErr := errors.New("decode failed")
+		client.WithDecoder(func(io.Reader, any) error {
+			return decodeErr
+		})
+
+		_, err := client.Block(context.Background(), "0")
+		require.ErrorIs(t, err, decodeErr)
+	})
+}
+
+type fieldLogger struct {
+	utils.SimpleLogger
+	fields []any
+}
+
+func (l *fieldLogger) Warnw(msg string, keysAndValues ...any) {
+	l.fields = append(l.fields, keysAndValues...)
+}
+
+func TestStrictDecode(t *testing.T) {
+	response := `{"block_number": 5}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(response))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	log := &fieldLogger{SimpleLogger: utils.NewNopZapLogger()}
+	client := feeder.NewClient(srv.URL).WithLogger(log).WithStrictDecode()
+
+	block, err := client.Block(context.Background(), "5")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), block.Number)
+	assert.Empty(t, log.fields)
+
+	t.Run("unknown field is logged", func(t *testing.T) {
+		response = `{"block_number": 5, "block_hash": "0x1", "new_field": true}`
+		block, err := client.Block(context.Background(), "5")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(5), block.Number)
+		assert.Equal(t, "0x1", block.Hash.String())
+		assert.Equal(t, []any{"endpoint", "get_block", "field", "new_field"}, log.fields)
+	})
+
+	t.Run("lenient by default", func(t *testing.T) {
+		log.fields = nil
+		block, err := feeder.NewClient(srv.URL).WithLogger(log).Block(context.Background(), "5")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(5), block.Number)
+		assert.Empty(t, log.fields)
+	})
+
+	t.Run("malformed response", func(t *testing.T) {
+		response = `{"block_number": "five"}`
+		_, err := client.Block(context.Background(), "5")
+		require.Error(t, err)
+	})
+}
+
+type slowRequestLogger struct {
+	utils.SimpleLogger
+	fields [][]any
+}
+
+func (l *slowRequestLogger) Warnw(msg string, keysAndValues ...any) {
+	if msg == "Slow feeder request" {
+		l.fields = append(l.fields, keysAndValues)
+	}
+}
+
+func TestSlowRequestThreshold(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"block_number": 1}`))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	log := &slowRequestLogger{SimpleLogger: utils.NewNopZapLogger()}
+	client := feeder.NewClient(srv.URL).
+		WithLogger(log).
+		WithClock(&fakeClock{now: time.Unix(1700000000, 0)}).
+		WithBackoff(func(time.Duration) time.Duration { return time.Second }).
+		WithSlowRequestThreshold(500 * time.Millisecond)
+
+	// the retry waits for a second
+	_, err := client.Block(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, [][]any{{"endpoint", "get_block", "duration", "1s", "attempts", 2}}, log.fields)
+
+	t.Run("fast request", func(t *testing.T) {
+		log.fields = nil
+		_, err := client.Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Empty(t, log.fields)
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		log.fields = nil
+		calls.Store(0)
+		_, err := feeder.NewClient(srv.URL).
+			WithLogger(log).
+			WithClock(&fakeClock{now: time.Unix(1700000000, 0)}).
+			WithBackoff(feeder.NopBackoff).
+			Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Empty(t, log.fields)
+	})
+}
+
+func TestPrefetchRange(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		number := r.URL.Query().Get("blockNumber")
+		if number == "latest" {
+			number = "9"
+		}
+		_, err := w.Write([]byte(`{"block_number": ` + number + `}`))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(0)
+	require.Error(t, client.PrefetchRange(context.Background(), 0, 2))
+
+	client.WithCache(feeder.NewMemoryCache(0))
+	require.NoError(t, client.PrefetchRange(context.Background(), 0, 2, feeder.WithBatchConcurrency(3)))
+	assert.Equal(t, int32(6), calls.Load())
+
+	block, err := client.Block(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), block.Number)
+	assert.Equal(t, int32(6), calls.Load())
+
+	t.Run("cached entries are skipped", func(t *testing.T) {
+		require.NoError(t, client.PrefetchRange(context.Background(), 1, 3))
+		assert.Equal(t, int32(8), calls.Load())
+	})
+
+	t.Run("mutable queries are not cached", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			block, err := client.Block(context.Background(), "latest")
+			require.NoError(t, err)
+			assert.Equal(t, uint64(9), block.Number)
+		}
+		assert.Equal(t, int32(10), calls.Load())
+	})
+}
+
+func TestDryRun(t *testing.T) {
+	type query struct {
+		endpoint string
+		args     map[string]string
+	}
+
+	var queries []query
+	responderErr := errors.New("no such transaction")
+	client := feeder.NewClient("http://localhost:0/feeder_gateway/").
+		WithDryRun(func(endpoint string, args map[string]string) ([]byte, error) {
+			queries = append(queries, query{endpoint: endpoint, args: args})
+			if endpoint == "get_transaction" {
+				return nil, responderErr
+			}
+			return []byte(`{"block_number": 5}`), nil
+		})
+
+	block, err := client.Block(context.Background(), "5")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), block.Number)
+
+	_, err = client.StateUpdate(context.Background(), "latest")
+	require.NoError(t, err)
+
+	_, err = client.Transaction(context.Background(), new(felt.Felt).SetUint64(1))
+	require.ErrorIs(t, err, responderErr)
+
+	assert.Equal(t, []query{
+		{endpoint: "get_block", args: map[string]string{"blockNumber": "5"}},
+		{endpoint: "get_state_update", args: map[string]string{"blockNumber": "latest"}},
+		{endpoint: "get_transaction", args: map[string]string{"transactionHash": "0x1"}},
+	}, queries)
+}
+
+func TestLastServerSkew(t *testing.T) {
+	serverTime := time.Date(2023, time.June, 1, 12, 0, 0, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Date", serverTime.Format(http.TimeFormat))
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte("{}"))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	clock := &fakeClock{now: serverTime.Add(-90 * time.Second)}
+	client := feeder.NewClient(srv.URL).WithClock(clock).WithMaxRetries(0)
+	assert.Zero(t, client.LastServerSkew())
+
+	_, err := client.Block(context.Background(), "0")
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Second, client.LastServerSkew())
+
+	clock.now = serverTime.Add(30 * time.Second)
+	_, err = client.Block(context.Background(), "0")
+	require.NoError(t, err)
+	assert.Equal(t, -30*time.Second, client.LastServerSkew())
+}
+
+func TestEmptyResponseRetry(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if calls.Add(1) == 1 {
+			return
+		}
+		_, err := w.Write([]byte(`{"block_number": 3}`))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(1)
+	block, err := client.Block(context.Background(), "3")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), block.Number)
+	assert.Equal(t, int32(2), calls.Load())
+
+	t.Run("retries are exhausted", func(t *testing.T) {
+		empty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+		}))
+		t.Cleanup(empty.Close)
+
+		client := feeder.NewClient(empty.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(1)
+		_, err := client.Block(context.Background(), "3")
+		require.ErrorIs(t, err, feeder.ErrEmptyResponse)
+	})
+
+	t.Run("invalid content is not retried", func(t *testing.T) {
+		calls.Store(0)
+		invalid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			calls.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			_, err := w.Write([]byte(`{"block_number": `))
+			require.NoError(t, err)
+		}))
+		t.Cleanup(invalid.Close)
+
+		client := feeder.NewClient(invalid.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(1)
+		_, err := client.Block(context.Background(), "3")
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, feeder.ErrEmptyResponse)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+}
+
+func TestURLSigner(t *testing.T) {
+	var signatures []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signatures = append(signatures, r.URL.Query().Get("signature"))
+		assert.Equal(t, "7", r.URL.Query().Get("blockNumber"))
+		if len(signatures) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"block_number": 7}`))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	signed := 0
+	client := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(1).
+		WithURLSigner(func(u *url.URL) error {
+			signed++
+			query := u.Query()
+			query.Set("signature", "sig-"+strconv.Itoa(signed))
+			u.RawQuery = query.Encode()
+			return nil
+		})
+
+	block, err := client.Block(context.Background(), "7")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(7), block.Number)
+	assert.Equal(t, []string{"sig-1", "sig-2"}, signatures)
+
+	t.Run("signer errors are returned", func(t *testing.T) {
+		signErr := errors.New("key rotation in progress")
+		client.WithURLSigner(func(*url.URL) error {
+			return signErr
+		})
+
+		_, err := client.Block(context.Background(), "7")
+		require.ErrorIs(t, err, signErr)
+		assert.Len(t, signatures, 2)
+	})
+}
+
+type prefixResolver map[string]string
+
+func (r prefixResolver) Path(endpoint string) string {
+	if path, found := r[endpoint]; found {
+		return path
+	}
+	return "v2/" + endpoint
+}
+
+func TestEndpointResolver(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"block_number": 7}`))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := feeder.NewClient(srv.URL + "/").WithBackoff(feeder.NopBackoff).WithMaxRetries(0).
+		WithEndpointResolver(prefixResolver{"get_block": "blocks/by_id"})
+
+	block, err := client.Block(context.Background(), "7")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(7), block.Number)
+
+	_, err = client.StateUpdate(context.Background(), "7")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/blocks/by_id", "/v2/get_state_update"}, paths)
+
+	queryURL, err := client.BuildURL("get_class_by_hash", map[string]string{"classHash": "0x1"})
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL+"/v2/get_class_by_hash?classHash=0x1", queryURL)
+}
+
+func TestBlockStream(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	block, err := client.Block(context.Background(), "1")
+	require.NoError(t, err)
+	require.NotEmpty(t, block.Transactions)
+
+	var txs []*feeder.Transaction
+	header, err := client.BlockStream(context.Background(), "1", func(tx *feeder.Transaction) error {
+		txs = append(txs, tx)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, block.Transactions, txs)
+	assert.Equal(t, &feeder.BlockHeader{
+		Hash:             block.Hash,
+		ParentHash:       block.ParentHash,
+		Number:           block.Number,
+		StateRoot:        block.StateRoot,
+		Status:           block.Status,
+		GasPrice:         block.GasPrice,
+		Timestamp:        block.Timestamp,
+		Version:          block.Version,
+		SequencerAddress: block.SequencerAddress,
+	}, header)
+
+	t.Run("callback errors abort decoding", func(t *testing.T) {
+		stopErr := errors.New("stop")
+		calls := 0
+		_, err := client.BlockStream(context.Background(), "1", func(*feeder.Transaction) error {
+			calls++
+			return stopErr
+		})
+		require.ErrorIs(t, err, stopErr)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("response size limit", func(t *testing.T) {
+		limited, closeLimited := feeder.NewTestClient(utils.MAINNET)
+		t.Cleanup(closeLimited)
+		limited.WithMaxResponseBytes(64)
+
+		_, err := limited.BlockStream(context.Background(), "1", func(*feeder.Transaction) error {
+			return nil
+		})
+		var tooLarge *feeder.ResponseTooLargeError
+		require.ErrorAs(t, err, &tooLarge)
+	})
+}
+
+func TestServerErrorBackoff(t *testing.T) {
+	statuses := []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusInternalServerError}
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if call := int(calls.Add(1)); call <= len(statuses) {
+			w.WriteHeader(statuses[call-1])
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"block_number": 1}`))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	newClient := func(clock *fakeClock) *feeder.Client {
+		return feeder.NewClient(srv.URL).
+			WithClock(clock).
+			WithMaxRetries(len(statuses)).
+			WithBackoff(feeder.ExponentialBackoff).
+			WithMinWait(time.Second).
+			WithMaxWait(10 * time.Second)
+	}
+
+	t.Run("5xx responses use the server error backoff", func(t *testing.T) {
+		calls.Store(0)
+		clock := new(fakeClock)
+		_, err := newClient(clock).
+			WithServerErrorBackoff(feeder.ExponentialBackoff, 5*time.Second, time.Minute).
+			Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, []time.Duration{0, 10 * time.Second, 10 * time.Second, 20 * time.Second}, clock.waits)
+	})
+
+	t.Run("single backoff by default", func(t *testing.T) {
+		calls.Store(0)
+		clock := new(fakeClock)
+		_, err := newClient(clock).Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, []time.Duration{0, 2 * time.Second, 4 * time.Second, 8 * time.Second}, clock.waits)
+	})
+}
+
+func TestConnectionWarmer(t *testing.T) {
+	var warmed atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		assert.Equal(t, "/get_block", r.URL.Path)
+		assert.Equal(t, "latest", r.URL.Query().Get("blockNumber"))
+	}))
+	t.Cleanup(srv.Close)
+
+	// requests are counted when sent, the server may still see a request that Close cancelled
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		warmed.Add(1)
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	client := feeder.NewClient(srv.URL + "/").WithHTTPClient(&http.Client{Transport: transport}).
+		WithConnectionWarmer(10 * time.Millisecond)
+	require.Eventually(t, func() bool {
+		return warmed.Load() >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, client.Close())
+	require.NoError(t, client.Close())
+
+	// Close waits for the warmer to stop, so no request is sent afterwards
+	stopped := warmed.Load()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, stopped, warmed.Load())
+}
+
+func TestClose(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	_, err := client.Block(context.Background(), "0")
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// in-flight queries either complete or fail because of the close
+			if _, err := client.Block(context.Background(), "1"); err != nil {
+				assert.ErrorIs(t, err, feeder.ErrClientClosed)
+			}
+			assert.NoError(t, client.Close())
+		}()
+	}
+	wg.Wait()
+
+	_, err = client.Block(context.Background(), "0")
+	require.ErrorIs(t, err, feeder.ErrClientClosed)
+	_, err = client.StateUpdate(context.Background(), "0")
+	require.ErrorIs(t, err, feeder.ErrClientClosed)
+	require.NoError(t, client.Close())
+
+	t.Run("cached responses are not served", func(t *testing.T) {
+		cached, closeCached := feeder.NewTestClient(utils.MAINNET)
+		t.Cleanup(closeCached)
+		cached.WithCache(feeder.NewMemoryCache(0))
+
+		_, err := cached.Block(context.Background(), "0")
+		require.NoError(t, err)
+		require.NoError(t, cached.Close())
+
+		_, err = cached.Block(context.Background(), "0")
+		require.ErrorIs(t, err, feeder.ErrClientClosed)
+	})
+
+	t.Run("idle connections of the client's transport are closed", func(t *testing.T) {
+		var closed atomic.Bool
+		transport := &idleTrackingTransport{closed: &closed}
+		require.NoError(t, feeder.NewClient("http://localhost/").WithHTTPClient(&http.Client{Transport: transport}).Close())
+		assert.True(t, closed.Load())
+	})
+
+	t.Run("shared default transport is left open", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+		t.Cleanup(srv.Close)
+
+		reused := func() bool {
+			var info httptrace.GotConnInfo
+			req, err := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(),
+				&httptrace.ClientTrace{GotConn: func(i httptrace.GotConnInfo) { info = i }}), http.MethodGet, srv.URL, http.NoBody)
+			require.NoError(t, err)
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			require.NoError(t, res.Body.Close())
+			return info.Reused
+		}
+
+		reused()
+		require.NoError(t, feeder.NewClient(srv.URL).Close())
+		assert.True(t, reused())
+	})
+
+	t.Run("no background work after close", func(t *testing.T) {
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			calls.Add(1)
+		}))
+		t.Cleanup(srv.Close)
+
+		closedClient := feeder.NewClient(srv.URL + "/")
+		require.NoError(t, closedClient.Close())
+		closedClient.WithConnectionWarmer(time.Millisecond)
+		time.Sleep(20 * time.Millisecond)
+		assert.Zero(t, calls.Load())
+	})
+}
+
+// idleTrackingTransport records whether its idle connections were closed
+type idleTrackingTransport struct {
+	http.RoundTripper
+	closed *atomic.Bool
+}
+
+func (t *idleTrackingTransport) CloseIdleConnections() {
+	t.closed.Store(true)
+}
+
+func TestArtificialLatency(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1)%2 == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"block_number": 1}`))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	t.Run("every attempt is delayed", func(t *testing.T) {
+		clock := new(fakeClock)
+		_, err := feeder.NewClient(srv.URL).WithClock(clock).WithBackoff(feeder.NopBackoff).WithMaxRetries(1).
+			WithArtificialLatency(3*time.Second).
+			Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, []time.Duration{0, 3 * time.Second, 0, 3 * time.Second}, clock.waits)
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		clock := new(fakeClock)
+		_, err := feeder.NewClient(srv.URL).WithClock(clock).WithBackoff(feeder.NopBackoff).WithMaxRetries(1).
+			Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, []time.Duration{0, 0}, clock.waits)
+	})
+
+	t.Run("context is respected", func(t *testing.T) {
+		before := calls.Load()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		t.Cleanup(cancel)
+
+		_, err := feeder.NewClient(srv.URL).WithArtificialLatency(time.Hour).Block(ctx, "1")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, before, calls.Load())
+	})
+}
+
+func TestRateLimitInfo(t *testing.T) {
+	var headers atomic.Pointer[map[string]string]
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if h := headers.Load(); h != nil {
+			for k, v := range *h {
+				w.Header().Set(k, v)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"block_number": 1}`))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	now := time.Unix(1700000000, 0)
+	var observed []feeder.RateLimitInfo
+	client := feeder.NewClient(srv.URL).WithClock(&fakeClock{now: now}).
+		WithRateLimitObserver(func(info feeder.RateLimitInfo) {
+			observed = append(observed, info)
+		})
+
+	assert.Equal(t, feeder.RateLimitInfo{}, client.LastRateLimit())
+
+	headers.Store(&map[string]string{"X-RateLimit-Remaining": "10", "X-RateLimit-Reset": "30"})
+	_, err := client.Block(context.Background(), "1")
+	require.NoError(t, err)
+	want := feeder.RateLimitInfo{Remaining: 10, HasRemaining: true, Reset: now.Add(30 * time.Second)}
+	assert.Equal(t, want, client.LastRateLimit())
+	assert.Equal(t, []feeder.RateLimitInfo{want}, observed)
+
+	t.Run("responses without headers keep the last rate limit", func(t *testing.T) {
+		headers.Store(nil)
+		_, err := client.Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, want, client.LastRateLimit())
+		assert.Len(t, observed, 1)
+	})
+
+	t.Run("reset as a Unix timestamp", func(t *testing.T) {
+		headers.Store(&map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1700000100"})
+		_, err := client.Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, feeder.RateLimitInfo{HasRemaining: true, Reset: time.Unix(1700000100, 0)}, client.LastRateLimit())
+	})
+
+	t.Run("malformed headers are unknown", func(t *testing.T) {
+		headers.Store(&map[string]string{"X-RateLimit-Remaining": "lots", "X-RateLimit-Reset": "60"})
+		_, err := client.Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, feeder.RateLimitInfo{Reset: now.Add(time.Minute)}, client.LastRateLimit())
+	})
+}
+
+type countingBody struct {
+	io.ReadCloser
+	read   int
+	closed bool
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += n
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	b.closed = true
+	return b.ReadCloser.Close()
+}
+
+func TestBodyWrapper(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	var endpoints []string
+	var bodies []*countingBody
+	// a single request slot is only freed again if the wrapper closes the underlying body
+	client.WithMaxConcurrency(1).WithBodyWrapper(func(endpoint string, r io.ReadCloser) io.ReadCloser {
+		endpoints = append(endpoints, endpoint)
+		body := &countingBody{ReadCloser: r}
+		bodies = append(bodies, body)
+		return body
+	})
+
+	_, raw, err := client.BlockRaw(context.Background(), "0")
+	require.NoError(t, err)
+	_, err = client.StateUpdate(context.Background(), "0")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"get_block", "get_state_update"}, endpoints)
+	require.Len(t, bodies, 2)
+	assert.Equal(t, len(raw), bodies[0].read)
+	for _, body := range bodies {
+		assert.True(t, body.closed)
+	}
+}
+
+func TestSuccessStatusCodes(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, err := w.Write([]byte(`{"block_number": 1}`))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	t.Run("202 is accepted when configured", func(t *testing.T) {
+		calls.Store(0)
+		block, err := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(2).
+			WithSuccessStatusCodes(http.StatusOK, http.StatusAccepted).
+			Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), block.Number)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("only 200 is accepted by default", func(t *testing.T) {
+		calls.Store(0)
+		_, err := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(2).
+			Block(context.Background(), "1")
+		require.EqualError(t, err, "202 Accepted")
+		assert.Equal(t, int32(3), calls.Load())
+	})
+}
+
+type tagLogger struct {
+	utils.SimpleLogger
+	mu   sync.Mutex
+	tags []string
+}
+
+func (l *tagLogger) Warnw(msg string, keysAndValues ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	tag := ""
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		if keysAndValues[i] == "tag" {
+			tag = keysAndValues[i+1].(string)
+		}
+	}
+	l.tags = append(l.tags, msg+": "+tag)
+}
+
+func TestContextWithTag(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1)%2 == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"block_number": 1}`))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	assert.Empty(t, feeder.TagFromContext(context.Background()))
+	ctx := feeder.ContextWithTag(context.Background(), "sync block 1")
+	assert.Equal(t, "sync block 1", feeder.TagFromContext(ctx))
+
+	log := &tagLogger{SimpleLogger: utils.NewNopZapLogger()}
+	client := feeder.NewClient(srv.URL).WithLogger(log).WithBackoff(feeder.NopBackoff).WithMaxRetries(1)
+
+	_, err := client.Block(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"failed query to feeder, retrying...: sync block 1"}, log.tags)
+
+	t.Run("untagged queries", func(t *testing.T) {
+		log.tags = nil
+		_, err := client.Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"failed query to feeder, retrying...: "}, log.tags)
+	})
+
+	t.Run("coalesced queries keep the tag", func(t *testing.T) {
+		log.tags = nil
+		_, err := client.WithCoalescing().Block(ctx, "1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"failed query to feeder, retrying...: sync block 1"}, log.tags)
+	})
+
+	t.Run("timings hook gets the tag", func(t *testing.T) {
+		var tags []string
+		client.WithTimingsHook(func(_, tag string, _, _ time.Duration) {
+			tags = append(tags, tag)
+		})
+
+		_, err := client.Block(ctx, "1")
+		require.NoError(t, err)
+		_, err = client.Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"sync block 1", ""}, tags)
+	})
+
+	t.Run("failover and circuit breaker warnings carry the tag", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		t.Cleanup(failing.Close)
+
+		log := &tagLogger{SimpleLogger: utils.NewNopZapLogger()}
+		client := feeder.NewClient(failing.URL).WithLogger(log).WithBackoff(feeder.NopBackoff).WithMaxRetries(0).
+			WithCircuitBreaker(1, time.Hour).
+			WithFallbackURLs(srv.URL)
+
+		calls.Store(1)
+		_, err := client.Block(ctx, "1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"failed query to feeder, retrying...: sync block 1",
+			"Feeder circuit breaker opened: sync block 1",
+			"Feeder failed, failing over: sync block 1",
+		}, log.tags)
+	})
+}
+
+func TestHTTP2(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	var protos sync.Map
+	unblock := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protos.Store(r.Proto, struct{}{})
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			peak := maxInFlight.Load()
+			if current <= peak || maxInFlight.CompareAndSwap(peak, current) {
+				break
+			}
+		}
+
+		<-unblock
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"block_number": 1}`))
+		require.NoError(t, err)
+	})
+
+	srv := httptest.NewUnstartedServer(handler)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	// a custom TLS config disables HTTP/2 unless it is asked for
+	tlsConfig := srv.Client().Transport.(*http.Transport).TLSClientConfig
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	client := feeder.NewClient(srv.URL).WithMaxRetries(0).WithHTTPClient(httpClient).WithHTTP2(2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Block(context.Background(), "1")
+			assert.NoError(t, err)
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		return inFlight.Load() == 2
+	}, time.Second, 10*time.Millisecond)
+	close(unblock)
+	wg.Wait()
+	assert.Equal(t, int32(2), maxInFlight.Load())
+
+	protos.Range(func(proto, _ any) bool {
+		assert.Equal(t, "HTTP/2.0", proto)
+		return true
+	})
+
+	t.Run("HTTP/1.1 fallback", func(t *testing.T) {
+		http1 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "HTTP/1.1", r.Proto)
+			w.Header().Set("Content-Type", "application/json")
+			_, err := w.Write([]byte(`{"block_number": 1}`))
+			require.NoError(t, err)
+		}))
+		t.Cleanup(http1.Close)
+
+		tlsConfig := http1.Client().Transport.(*http.Transport).TLSClientConfig
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		client := feeder.NewClient(http1.URL).WithMaxRetries(0).WithHTTPClient(httpClient).WithHTTP2(2)
+
+		block, err := client.Block(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), block.Number)
+	})
+
+	t.Run("invalid limit", func(t *testing.T) {
+		assert.Panics(t, func() {
+			feeder.NewClient(srv.URL).WithHTTP2(0)
+		})
+	})
+}
+
+func TestMemoryCache(t *testing.T) {
+	cache := feeder.NewMemoryCache(2)
+	cache.Put("a", []byte("1"))
+	cache.Put("b", []byte("2"))
+
+	// reading a makes b the least recently used entry
+	body, found := cache.Get("a")
+	require.True(t, found)
+	assert.Equal(t, []byte("1"), body)
+
+	cache.Put("c", []byte("3"))
+	_, found = cache.Get("b")
+	assert.False(t, found)
+	for key, want := range map[string]string{"a": "1", "c": "3"} {
+		body, found = cache.Get(key)
+		require.True(t, found)
+		assert.Equal(t, []byte(want), body)
+	}
+
+	t.Run("overwrite does not evict", func(t *testing.T) {
+		cache.Put("a", []byte("4"))
+		for key, want := range map[string]string{"a": "4", "c": "3"} {
+			body, found := cache.Get(key)
+			require.True(t, found)
+			assert.Equal(t, []byte(want), body)
+		}
+	})
+
+	t.Run("unbounded", func(t *testing.T) {
+		unbounded := feeder.NewMemoryCache(0)
+		for i := 0; i < 10; i++ {
+			unbounded.Put(strconv.Itoa(i), nil)
+		}
+		for i := 0; i < 10; i++ {
+			_, found := unbounded.Get(strconv.Itoa(i))
+			assert.True(t, found)
+		}
+	})
+}
+
+func TestStaleOnError(t *testing.T) {
+	cache := feeder.NewMemoryCache(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the block is cached by someone else while the gateway fails
+		blockNumber := r.URL.Query().Get("blockNumber")
+		if strings.HasSuffix(r.URL.Path, "get_block") {
+			cache.Put("get_block?blockNumber="+blockNumber, []byte(`{"block_number": 1}`))
+		}
+
+		if blockNumber == "2" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, err := w.Write([]byte(`{"code": "StarknetErrorCode.BLOCK_NOT_FOUND"}`))
+			require.NoError(t, err)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+
+	newClient := func() *feeder.Client {
+		return feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(0).WithCache(cache)
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		block, err := newClient().Block(context.Background(), "3")
+		require.EqualError(t, err, "503 Service Unavailable")
+		assert.Nil(t, block)
+	})
+
+	client := newClient().WithStaleOnError()
+
+	block, err := client.Block(context.Background(), "1")
+	var staleErr *feeder.StaleError
+	require.ErrorAs(t, err, &staleErr)
+	assert.EqualError(t, staleErr.Err, "503 Service Unavailable")
+	require.NotNil(t, block)
+	assert.Equal(t, uint64(1), block.Number)
+
+	t.Run("not cached", func(t *testing.T) {
+		update, err := client.StateUpdate(context.Background(), "1")
+		require.EqualError(t, err, "503 Service Unavailable")
+		assert.Nil(t, update)
+	})
+
+	t.Run("latest is never stale", func(t *testing.T) {
+		_, err := client.Block(context.Background(), "latest")
+		require.EqualError(t, err, "503 Service Unavailable")
+	})
+
+	t.Run("block not found", func(t *testing.T) {
+		_, err := client.Block(context.Background(), "2")
+		require.ErrorIs(t, err, feeder.ErrBlockNotFound)
+	})
+
+	t.Run("without a cache", func(t *testing.T) {
+		uncached := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(0).WithStaleOnError()
+		_, err := uncached.Block(context.Background(), "1")
+		require.EqualError(t, err, "503 Service Unavailable")
+	})
+}
+
+func TestRaw(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, "/get_new_thing", r.URL.Path)
+		assert.Equal(t, "0x1", r.URL.Query().Get("id"))
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"id": "0x1", "unknown_field": [1, 2]}`))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(1)
+
+	raw, err := client.Raw(context.Background(), "get_new_thing", map[string]string{"id": "0x1"})
+	require.NoError(t, err)
+	assert.Equal(t, `{"id": "0x1", "unknown_field": [1, 2]}`, string(raw))
+	assert.Equal(t, int32(2), calls.Load())
+
+	t.Run("response size limit", func(t *testing.T) {
+		client.WithMaxResponseBytesFor("get_new_thing", 8)
+		_, err := client.Raw(context.Background(), "get_new_thing", map[string]string{"id": "0x1"})
+		var tooLarge *feeder.ResponseTooLargeError
+		require.ErrorAs(t, err, &tooLarge)
+		assert.Equal(t, "get_new_thing", tooLarge.Endpoint)
+	})
+}
+
+func TestWeightedGateways(t *testing.T) {
+	var mu sync.Mutex
+	var hits []string
+	newGateway := func(name string, status int) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			mu.Lock()
+			hits = append(hits, name)
+			mu.Unlock()
+
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, err := w.Write([]byte(`{"block_number": 1}`))
+			require.NoError(t, err)
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	light := newGateway("light", http.StatusOK)
+	heavy := newGateway("heavy", http.StatusOK)
+
+	newClient := func(seed int64, gateways ...feeder.GatewayWeight) *feeder.Client {
+		return feeder.NewClient(light.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(0).
+			WithWeightedGateways(gateways).WithGatewaySeed(seed)
+	}
+	query := func(client *feeder.Client, n int) []string {
+		mu.Lock()
+		hits = nil
+		mu.Unlock()
+		for i := 0; i < n; i++ {
+			_, err := client.Block(context.Background(), "latest")
+			require.NoError(t, err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return hits
+	}
+
+	gateways := []feeder.GatewayWeight{{URL: light.URL, Weight: 1}, {URL: heavy.URL, Weight: 3}}
+	got := query(newClient(42, gateways...), 400)
+	counts := make(map[string]int)
+	for _, name := range got {
+		counts[name]++
+	}
+	assert.InDelta(t, 100, counts["light"], 40)
+	assert.InDelta(t, 300, counts["heavy"], 40)
+
+	t.Run("seeded selection is deterministic", func(t *testing.T) {
+		assert.Equal(t, got[:50], query(newClient(42, gateways...), 50))
+	})
+
+	t.Run("failing gateway", func(t *testing.T) {
+		failing := newGateway("failing", http.StatusInternalServerError)
+		client := newClient(7, feeder.GatewayWeight{URL: light.URL, Weight: 1},
+			feeder.GatewayWeight{URL: failing.URL, Weight: 100}).WithCircuitBreaker(1, time.Hour)
+
+		got := query(client, 20)
+		failed := 0
+		for _, name := range got {
+			if name == "failing" {
+				failed++
+			}
+		}
+		// once its breaker opens, the failing gateway is left out
+		assert.Equal(t, 1, failed)
+		assert.Len(t, got, 21)
+	})
+
+	t.Run("invalid weights", func(t *testing.T) {
+		assert.Panics(t, func() {
+			feeder.NewClient(light.URL).WithWeightedGateways([]feeder.GatewayWeight{{URL: light.URL}})
+		})
+		assert.Panics(t, func() {
+			feeder.NewClient(light.URL).WithWeightedGateways(nil)
+		})
+	})
+}
+
+func TestFeltResponses(t *testing.T) {
+	var body atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "0xabc", r.URL.Query().Get("contractAddress"))
+		assert.Equal(t, "latest", r.URL.Query().Get("blockNumber"))
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(body.Load().(string)))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := feeder.NewClient(srv.URL).WithBackoff(feeder.NopBackoff).WithMaxRetries(0)
+	addr := utils.HexToFelt(t, "0xabc")
+
+	body.Store(`"0x1a"`)
+	value, err := client.StorageAt(context.Background(), addr, utils.HexToFelt(t, "0x5"), "latest")
+	require.NoError(t, err)
+	assert.Equal(t, utils.HexToFelt(t, "0x1a"), value)
+
+	value, err = client.Nonce(context.Background(), addr, "latest")
+	require.NoError(t, err)
+	assert.Equal(t, utils.HexToFelt(t, "0x1a"), value)
+
+	value, err = client.ClassHashAt(context.Background(), addr, "latest")
+	require.NoError(t, err)
+	assert.Equal(t, utils.HexToFelt(t, "0x1a"), value)
+
+	for desc, invalid := range map[string]string{
+		"field prime":     `"0x800000000000011000000000000000000000000000000000000000000000001"`,
+		"too many digits": `"0x` + strings.Repeat("0", 64) + `1"`,
+		"no 0x prefix":    `"1a"`,
+		"not hex":         `"0xzz"`,
+		"no digits":       `"0x"`,
+		"not a string":    `26`,
+		"not json":        `0x1a`,
+	} {
+		invalid := invalid
+		t.Run(desc, func(t *testing.T) {
+			body.Store(invalid)
+			_, err := client.Nonce(context.Background(), addr, "latest")
+			require.ErrorIs(t, err, feeder.ErrInvalidFelt)
+			assert.Contains(t, err.Error(), "get_nonce")
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package feeder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// ErrInvalidFelt is returned when the feeder responds with something other than a field element to
+// a query that returns one
+var ErrInvalidFelt = errors.New("invalid felt in feeder response")
+
+// StorageAt fetches the value of the storage location at key of the contract at the given address,
+// as of the given block
+func (c *Client) StorageAt(ctx context.Context, addr, key *felt.Felt, blockID string) (*felt.Felt, error) {
+	return c.getFelt(ctx, "get_storage_at", map[string]string{
+		"contractAddress": addr.String(),
+		"key":             key.String(),
+		"blockNumber":     blockID,
+	})
+}
+
+// Nonce fetches the nonce of the contract at the given address, as of the given block
+func (c *Client) Nonce(ctx context.Context, addr *felt.Felt, blockID string) (*felt.Felt, error) {
+	return c.getFelt(ctx, "get_nonce", map[string]string{
+		"contractAddress": addr.String(),
+		"blockNumber":     blockID,
+	})
+}
+
+// ClassHashAt fetches the hash of the class of the contract at the given address, as of the given block
+func (c *Client) ClassHashAt(ctx context.Context, addr *felt.Felt, blockID string) (*felt.Felt, error) {
+	return c.getFelt(ctx, "get_class_hash_at", map[string]string{
+		"contractAddress": addr.String(),
+		"blockNumber":     blockID,
+	})
+}
+
+// getFelt queries an endpoint that responds with a single field element
+func (c *Client) getFelt(ctx context.Context, endpoint string, args map[string]string) (*felt.Felt, error) {
+	raw, _, err := c.getBody(ctx, endpoint, args, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := parseFeltResponse(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", endpoint, err)
+	}
+	return value, nil
+}
+
+// parseFeltResponse decodes a response that holds a single field element, given as a JSON string of
+// 0x-prefixed hex digits. Values that don't fit in the Stark field are rejected, so that they are
+// caught here rather than in later hashing. The errors wrap [ErrInvalidFelt].
+func parseFeltResponse(body io.Reader) (*felt.Felt, error) {
+	var value string
+	if err := json.NewDecoder(body).Decode(&value); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFelt, err)
+	}
+
+	digits, found := strings.CutPrefix(value, "0x")
+	if !found || digits == "" {
+		return nil, fmt.Errorf("%w: %q is not 0x-prefixed hex", ErrInvalidFelt, value)
+	}
+	if len(digits) > 2*felt.Bytes {
+		return nil, fmt.Errorf("%w: %q has more than %d hex digits", ErrInvalidFelt, value, 2*felt.Bytes)
+	}
+	for _, digit := range digits {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", digit) {
+			return nil, fmt.Errorf("%w: %q is not 0x-prefixed hex", ErrInvalidFelt, value)
+		}
+	}
+
+	f, err := new(felt.Felt).SetString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q is not in the Stark field: %v", ErrInvalidFelt, value, err)
+	}
+	return f, nil
+}
@@ -0,0 +1,135 @@
+package feeder
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var ErrStreamingUnsupported = errors.New("feeder does not support head streaming")
+
+// SubscribeHead connects to the feeder's server-sent events head stream and emits the headers of
+// new blocks as they arrive. If the stream disconnects, the client reconnects using its backoff
+// settings. The returned channel is closed when ctx is done or the feeder stops supporting the stream.
+//
+// [ErrStreamingUnsupported] is returned if the feeder does not expose a head stream, in which case
+// callers should fall back to polling.
+func (c *Client) SubscribeHead(ctx context.Context) (<-chan *BlockHeader, error) {
+	body, err := c.connectHeadStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	heads := make(chan *BlockHeader)
+	go func() {
+		defer close(heads)
+
+		wait := time.Duration(0)
+		for {
+			if body != nil {
+				if c.readHeadStream(ctx, body, heads) {
+					wait = 0
+				}
+				body.Close()
+			}
+
+			if wait < c.minWait {
+				wait = c.minWait
+			}
+			wait = c.backoff(wait)
+			if wait > c.maxWait {
+				wait = c.maxWait
+			}
+			c.log.Warnw("head stream disconnected, reconnecting...", withTag(ctx, []any{"retryAfter", wait.String()})...)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.clock.After(wait):
+			}
+
+			body, err = c.connectHeadStream(ctx)
+			if errors.Is(err, ErrStreamingUnsupported) {
+				c.log.Warnw("Feeder no longer supports head streaming", withTag(ctx, nil)...)
+				return
+			} else if errors.Is(err, ErrClientClosed) {
+				return
+			} else if err != nil {
+				body = nil
+			}
+		}
+	}()
+	return heads, nil
+}
+
+func (c *Client) connectHeadStream(ctx context.Context) (io.ReadCloser, error) {
+	queryURL, err := c.BuildURL("head_stream", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, queryURL)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case res.StatusCode == http.StatusNotFound, res.StatusCode == http.StatusMethodNotAllowed,
+		res.StatusCode == http.StatusNotImplemented:
+		err = ErrStreamingUnsupported
+	case res.StatusCode != http.StatusOK:
+		err = errors.New(res.Status)
+	case !strings.HasPrefix(res.Header.Get("Content-Type"), "text/event-stream"):
+		err = ErrStreamingUnsupported
+	default:
+		return res.Body, nil
+	}
+
+	res.Body.Close()
+	return nil, err
+}
+
+// readHeadStream emits the headers read from the stream until it ends. It reports whether any
+// header was received.
+func (c *Client) readHeadStream(ctx context.Context, body io.Reader, heads chan<- *BlockHeader) bool {
+	received := false
+	var data strings.Builder
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if after, found := strings.CutPrefix(line, "data:"); found {
+			data.WriteString(strings.TrimPrefix(after, " "))
+			continue
+		} else if line != "" || data.Len() == 0 {
+			// ignore other fields and comments until the event is dispatched
+			continue
+		}
+
+		header := new(BlockHeader)
+		err := c.decoder(strings.NewReader(data.String()), header)
+		data.Reset()
+		if err != nil {
+			c.log.Warnw("Failed to decode head stream event", withTag(ctx, []any{"err", err})...)
+			continue
+		}
+
+		select {
+		case heads <- header:
+			received = true
+		case <-ctx.Done():
+			return received
+		}
+	}
+	return received
+}
@@ -0,0 +1,130 @@
+package feeder
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// HostHealth is the health of a feeder URL as seen by the queries sent to it
+type HostHealth struct {
+	URL                 string
+	Active              bool
+	ConsecutiveFailures int
+	LastSuccess         time.Time
+	LastFailure         time.Time
+}
+
+// hostHealth tracks the results of the queries sent to a feeder URL
+type hostHealth struct {
+	mu                  sync.Mutex
+	consecutiveFailures int
+	lastSuccess         time.Time
+	lastFailure         time.Time
+}
+
+func (h *hostHealth) record(err error, now time.Time) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrCircuitOpen) {
+		// the host was not necessarily at fault, or not queried at all
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil || errors.Is(err, ErrBlockNotFound) {
+		h.consecutiveFailures = 0
+		h.lastSuccess = now
+	} else {
+		h.consecutiveFailures++
+		h.lastFailure = now
+	}
+}
+
+// healthierThan reports whether h should be preferred over other
+func (h *hostHealth) healthierThan(other *hostHealth) bool {
+	h.mu.Lock()
+	failures, lastSuccess := h.consecutiveFailures, h.lastSuccess
+	h.mu.Unlock()
+
+	other.mu.Lock()
+	defer other.mu.Unlock()
+	if failures != other.consecutiveFailures {
+		return failures < other.consecutiveFailures
+	}
+	return lastSuccess.After(other.lastSuccess)
+}
+
+// resetHealth starts tracking the health of every feeder URL from scratch
+func (c *Client) resetHealth() {
+	c.health = make(map[string]*hostHealth, len(c.urls))
+	for _, baseURL := range c.urls {
+		c.health[baseURL] = new(hostHealth)
+	}
+}
+
+// recordHealth updates the health of the feeder URL at the given index with the result of a query
+func (c *Client) recordHealth(index int32, err error) {
+	if h := c.health[c.urls[index]]; h != nil {
+		h.record(err, c.clock.Now())
+	}
+}
+
+// HostStatus returns the health of every feeder URL, primary URL first, for monitoring
+func (c *Client) HostStatus() []HostHealth {
+	active := c.ActiveURL()
+	status := make([]HostHealth, 0, len(c.urls))
+	seen := make(map[string]struct{}, len(c.urls))
+	for _, baseURL := range c.urls {
+		if _, found := seen[baseURL]; found {
+			continue
+		}
+		seen[baseURL] = struct{}{}
+
+		hostStatus := HostHealth{URL: baseURL, Active: baseURL == active}
+		if h := c.health[baseURL]; h != nil {
+			h.mu.Lock()
+			hostStatus.ConsecutiveFailures = h.consecutiveFailures
+			hostStatus.LastSuccess = h.lastSuccess
+			hostStatus.LastFailure = h.lastFailure
+			h.mu.Unlock()
+		}
+		status = append(status, hostStatus)
+	}
+	return status
+}
+
+// healthiest returns the index of the healthiest feeder URL that is not skipped, preferring earlier
+// URLs among equally healthy ones. -1 is returned if every URL is skipped.
+func (c *Client) healthiest(skip func(index int32) bool) int32 {
+	best := int32(-1)
+	for i := range c.urls {
+		index := int32(i)
+		if skip(index) {
+			continue
+		}
+		if best == -1 || c.health[c.urls[index]].healthierThan(c.health[c.urls[best]]) {
+			best = index
+		}
+	}
+	return best
+}
+
+// WithFailbackInterval makes the client re-probe the primary feeder URL while a fallback URL is
+// active. At most once per interval, a query is sent to the primary URL first and, if it succeeds,
+// the primary URL becomes active again. If it fails, the query continues with the active URL.
+func (c *Client) WithFailbackInterval(interval time.Duration) *Client {
+	c.failbackInterval = interval
+	return c
+}
+
+// failbackDue reports whether the current query should probe the primary feeder URL
+func (c *Client) failbackDue() bool {
+	if c.failbackInterval == 0 {
+		return false
+	}
+
+	now := c.clock.Now().UnixNano()
+	last := c.lastFailback.Load()
+	return now-last >= int64(c.failbackInterval) && c.lastFailback.CompareAndSwap(last, now)
+}
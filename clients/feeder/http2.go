@@ -0,0 +1,55 @@
+package feeder
+
+import (
+	"net/http"
+	"sync"
+)
+
+// WithHTTP2 makes the client negotiate HTTP/2 with the feeder, so that concurrent requests are
+// multiplexed over one connection per host instead of each taking a connection of their own, and
+// limits the number of requests in flight to maxConcurrentStreams. Servers that don't negotiate h2
+// are queried over HTTP/1.1 as usual, the limit then bounds the number of connections in use. HTTP/2
+// is only negotiated over TLS, so plain http feeder URLs always use HTTP/1.1. The setting takes
+// precedence over the transport of a client set with [Client.WithHTTPClient].
+//
+// A request takes its stream after the slot of [Client.WithMaxConcurrency], so with both set the
+// smaller limit applies, and holds it until its response body is closed. Head streams hold a stream
+// for as long as they are subscribed.
+func (c *Client) WithHTTP2(maxConcurrentStreams int) *Client {
+	if maxConcurrentStreams <= 0 {
+		panic("max concurrent streams must be positive")
+	}
+	c.http2Streams = maxConcurrentStreams
+	c.applyTransportSettings()
+	return c
+}
+
+// streamLimiter bounds the number of requests in flight through next. A request holds its slot until
+// its response body is closed.
+type streamLimiter struct {
+	next    *http.Transport
+	streams *semaphore
+}
+
+func (l *streamLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := l.streams.acquire(req.Context()); err != nil {
+		return nil, err
+	}
+
+	res, err := l.next.RoundTrip(req)
+	if err != nil {
+		l.streams.release()
+		return nil, err
+	}
+
+	var once sync.Once
+	res.Body = &releasingBody{ReadCloser: res.Body, release: func() {
+		once.Do(l.streams.release)
+	}}
+	return res, nil
+}
+
+// CloseIdleConnections closes the idle connections of the underlying transport, see [Client.Close]
+func (l *streamLimiter) CloseIdleConnections() {
+	l.next.CloseIdleConnections()
+}
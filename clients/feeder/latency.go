@@ -0,0 +1,35 @@
+package feeder
+
+import (
+	"sync"
+	"time"
+)
+
+// latencyWeight is the weight of the latest sample in the moving average
+const latencyWeight = 0.2
+
+// latencyTracker keeps an exponentially weighted moving average of the latency of successful queries.
+type latencyTracker struct {
+	mu      sync.Mutex
+	average time.Duration
+	sampled bool
+}
+
+func (lt *latencyTracker) observe(latency time.Duration) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if !lt.sampled {
+		lt.average = latency
+		lt.sampled = true
+		return
+	}
+	lt.average = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(lt.average))
+}
+
+// averageLatency returns the moving average, the second return value is false if nothing was observed yet.
+func (lt *latencyTracker) averageLatency() (time.Duration, bool) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	return lt.average, lt.sampled
+}
@@ -0,0 +1,43 @@
+package feeder
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+var ErrClientClosed = errors.New("feeder client is closed")
+
+// goBackground runs fn in a goroutine that [Client.Close] stops by cancelling ctx and waits for. fn
+// doesn't run if the client is closed.
+func (c *Client) goBackground(fn func(ctx context.Context)) {
+	c.closeMu.Lock()
+	defer c.closeMu.Unlock()
+	if c.closed.Load() {
+		return
+	}
+
+	c.background.Add(1)
+	go func() {
+		defer c.background.Done()
+		fn(c.backgroundCtx)
+	}()
+}
+
+// Close stops the work the client does in background, e.g. the connection warmer, waits for it to
+// finish and closes the idle connections of the transport, unless it is [http.DefaultTransport],
+// which is shared with the rest of the process. Queries made afterwards fail with [ErrClientClosed],
+// and so do the retries of queries that are in flight. Head stream subscriptions end instead of
+// reconnecting. It is safe to call Close more than once and concurrently with queries.
+func (c *Client) Close() error {
+	c.closeMu.Lock()
+	c.closed.Store(true)
+	c.closeMu.Unlock()
+
+	c.stopBackground()
+	c.background.Wait()
+	if transport := c.client.Transport; transport != nil && transport != http.DefaultTransport {
+		c.client.CloseIdleConnections()
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package feeder
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimitInfo is the request budget reported by the feeder in the X-RateLimit-Remaining and
+// X-RateLimit-Reset headers of a response. Values of missing or malformed headers are left unknown.
+type RateLimitInfo struct {
+	// Remaining is the number of requests left in the current window, if HasRemaining is set
+	Remaining    int64
+	HasRemaining bool
+	// Reset is when the current window ends, zero if unknown
+	Reset time.Time
+}
+
+// RateLimitObserver is called with the rate limit reported by every response that has rate limit headers
+type RateLimitObserver func(info RateLimitInfo)
+
+// WithRateLimitObserver sets a function that is called with the rate limit reported by every feeder
+// response that has rate limit headers, e.g. to slow down before the budget runs out.
+func (c *Client) WithRateLimitObserver(observer RateLimitObserver) *Client {
+	c.rateLimitObserver = observer
+	return c
+}
+
+// LastRateLimit returns the rate limit reported by the last feeder response that had rate limit
+// headers. The zero value is returned if no response had them.
+func (c *Client) LastRateLimit() RateLimitInfo {
+	if info := c.lastRateLimit.Load(); info != nil {
+		return *info
+	}
+	return RateLimitInfo{}
+}
+
+// recordRateLimit remembers the rate limit reported by the response and passes it to the observer
+func (c *Client) recordRateLimit(res *http.Response) {
+	info, found := c.parseRateLimit(res.Header)
+	if !found {
+		return
+	}
+
+	c.lastRateLimit.Store(&info)
+	if c.rateLimitObserver != nil {
+		c.rateLimitObserver(info)
+	}
+}
+
+// maxResetDelay tells the two common formats of X-RateLimit-Reset apart: smaller values are
+// seconds until the reset, larger ones are Unix timestamps.
+const maxResetDelay = 365 * 24 * 60 * 60
+
+func (c *Client) parseRateLimit(header http.Header) (RateLimitInfo, bool) {
+	var info RateLimitInfo
+	found := false
+
+	if remaining, err := strconv.ParseInt(header.Get("X-RateLimit-Remaining"), 10, 64); err == nil && remaining >= 0 {
+		info.Remaining = remaining
+		info.HasRemaining = true
+		found = true
+	}
+
+	if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil && reset >= 0 {
+		if reset <= maxResetDelay {
+			info.Reset = c.clock.Now().Add(time.Duration(reset) * time.Second)
+		} else {
+			info.Reset = time.Unix(reset, 0)
+		}
+		found = true
+	}
+	return info, found
+}
@@ -0,0 +1,47 @@
+package feeder
+
+import (
+	"errors"
+	"fmt"
+)
+
+// StaleError is returned by [Client.Block] and [Client.StateUpdate] together with a response that
+// was served from the cache because the query failed, see [Client.WithStaleOnError]. Err is the error
+// of the failed query.
+type StaleError struct {
+	Err error
+}
+
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("serving cached response: %v", e.Err)
+}
+
+func (e *StaleError) Unwrap() error {
+	return e.Err
+}
+
+// WithStaleOnError makes [Client.Block] and [Client.StateUpdate] fall back to the cache set with
+// [Client.WithCache] when a query fails after all its retries, returning the cached value together
+// with a [StaleError] instead of failing. Cached responses are served before any query is sent, so
+// this only helps when the response was cached while the query was failing, e.g. by
+// [Client.PrefetchRange] or another client sharing the cache. Only cacheable queries fall back, and
+// never when the feeder reports [ErrBlockNotFound]. It has no effect without [Client.WithCache].
+func (c *Client) WithStaleOnError() *Client {
+	c.staleOnError = true
+	return c
+}
+
+// staleBody returns the cached response of a query that failed with err, or nil if there is none or
+// the client doesn't fall back to the cache
+func (c *Client) staleBody(endpoint string, args map[string]string, err error) []byte {
+	if !c.staleOnError || c.cache == nil || errors.Is(err, ErrBlockNotFound) || errors.Is(err, ErrClientClosed) {
+		return nil
+	}
+
+	key, cacheable := cacheKey(endpoint, args)
+	if !cacheable {
+		return nil
+	}
+	raw, _ := c.cache.Get(key)
+	return raw
+}
@@ -7,6 +7,8 @@ type StateUpdate struct {
 	BlockHash *felt.Felt `json:"block_hash"`
 	NewRoot   *felt.Felt `json:"new_root"`
 	OldRoot   *felt.Felt `json:"old_root"`
+	// Status of the block, only reported by some gateways
+	Status string `json:"status"`
 
 	StateDiff struct {
 		StorageDiffs map[string][]struct {
@@ -32,3 +34,8 @@ type StateUpdate struct {
 		} `json:"replaced_classes"`
 	} `json:"state_diff"`
 }
+
+// IsReverted reports whether the gateway marked the block of the state update as reverted
+func (s *StateUpdate) IsReverted() bool {
+	return isRevertedStatus(s.Status)
+}
@@ -0,0 +1,27 @@
+package feeder
+
+import "context"
+
+type tagKey struct{}
+
+// ContextWithTag returns a context that tags the feeder queries made with it, e.g. with the block
+// being synced or the RPC request being served. The tag is added to the messages logged about the
+// queries and passed to the [TimingsHook], so that the activity of one operation can be grouped
+// together.
+func ContextWithTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, tagKey{}, tag)
+}
+
+// TagFromContext returns the tag set with [ContextWithTag], or an empty string if there is none
+func TagFromContext(ctx context.Context) string {
+	tag, _ := ctx.Value(tagKey{}).(string)
+	return tag
+}
+
+// withTag appends the tag of ctx to the fields of a log message, if there is one
+func withTag(ctx context.Context, fields []any) []any {
+	if tag := TagFromContext(ctx); tag != "" {
+		fields = append(fields, "tag", tag)
+	}
+	return fields
+}
@@ -0,0 +1,55 @@
+package feeder
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WithConnectionWarmer makes the client send a HEAD request for the latest block to the active feeder
+// URL every interval, so that a connection to it stays open in the pool and the first query after an
+// idle period doesn't pay for a new connection. The warmer runs until [Client.Close] is called. Its
+// requests are not retried and don't count towards the health of the feeder URL.
+func (c *Client) WithConnectionWarmer(interval time.Duration) *Client {
+	c.goBackground(func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.clock.After(interval):
+			}
+
+			if err := c.warmConnection(ctx); err != nil && ctx.Err() == nil {
+				c.log.Debugw("Failed to warm feeder connection", "err", err)
+			}
+		}
+	})
+	return c
+}
+
+// warmConnection sends a HEAD request to the active feeder URL and discards the response
+func (c *Client) warmConnection(ctx context.Context) error {
+	queryURL, err := c.BuildURL("get_block", map[string]string{"blockNumber": "latest"})
+	if err != nil {
+		return err
+	}
+
+	req, err := c.newRequest(ctx, queryURL)
+	if err != nil {
+		return err
+	}
+	req.Method = http.MethodHead
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	// the connection only goes back to the pool once the body is read to the end and closed
+	_, err = io.Copy(io.Discard, res.Body)
+	if closeErr := res.Body.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package feeder
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// GatewayWeight is a feeder URL and its share of the queries, see [Client.WithWeightedGateways]
+type GatewayWeight struct {
+	URL    string
+	Weight int
+}
+
+// gatewaySelector picks the feeder URL of every query at random, proportionally to the URL weights
+type gatewaySelector struct {
+	weights []int
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// WithWeightedGateways spreads the queries over the given feeder URLs instead of sending them all to
+// the active one: every query picks a URL at random, with a probability proportional to its weight.
+// If the query fails on that URL, it is tried on the others, picked the same way, and every URL is
+// tried at most once. The URLs replace the ones set with [NewClient] and [Client.WithFallbackURLs],
+// the first one is reported by [Client.ActiveURL].
+//
+// With [Client.WithCircuitBreaker], every URL has its own breaker and URLs whose breaker is open are
+// left out of the selection until their cooldown passes. Use [Client.WithGatewaySeed] to make the
+// selection deterministic.
+func (c *Client) WithWeightedGateways(gateways []GatewayWeight) *Client {
+	if len(gateways) == 0 {
+		panic("no weighted gateways")
+	}
+
+	weights := make([]int, len(gateways))
+	c.urls = make([]string, len(gateways))
+	for i, gateway := range gateways {
+		if gateway.Weight <= 0 {
+			panic("gateway weights must be positive")
+		}
+		c.urls[i] = gateway.URL
+		weights[i] = gateway.Weight
+	}
+
+	c.active.Store(0)
+	c.resetHealth()
+	if c.breakers != nil {
+		c.resetBreakers()
+	}
+	c.gateways = &gatewaySelector{
+		weights: weights,
+		rng:     rand.New(rand.NewSource(time.Now().UnixNano())), //nolint:gosec
+	}
+	return c
+}
+
+// WithGatewaySeed seeds the selection of [Client.WithWeightedGateways], e.g. to make it deterministic
+// in tests. It must be called after [Client.WithWeightedGateways].
+func (c *Client) WithGatewaySeed(seed int64) *Client {
+	if c.gateways == nil {
+		panic("gateway seed requires weighted gateways")
+	}
+	c.gateways.rng = rand.New(rand.NewSource(seed)) //nolint:gosec
+	return c
+}
+
+// weightedTarget picks the index of the feeder URL that a query tries next, among the ones it has not
+// tried yet. URLs whose circuit breaker is open are only picked if there are no others.
+func (c *Client) weightedTarget(tried []bool) int32 {
+	now := c.clock.Now()
+	candidates := make([]int32, 0, len(c.urls))
+	for i := range c.urls {
+		index := int32(i)
+		if tried[index] {
+			continue
+		}
+		if breaker := c.breakers[c.urls[index]]; breaker != nil && breaker.rejecting(now) {
+			continue
+		}
+		candidates = append(candidates, index)
+	}
+	if len(candidates) == 0 {
+		// let the breakers fail the query fast
+		for i := range c.urls {
+			if !tried[i] {
+				candidates = append(candidates, int32(i))
+			}
+		}
+	}
+	return c.gateways.pick(candidates)
+}
+
+// pick returns one of the candidates at random, proportionally to their weights
+func (g *gatewaySelector) pick(candidates []int32) int32 {
+	total := 0
+	for _, index := range candidates {
+		total += g.weights[index]
+	}
+
+	g.mu.Lock()
+	n := g.rng.Intn(total)
+	g.mu.Unlock()
+
+	for _, index := range candidates {
+		if n < g.weights[index] {
+			return index
+		}
+		n -= g.weights[index]
+	}
+	return candidates[len(candidates)-1]
+}
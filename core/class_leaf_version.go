@@ -0,0 +1,83 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+)
+
+// ErrClassLeafVersionMismatch is returned when the classes trie of a state was built with a leaf
+// version other than the one the [State] is configured with.
+var ErrClassLeafVersionMismatch = errors.New("classes trie was built with a different leaf version")
+
+// WithClassLeafVersion makes the state compute the leaves of the classes trie with the given version
+// instead of the current Starknet one, e.g. to sync a network at a different protocol version.
+func WithClassLeafVersion(version *felt.Felt) StateOption {
+	return func(s *State) {
+		s.classLeafVersion = version
+	}
+}
+
+// ClassLeafVersion returns the version that the leaves of the classes trie are computed with, i.e.
+// Poseidon(version, compiledClassHash).
+func (s *State) ClassLeafVersion() *felt.Felt {
+	return new(felt.Felt).Set(s.classLeafVersion)
+}
+
+// VerifyClassLeafVersion returns [ErrClassLeafVersionMismatch] if the classes trie was built with a
+// leaf version other than [State.ClassLeafVersion], which would make every later classes root
+// wrong. States built before the version was stored use the default one.
+func (s *State) VerifyClassLeafVersion() error {
+	stored, err := s.storedClassLeafVersion()
+	if err != nil || stored == nil {
+		return err
+	}
+
+	if !stored.Equal(s.classLeafVersion) {
+		return fmt.Errorf("%w: state uses %s, configured %s", ErrClassLeafVersionMismatch, stored, s.classLeafVersion)
+	}
+	return nil
+}
+
+// storedClassLeafVersion returns the leaf version the classes trie was built with, or nil if it is empty
+func (s *State) storedClassLeafVersion() (*felt.Felt, error) {
+	var version *felt.Felt
+	err := s.txn.Get(db.ClassLeafVersion.Key(), func(val []byte) error {
+		version = new(felt.Felt).SetBytes(val)
+		return nil
+	})
+	if !errors.Is(err, db.ErrKeyNotFound) {
+		return version, err
+	}
+
+	rootKey, err := s.rootKey(db.ClassesTrie)
+	if err != nil || rootKey == nil {
+		return nil, err
+	}
+	// the classes trie predates the stored version
+	return leafVersion, nil
+}
+
+// InitClassLeafVersion checks that the classes trie uses the leaf version of the state, see
+// [State.VerifyClassLeafVersion], and stores the version if the state doesn't have one yet. It is
+// meant to be called when the database is opened, the version is stored once and never changes.
+func (s *State) InitClassLeafVersion() error {
+	if err := s.VerifyClassLeafVersion(); err != nil {
+		return err
+	}
+
+	err := s.txn.Get(db.ClassLeafVersion.Key(), func([]byte) error {
+		return nil
+	})
+	if !errors.Is(err, db.ErrKeyNotFound) {
+		return err
+	}
+	return s.txn.Set(db.ClassLeafVersion.Key(), s.classLeafVersion.Marshal())
+}
+
+// withTxn returns a state on txn that is configured like s, e.g. for overlays
+func (s *State) withTxn(txn db.Transaction) *State {
+	return NewState(txn, WithClassLeafVersion(s.classLeafVersion))
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+)
+
+var ErrUnknownClassesRoot = errors.New("classes root is not a past root of the classes trie")
+
+// ClassesTrieDiff returns the Cairo 1 classes that were added to the classes trie since it had the
+// given root, ordered by the block that declared them and then by class hash.
+//
+// Past roots of the classes trie are not retained, so they are recomputed: the stored classes are
+// added to an empty classes trie one declaring block at a time, on an in-memory overlay, until the
+// root matches sinceRoot. The classes declared after that block make up the diff. Compiled class
+// hashes are taken from the stored state updates, like in [State.RebuildClassesTrie]. A zero
+// sinceRoot stands for the empty trie. [ErrUnknownClassesRoot] is returned if no past root matches.
+func (s *State) ClassesTrieDiff(sinceRoot *felt.Felt) ([]DeclaredV1Class, error) {
+	classes, declaredAt, err := s.declaredV1Classes()
+	if err != nil {
+		return nil, err
+	}
+
+	if sinceRoot.IsZero() {
+		return classes, nil
+	}
+
+	overlayTxn := db.NewOverlayTransaction(s.txn)
+	diff, err := s.withTxn(overlayTxn).classesAddedSince(sinceRoot, classes, declaredAt)
+	return diff, db.CloseAndWrapOnError(overlayTxn.Discard, err)
+}
+
+// classesAddedSince replays the declarations of classes, which are ordered by their declaring blocks
+// in declaredAt, on an empty classes trie and returns the classes declared after the trie had the given root.
+func (s *State) classesAddedSince(sinceRoot *felt.Felt, classes []DeclaredV1Class, declaredAt []uint64) ([]DeclaredV1Class, error) {
+	if err := s.deleteWithPrefix(context.Background(), db.ClassesTrie.Key()); err != nil {
+		return nil, err
+	}
+
+	// the roots are only compared, the overlay is discarded afterwards
+	classesTrie, _, err := s.classesTrie()
+	if err != nil {
+		return nil, err
+	}
+
+	for start := 0; start < len(classes); {
+		// add all the classes of the next declaring block
+		end := start
+		for ; end < len(classes) && declaredAt[end] == declaredAt[start]; end++ {
+			leaf := s.classesTrieLeaf(classes[end].CompiledClassHash)
+			if _, err = classesTrie.Put(classes[end].ClassHash, leaf); err != nil {
+				return nil, err
+			}
+		}
+
+		root, rootErr := classesTrie.Root()
+		if rootErr != nil {
+			return nil, rootErr
+		}
+		if root.Equal(sinceRoot) {
+			return classes[end:], nil
+		}
+		start = end
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownClassesRoot, sinceRoot)
+}
+
+// declaredV1Classes returns all the stored Cairo 1 classes with their compiled class hashes and the
+// blocks that declared them, ordered by declaring block and then by class hash.
+func (s *State) declaredV1Classes() ([]DeclaredV1Class, []uint64, error) {
+	type declaration struct {
+		class DeclaredV1Class
+		at    uint64
+	}
+
+	var declarations []declaration
+	if err := s.scanClassDeclarations(db.ClassesByDeclarationHeight.Key(),
+		func(classHash, compiledClassHash *felt.Felt, at uint64) error {
+			if compiledClassHash != nil {
+				declarations = append(declarations, declaration{
+					class: DeclaredV1Class{ClassHash: classHash, CompiledClassHash: compiledClassHash},
+					at:    at,
+				})
+			}
+			return nil
+		}); err != nil {
+		return nil, nil, err
+	}
+
+	sort.Slice(declarations, func(i, j int) bool {
+		if declarations[i].at != declarations[j].at {
+			return declarations[i].at < declarations[j].at
+		}
+		return declarations[i].class.ClassHash.Cmp(declarations[j].class.ClassHash) < 0
+	})
+
+	classes := make([]DeclaredV1Class, len(declarations))
+	declaredAt := make([]uint64, len(declarations))
+	for i, d := range declarations {
+		classes[i], declaredAt[i] = d.class, d.at
+	}
+	return classes, declaredAt, nil
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sort"
+
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+)
+
+// RebuildClassesTrie rewrites the classes trie from scratch using the stored declared classes and
+// returns the resulting classes root. Cairo 0 classes are not part of the classes trie.
+//
+// The classes trie is left in an inconsistent state if an error is returned, so the transaction
+// should be discarded in that case.
+func (s *State) RebuildClassesTrie(ctx context.Context) (*felt.Felt, error) {
+	leaves, err := s.classesTrieLeaves(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.deleteWithPrefix(ctx, db.ClassesTrie.Key()); err != nil {
+		return nil, err
+	}
+
+	classesTrie, classesCloser, err := s.classesTrie()
+	if err != nil {
+		return nil, err
+	}
+
+	for classHash, leaf := range leaves {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		classHash := classHash
+		if _, err = classesTrie.Put(&classHash, leaf); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = classesCloser(); err != nil {
+		return nil, err
+	}
+	return classesTrie.Root()
+}
+
+// classesTrieLeaves computes the classes trie leaves of all the stored Cairo 1 classes
+func (s *State) classesTrieLeaves(ctx context.Context) (map[felt.Felt]*felt.Felt, error) {
+	leaves := make(map[felt.Felt]*felt.Felt)
+	err := s.ForEachDeclaredClass(func(classHash, compiledClassHash *felt.Felt, _ uint64) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		leaves[*classHash] = s.classesTrieLeaf(compiledClassHash)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return leaves, nil
+}
+
+// ClassesTrieLeaf returns the leaf of a Cairo 1 class in the classes trie, given its compiled class hash,
+// with the default leaf version, see [State.ClassLeafVersion].
+// See https://docs.starknet.io/documentation/starknet_versions/upcoming_versions/#commitment
+func ClassesTrieLeaf(compiledClassHash *felt.Felt) *felt.Felt {
+	return crypto.Poseidon(leafVersion, compiledClassHash)
+}
+
+// classesTrieLeaf is [ClassesTrieLeaf] with the leaf version of the state
+func (s *State) classesTrieLeaf(compiledClassHash *felt.Felt) *felt.Felt {
+	return crypto.Poseidon(s.classLeafVersion, compiledClassHash)
+}
+
+// ForEachDeclaredClass calls fn with the hash, the compiled class hash and the declaration height of
+// every stored Cairo 1 class, ordered by class hash, e.g. to recompute the classes root from the
+// leaves returned by [ClassesTrieLeaf]. Cairo 0 classes are not part of the classes trie and are
+// skipped. Iteration stops at the first error returned by fn, which is then returned.
+func (s *State) ForEachDeclaredClass(fn func(classHash, compiledClassHash *felt.Felt, at uint64) error) error {
+	type declaration struct {
+		classHash         *felt.Felt
+		compiledClassHash *felt.Felt
+		at                uint64
+	}
+
+	var declarations []declaration
+	if err := s.scanClassDeclarations(db.ClassesByDeclarationHeight.Key(),
+		func(classHash, compiledClassHash *felt.Felt, at uint64) error {
+			if compiledClassHash != nil {
+				declarations = append(declarations, declaration{classHash, compiledClassHash, at})
+			}
+			return nil
+		}); err != nil {
+		return err
+	}
+
+	sort.Slice(declarations, func(i, j int) bool {
+		return declarations[i].classHash.Cmp(declarations[j].classHash) < 0
+	})
+	for _, d := range declarations {
+		if err := fn(d.classHash, d.compiledClassHash, d.at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanClassDeclarations calls fn with every class declaration recorded under prefix, a prefix of
+// [db.ClassesByDeclarationHeight], ordered by declaration height and then by class hash. The compiled
+// class hash is nil for Cairo 0 classes. The class definitions are not read.
+func (s *State) scanClassDeclarations(prefix []byte, fn func(classHash, compiledClassHash *felt.Felt, at uint64) error) error {
+	it, err := s.txn.NewIterator()
+	if err != nil {
+		return err
+	}
+
+	bucketLen := len(db.ClassesByDeclarationHeight.Key())
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+
+		val, itErr := it.Value()
+		if itErr != nil {
+			return db.CloseAndWrapOnError(it.Close, itErr)
+		}
+
+		var compiledClassHash *felt.Felt
+		if len(val) > 0 {
+			compiledClassHash = new(felt.Felt).SetBytes(val)
+		}
+
+		at := binary.BigEndian.Uint64(key[bucketLen : bucketLen+8])
+		classHash := new(felt.Felt).SetBytes(key[bucketLen+8:])
+		if err = fn(classHash, compiledClassHash, at); err != nil {
+			return db.CloseAndWrapOnError(it.Close, err)
+		}
+	}
+	return it.Close()
+}
+
+// deleteWithPrefix deletes all the keys that start with the given prefix
+func (s *State) deleteWithPrefix(ctx context.Context, prefix []byte) error {
+	it, err := s.txn.NewIterator()
+	if err != nil {
+		return err
+	}
+
+	var keys [][]byte
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+		keys = append(keys, key)
+	}
+
+	if err = it.Close(); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		if err = s.txn.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+)
+
+var ErrCommitmentSnapshotMismatch = errors.New("state does not match the commitment snapshot")
+
+// CommitmentSnapshot sums up the state in a few values, so that a snapshot taken before a restart can
+// be compared to the state after it, see [State.VerifyCommitmentSnapshot].
+type CommitmentSnapshot struct {
+	StateRoot     *felt.Felt
+	StorageRoot   *felt.Felt
+	ClassesRoot   *felt.Felt
+	ContractCount uint64
+	ClassCount    uint64
+}
+
+// CommitmentSnapshot returns the roots of the state together with the number of deployed contracts
+// and declared classes. The counts walk over the keys of the contracts and classes, but no values
+// are read.
+func (s *State) CommitmentSnapshot() (*CommitmentSnapshot, error) {
+	storageRoot, classesRoot, stateRoot, err := s.Roots()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &CommitmentSnapshot{
+		StateRoot:   stateRoot,
+		StorageRoot: storageRoot,
+		ClassesRoot: classesRoot,
+	}
+	if snapshot.ContractCount, err = s.countKeys(db.ContractDeploymentHeight.Key()); err != nil {
+		return nil, err
+	}
+	if snapshot.ClassCount, err = s.countKeys(db.Class.Key()); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// VerifyCommitmentSnapshot checks that the state matches a snapshot taken earlier with
+// [State.CommitmentSnapshot]. The first value that differs is reported with [ErrCommitmentSnapshotMismatch].
+func (s *State) VerifyCommitmentSnapshot(prev *CommitmentSnapshot) error {
+	current, err := s.CommitmentSnapshot()
+	if err != nil {
+		return err
+	}
+
+	mismatch := func(field string, expected, actual any) error {
+		return fmt.Errorf("%w: %s is %v, expected %v", ErrCommitmentSnapshotMismatch, field, actual, expected)
+	}
+	switch {
+	case !current.StateRoot.Equal(prev.StateRoot):
+		return mismatch("state root", prev.StateRoot, current.StateRoot)
+	case !current.StorageRoot.Equal(prev.StorageRoot):
+		return mismatch("storage root", prev.StorageRoot, current.StorageRoot)
+	case !current.ClassesRoot.Equal(prev.ClassesRoot):
+		return mismatch("classes root", prev.ClassesRoot, current.ClassesRoot)
+	case current.ContractCount != prev.ContractCount:
+		return mismatch("contract count", prev.ContractCount, current.ContractCount)
+	case current.ClassCount != prev.ClassCount:
+		return mismatch("class count", prev.ClassCount, current.ClassCount)
+	}
+	return nil
+}
+
+// countKeys returns the number of keys that start with the given prefix
+func (s *State) countKeys(prefix []byte) (uint64, error) {
+	it, err := s.txn.NewIterator()
+	if err != nil {
+		return 0, err
+	}
+
+	var count uint64
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		if !bytes.HasPrefix(it.Key(), prefix) {
+			break
+		}
+		count++
+	}
+	return count, it.Close()
+}
@@ -101,6 +101,10 @@ type Contract struct {
 // Purge eliminates the contract instance, deleting all associated data from storage
 // assumes storage is cleared in revert process
 func (c *Contract) Purge() error {
+	if err := removeFromClassHashIndex(c.txn, c.Address); err != nil {
+		return err
+	}
+
 	addrBytes := c.Address.Marshal()
 	buckets := []db.Bucket{db.ContractNonce, db.ContractClassHash}
 
@@ -200,6 +204,21 @@ func (c *Contract) Storage(key *felt.Felt) (*felt.Felt, error) {
 	return cStorage.Get(key)
 }
 
+// StorageProof returns the proof of the value at the given key in the contract storage.
+func (c *Contract) StorageProof(key *felt.Felt) ([]trie.ProofNode, error) {
+	cStorage, err := storage(c.Address, c.txn)
+	if err != nil {
+		return nil, err
+	}
+	return cStorage.Prove(key)
+}
+
+// VerifyContractStorage checks the proof of a storage value against the given contract storage
+// root. A proof that the key does not exist is valid only if value is zero.
+func VerifyContractStorage(contractStorageRoot, key, value *felt.Felt, proof []trie.ProofNode) (bool, error) {
+	return trie.VerifyProofPedersen(contractStorageRoot, key, contractStorageTrieHeight, value, proof)
+}
+
 // ClassHash returns hash of the class that the contract at the given address instantiates.
 func classHash(addr *felt.Felt, txn db.Transaction) (*felt.Felt, error) {
 	key := db.ContractClassHash.Key(addr.Marshal())
@@ -215,8 +234,31 @@ func classHash(addr *felt.Felt, txn db.Transaction) (*felt.Felt, error) {
 }
 
 func setClassHash(txn db.Transaction, addr, classHash *felt.Felt) error {
+	if err := removeFromClassHashIndex(txn, addr); err != nil {
+		return err
+	}
+
 	classHashKey := db.ContractClassHash.Key(addr.Marshal())
-	return txn.Set(classHashKey, classHash.Marshal())
+	if err := txn.Set(classHashKey, classHash.Marshal()); err != nil {
+		return err
+	}
+	return txn.Set(classHashIndexKey(classHash, addr), []byte{})
+}
+
+// classHashIndexKey returns the key that marks the contract at addr as an instance of the class with the given hash
+func classHashIndexKey(classHash, addr *felt.Felt) []byte {
+	return db.ContractAddressesByClassHash.Key(classHash.Marshal(), addr.Marshal())
+}
+
+// removeFromClassHashIndex removes the contract at addr from the reverse index of its current class hash, if it has one
+func removeFromClassHashIndex(txn db.Transaction, addr *felt.Felt) error {
+	oldClassHash, err := classHash(addr, txn)
+	if errors.Is(err, db.ErrKeyNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return txn.Delete(classHashIndexKey(oldClassHash, addr))
 }
 
 // Replace replaces the class that the contract instantiates
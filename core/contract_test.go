@@ -210,6 +210,68 @@ func TestUpdateStorageAndStorage(t *testing.T) {
 	})
 }
 
+func TestVerifyContractStorage(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	t.Cleanup(func() {
+		require.NoError(t, testDB.Close())
+	})
+
+	txn := testDB.NewTransaction(true)
+	addr := new(felt.Felt).SetUint64(44)
+	classHash := new(felt.Felt).SetUint64(37)
+
+	contract, err := core.DeployContract(addr, classHash, txn)
+	require.NoError(t, err)
+
+	diff := []core.StorageDiff{
+		{Key: new(felt.Felt).SetUint64(1), Value: new(felt.Felt).SetUint64(11)},
+		{Key: new(felt.Felt).SetUint64(2), Value: new(felt.Felt).SetUint64(22)},
+		{Key: new(felt.Felt).SetUint64(1337), Value: new(felt.Felt).SetUint64(33)},
+	}
+	require.NoError(t, contract.UpdateStorage(diff, NoopOnValueChanged))
+
+	root, err := contract.Root()
+	require.NoError(t, err)
+
+	t.Run("existing keys", func(t *testing.T) {
+		for _, pair := range diff {
+			proof, err := contract.StorageProof(pair.Key)
+			require.NoError(t, err)
+
+			valid, err := core.VerifyContractStorage(root, pair.Key, pair.Value, proof)
+			require.NoError(t, err)
+			assert.True(t, valid)
+
+			valid, err = core.VerifyContractStorage(root, pair.Key, new(felt.Felt).SetUint64(44), proof)
+			require.NoError(t, err)
+			assert.False(t, valid)
+		}
+	})
+
+	t.Run("non-existing key", func(t *testing.T) {
+		key := new(felt.Felt).SetUint64(3)
+		proof, err := contract.StorageProof(key)
+		require.NoError(t, err)
+
+		valid, err := core.VerifyContractStorage(root, key, &felt.Zero, proof)
+		require.NoError(t, err)
+		assert.True(t, valid)
+
+		valid, err = core.VerifyContractStorage(root, key, new(felt.Felt).SetUint64(11), proof)
+		require.NoError(t, err)
+		assert.False(t, valid)
+	})
+
+	t.Run("wrong root", func(t *testing.T) {
+		proof, err := contract.StorageProof(diff[0].Key)
+		require.NoError(t, err)
+
+		valid, err := core.VerifyContractStorage(new(felt.Felt).SetUint64(1), diff[0].Key, diff[0].Value, proof)
+		require.NoError(t, err)
+		assert.False(t, valid)
+	})
+}
+
 func TestPurge(t *testing.T) {
 	testDB := pebble.NewMemTest()
 	t.Cleanup(func() {
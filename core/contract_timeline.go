@@ -0,0 +1,181 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+)
+
+type ContractChangeKind uint8
+
+const (
+	StorageChange ContractChangeKind = iota
+	NonceChange
+	ClassHashChange
+)
+
+// ContractChange is a single change to a contract. Key is the storage location for
+// storage changes and nil otherwise.
+type ContractChange struct {
+	BlockNumber uint64
+	Kind        ContractChangeKind
+	Key         *felt.Felt
+	OldValue    *felt.Felt
+	NewValue    *felt.Felt
+}
+
+// ContractTimeline holds the changes to a contract in chronological order.
+type ContractTimeline struct {
+	Address *felt.Felt
+	Changes []ContractChange
+}
+
+// ContractHistory returns all the changes to the contract at the given address that are recorded in the history.
+func (s *State) ContractHistory(addr *felt.Felt) (*ContractTimeline, error) {
+	return s.ContractHistoryInRange(addr, 0, math.MaxUint64)
+}
+
+// ContractHistoryInRange returns the changes to the contract at the given address that happened
+// between fromBlock and toBlock, both inclusive. Only the logs of the contract in the range, and the
+// first one after it for every storage location, are read.
+func (s *State) ContractHistoryInRange(addr *felt.Felt, fromBlock, toBlock uint64) (*ContractTimeline, error) {
+	contract, err := NewContract(addr, s.txn)
+	if err != nil {
+		return nil, err
+	}
+
+	timeline := &ContractTimeline{Address: addr}
+	appendChanges := func(kind ContractChangeKind, prefix []byte, headValue func(subKey []byte) (*felt.Felt, error)) error {
+		return s.logsInRange(prefix, fromBlock, toBlock, func(log historyLog, next []byte) error {
+			change := ContractChange{
+				BlockNumber: log.height,
+				Kind:        kind,
+				OldValue:    new(felt.Felt).SetBytes(log.oldValue),
+			}
+			if kind == StorageChange {
+				change.Key = new(felt.Felt).SetBytes(log.subKey)
+			}
+
+			// the value set on this height is the old value logged by the next change, if there is one
+			if next != nil {
+				change.NewValue = new(felt.Felt).SetBytes(next)
+			} else {
+				var err error
+				if change.NewValue, err = headValue(log.subKey); err != nil {
+					return err
+				}
+			}
+			timeline.Changes = append(timeline.Changes, change)
+			return nil
+		})
+	}
+
+	if err = appendChanges(StorageChange, db.ContractStorageHistory.Key(addr.Marshal()), func(subKey []byte) (*felt.Felt, error) {
+		return contract.Storage(new(felt.Felt).SetBytes(subKey))
+	}); err != nil {
+		return nil, err
+	}
+
+	if err = appendChanges(NonceChange, nonceLogKey(addr), func([]byte) (*felt.Felt, error) {
+		return contract.Nonce()
+	}); err != nil {
+		return nil, err
+	}
+
+	if err = appendChanges(ClassHashChange, classHashLogKey(addr), func([]byte) (*felt.Felt, error) {
+		return contract.ClassHash()
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(timeline.Changes, func(i, j int) bool {
+		return timeline.Changes[i].BlockNumber < timeline.Changes[j].BlockNumber
+	})
+	return timeline, nil
+}
+
+// SlotValueAt is the value a storage slot was set to on a block
+type SlotValueAt struct {
+	BlockNumber uint64
+	Value       *felt.Felt
+}
+
+// StorageSlotHistory returns the values that the storage slot at the given key of the contract at the
+// given address was set to between fromBlock and toBlock, both inclusive, in chronological order.
+// Only the logs of the slot are read, starting at fromBlock. The result is empty if the slot was not
+// set in the range, and misses the values of blocks whose logs were pruned.
+func (s *State) StorageSlotHistory(addr, key *felt.Felt, fromBlock, toBlock uint64) ([]SlotValueAt, error) {
+	if fromBlock > toBlock {
+		return nil, fmt.Errorf("invalid block range: %d > %d", fromBlock, toBlock)
+	}
+
+	it, err := s.txn.NewIterator()
+	if err != nil {
+		return nil, err
+	}
+
+	var history []SlotValueAt
+	logKey := storageLogKey(addr, key)
+	for it.Seek(logDBKey(logKey, fromBlock)); it.Valid(); it.Next() {
+		seekedKey := it.Key()
+		if len(seekedKey) != len(logKey)+8 || !bytes.HasPrefix(seekedKey, logKey) {
+			break
+		}
+
+		val, itErr := it.Value()
+		if itErr != nil {
+			return nil, db.CloseAndWrapOnError(it.Close, itErr)
+		}
+
+		// the value set by a change is the old value logged by the next one
+		if len(history) > 0 {
+			history[len(history)-1].Value = new(felt.Felt).SetBytes(val)
+		}
+
+		height := binary.BigEndian.Uint64(seekedKey[len(logKey):])
+		if height > toBlock {
+			break
+		}
+		history = append(history, SlotValueAt{BlockNumber: height})
+	}
+
+	if err = it.Close(); err != nil {
+		return nil, err
+	}
+
+	// the last change in the range may be the latest one
+	if last := len(history) - 1; last >= 0 && history[last].Value == nil {
+		if history[last].Value, err = s.ContractStorage(addr, key); err != nil {
+			return nil, err
+		}
+	}
+	return history, nil
+}
+
+// SlotChurn returns how many times each storage slot of the contract at the given address changed
+// between fromBlock and toBlock, both inclusive, keyed by storage location. Unlike the net change of
+// the range, every intermediate change is counted. Writes that didn't change the value of a slot
+// leave no log and are not counted. The logs of the contract outside the range are skipped, and
+// [ErrHistoryIncomplete] is returned if the history was pruned after fromBlock, see
+// [State.RevertableDepth].
+func (s *State) SlotChurn(addr *felt.Felt, fromBlock, toBlock uint64) (map[felt.Felt]uint64, error) {
+	if fromBlock > toBlock {
+		return nil, fmt.Errorf("invalid block range: %d > %d", fromBlock, toBlock)
+	}
+
+	if err := s.checkHistorySince(fromBlock); err != nil {
+		return nil, err
+	}
+
+	churn := make(map[felt.Felt]uint64)
+	err := s.logsInRange(db.ContractStorageHistory.Key(addr.Marshal()), fromBlock, toBlock, func(log historyLog, _ []byte) error {
+		churn[*new(felt.Felt).SetBytes(log.subKey)]++
+		return nil
+	})
+	return churn, err
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"context"
+	"sort"
+
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// VerifyDeploymentConsistency checks that the contracts with a deployment height are exactly the
+// contracts with a commitment in the global state trie. The addresses that are only in one of the
+// two are returned, sorted. Both the deployment heights and the global state trie are scanned in
+// full, so this is expensive on large states.
+func (s *State) VerifyDeploymentConsistency(ctx context.Context) ([]*felt.Felt, error) {
+	deployed := make(map[felt.Felt]struct{})
+	if err := s.scanDeployments(ctx, atOrAfter(0), func(addr []byte) {
+		deployed[*new(felt.Felt).SetBytes(addr)] = struct{}{}
+	}); err != nil {
+		return nil, err
+	}
+
+	stateTrie, _, err := s.storage()
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []*felt.Felt
+	if err = stateTrie.ForEachLeaf(func(addr, _ *felt.Felt) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		if _, found := deployed[*addr]; found {
+			delete(deployed, *addr)
+		} else {
+			orphans = append(orphans, addr)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// what is left was deployed but has no commitment
+	for addr := range deployed {
+		addr := addr
+		orphans = append(orphans, &addr)
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].Cmp(orphans[j]) < 0
+	})
+	return orphans, nil
+}
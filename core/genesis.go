@@ -0,0 +1,84 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+)
+
+var ErrStateNotEmpty = errors.New("state is not empty")
+
+// GenesisContract is a contract that [State.SeedGenesis] deploys at block zero. Nonce may be nil,
+// in which case the contract starts with a zero nonce.
+type GenesisContract struct {
+	Address   *felt.Felt
+	ClassHash *felt.Felt
+	Nonce     *felt.Felt
+	Storage   map[felt.Felt]*felt.Felt
+}
+
+// SeedGenesis brings up an empty state from a genesis allocation: it registers the given classes,
+// deploys the contracts and sets their nonces and storage, all at block zero and logged to the
+// history as a regular update would be. The class of every contract must either be in classes or
+// already be declared. The resulting state root is returned.
+//
+// Only Cairo 0 classes can be registered this way, since Cairo 1 classes are committed to with
+// their compiled class hash, which is not known here. [ErrStateNotEmpty] is returned if the state
+// already has a non-zero root.
+func (s *State) SeedGenesis(allocs []GenesisContract, classes map[felt.Felt]Class) (*felt.Felt, error) {
+	root, err := s.Root()
+	if err != nil {
+		return nil, err
+	}
+	if !root.IsZero() {
+		return nil, fmt.Errorf("%w: root is %s", ErrStateNotEmpty, root)
+	}
+
+	diff := &StateDiff{
+		StorageDiffs: make(map[felt.Felt][]StorageDiff),
+		Nonces:       make(map[felt.Felt]*felt.Felt),
+	}
+	for classHash, class := range classes {
+		if _, ok := class.(*Cairo0Class); !ok {
+			return nil, fmt.Errorf("genesis class %s: only cairo 0 classes are supported", &classHash)
+		}
+
+		classHash := classHash
+		diff.DeclaredV0Classes = append(diff.DeclaredV0Classes, &classHash)
+	}
+
+	for _, alloc := range allocs {
+		if _, declared := classes[*alloc.ClassHash]; !declared {
+			if _, err = s.Class(alloc.ClassHash); err != nil {
+				if errors.Is(err, db.ErrKeyNotFound) {
+					return nil, fmt.Errorf("class %s of genesis contract %s is not declared", alloc.ClassHash, alloc.Address)
+				}
+				return nil, err
+			}
+		}
+
+		diff.DeployedContracts = append(diff.DeployedContracts, DeployedContract{
+			Address:   alloc.Address,
+			ClassHash: alloc.ClassHash,
+		})
+		if alloc.Nonce != nil {
+			diff.Nonces[*alloc.Address] = alloc.Nonce
+		}
+
+		storage := make([]StorageDiff, 0, len(alloc.Storage))
+		for key, value := range alloc.Storage {
+			key := key
+			storage = append(storage, StorageDiff{Key: &key, Value: value})
+		}
+		if len(storage) > 0 {
+			diff.StorageDiffs[*alloc.Address] = storage
+		}
+	}
+
+	if err = s.applyStateDiff(0, diff, classes, nil, true); err != nil {
+		return nil, err
+	}
+	return s.Root()
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"math"
 
 	"github.com/NethermindEth/juno/core/felt"
 	"github.com/NethermindEth/juno/db"
@@ -66,19 +67,106 @@ func (h *History) valueAt(key []byte, height uint64) ([]byte, error) {
 	return nil, db.CloseAndWrapOnError(it.Close, ErrCheckHeadState)
 }
 
+// historyLog is a single log entry found under a prefix. subKey is the part of the log key between the
+// prefix and the height, e.g. the storage location for contract storage logs.
+type historyLog struct {
+	subKey   []byte
+	height   uint64
+	oldValue []byte
+}
+
+// logsInRange calls fn with the logs under prefix whose height is between fromBlock and toBlock, both
+// inclusive, ordered by subKey and height. next is the old value of the following log of the same
+// subKey, which may be after toBlock, or nil if there is none. Only the logs in the range and the
+// first one after it are read for every subKey, the others are skipped with a seek.
+func (h *History) logsInRange(prefix []byte, fromBlock, toBlock uint64, fn func(log historyLog, next []byte) error) error {
+	it, err := h.txn.NewIterator()
+	if err != nil {
+		return err
+	}
+
+	// the last log in the range, which waits for the old value of the following one
+	var pending *historyLog
+	flush := func(next []byte) error {
+		if pending == nil {
+			return nil
+		}
+		log := *pending
+		pending = nil
+		return fn(log, next)
+	}
+
+	it.Seek(prefix)
+	for it.Valid() {
+		key := it.Key()
+		if len(key) < len(prefix)+8 || !bytes.HasPrefix(key, prefix) {
+			break
+		}
+
+		logKey := bytes.Clone(key[:len(key)-8])
+		subKey := logKey[len(prefix):]
+		height := binary.BigEndian.Uint64(key[len(key)-8:])
+		if pending != nil && !bytes.Equal(pending.subKey, subKey) {
+			if err = flush(nil); err != nil {
+				return db.CloseAndWrapOnError(it.Close, err)
+			}
+		}
+
+		if height < fromBlock {
+			it.Seek(logDBKey(logKey, fromBlock))
+			continue
+		}
+
+		val, itErr := it.Value()
+		if itErr != nil {
+			return db.CloseAndWrapOnError(it.Close, itErr)
+		}
+		if err = flush(val); err != nil {
+			return db.CloseAndWrapOnError(it.Close, err)
+		}
+
+		if height > toBlock {
+			// skip the rest of the logs of subKey
+			if it.Seek(logDBKey(logKey, math.MaxUint64)) && bytes.HasPrefix(it.Key(), logKey) && len(it.Key()) == len(logKey)+8 {
+				it.Next()
+			}
+			continue
+		}
+
+		pending = &historyLog{subKey: subKey, height: height, oldValue: bytes.Clone(val)}
+		it.Next()
+	}
+
+	if err = flush(nil); err != nil {
+		return db.CloseAndWrapOnError(it.Close, err)
+	}
+	return it.Close()
+}
+
 func storageLogKey(contractAddress, storageLocation *felt.Felt) []byte {
 	return db.ContractStorageHistory.Key(contractAddress.Marshal(), storageLocation.Marshal())
 }
 
+// storageChangeKey is the key of a storage log in the index of the storage changes by block number
+func storageChangeKey(contractAddress, storageLocation *felt.Felt, height uint64) []byte {
+	return db.StorageChangesByBlockNumber.Key(MarshalBlockNumber(height), contractAddress.Marshal(), storageLocation.Marshal())
+}
+
 // LogContractStorage logs the old value of a storage location for the given contract which changed on height `height`
 func (h *History) LogContractStorage(contractAddress, storageLocation, oldValue *felt.Felt, height uint64) error {
 	key := storageLogKey(contractAddress, storageLocation)
-	return h.logOldValue(key, oldValue.Marshal(), height)
+	if err := h.logOldValue(key, oldValue.Marshal(), height); err != nil {
+		return err
+	}
+	return h.txn.Set(storageChangeKey(contractAddress, storageLocation, height), []byte{})
 }
 
 // DeleteContractStorageLog deletes the log at the given height
 func (h *History) DeleteContractStorageLog(contractAddress, storageLocation *felt.Felt, height uint64) error {
-	return h.deleteLog(storageLogKey(contractAddress, storageLocation), height)
+	if err := h.deleteLog(storageLogKey(contractAddress, storageLocation), height); err != nil {
+		return err
+	}
+	return h.txn.Delete(storageChangeKey(contractAddress, storageLocation, height))
 }
 
 // ContractStorageAt returns the value of a storage location of the given contract at the height `height`
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/NethermindEth/juno/db"
+)
+
+// RevertableDepth returns the oldest block that can be reverted using the retained history logs.
+// Reverting a block relies on the logs of that block and of all blocks after it, so no block older
+// than the oldest retained log can be reconstructed. The depth is the low-water mark stored when the
+// history is pruned with [State.PruneHistory] or when the state starts after genesis, and 0 without
+// one. ok is false if the state is empty, i.e. there is no history at all.
+func (s *State) RevertableDepth() (depth uint64, ok bool, err error) {
+	err = s.txn.Get(db.HistoryLowWaterMark.Key(), func(val []byte) error {
+		depth = binary.BigEndian.Uint64(val)
+		return nil
+	})
+	if err == nil {
+		return depth, true, nil
+	} else if !errors.Is(err, db.ErrKeyNotFound) {
+		return 0, false, err
+	}
+
+	rootKey, err := s.rootKey(db.StateTrie)
+	if err != nil {
+		return 0, false, err
+	}
+	return 0, rootKey != nil, nil
+}
+
+// checkHistorySince returns [ErrHistoryIncomplete] if the history logs don't go back to blockNumber
+func (s *State) checkHistorySince(blockNumber uint64) error {
+	depth, ok, err := s.RevertableDepth()
+	if err != nil {
+		return err
+	}
+
+	if ok && depth > blockNumber {
+		return fmt.Errorf("%w: oldest history log is at block %d", ErrHistoryIncomplete, depth)
+	}
+	return nil
+}
+
+// setHistoryLowWaterMark records that the history logs of the blocks before blockNumber are gone
+func (s *State) setHistoryLowWaterMark(blockNumber uint64) error {
+	return s.txn.Set(db.HistoryLowWaterMark.Key(), MarshalBlockNumber(blockNumber))
+}
+
+// PruneHistory deletes the history logs of the blocks before blockNumber, which can't be reverted
+// afterwards, and moves the low-water mark reported by [State.RevertableDepth] to blockNumber. The
+// nonce and class hash logs are all scanned, the storage logs are found in their index by block
+// number. Pruning below the current mark does nothing.
+func (s *State) PruneHistory(blockNumber uint64) error {
+	depth, _, err := s.RevertableDepth()
+	if err != nil || depth >= blockNumber {
+		return err
+	}
+
+	var keys [][]byte
+	indexPrefix := db.StorageChangesByBlockNumber.Key()
+	if err = s.collectKeys(indexPrefix, func(key []byte) bool {
+		return binary.BigEndian.Uint64(key[len(indexPrefix):]) < blockNumber
+	}, func(key []byte) {
+		height := key[len(indexPrefix) : len(indexPrefix)+8]
+		keys = append(keys, key, db.ContractStorageHistory.Key(key[len(indexPrefix)+8:], height))
+	}); err != nil {
+		return err
+	}
+
+	for _, bucket := range []db.Bucket{db.ContractNonceHistory, db.ContractClassHashHistory} {
+		if err = s.collectKeys(bucket.Key(), func([]byte) bool {
+			return true
+		}, func(key []byte) {
+			if binary.BigEndian.Uint64(key[len(key)-8:]) < blockNumber {
+				keys = append(keys, key)
+			}
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range keys {
+		if err = s.txn.Delete(key); err != nil {
+			return err
+		}
+	}
+	return s.setHistoryLowWaterMark(blockNumber)
+}
+
+// collectKeys calls fn with a copy of every key under prefix, in key order, while more returns true
+func (s *State) collectKeys(prefix []byte, more func(key []byte) bool, fn func(key []byte)) error {
+	it, err := s.txn.NewIterator()
+	if err != nil {
+		return err
+	}
+
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key()
+		if !bytes.HasPrefix(key, prefix) || !more(key) {
+			break
+		}
+		fn(bytes.Clone(key))
+	}
+	return it.Close()
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+)
+
+// MissingClasses returns the hashes of the classes that the update deploys or replaces contracts
+// with but that are not stored in the state, sorted. These are the classes that must be fetched
+// before the update can be applied.
+func (s *State) MissingClasses(update *StateUpdate) ([]*felt.Felt, error) {
+	diff := update.StateDiff
+	referenced := make(map[felt.Felt]struct{}, len(diff.DeployedContracts)+len(diff.ReplacedClasses))
+	for _, deployed := range diff.DeployedContracts {
+		referenced[*deployed.ClassHash] = struct{}{}
+	}
+	for _, replaced := range diff.ReplacedClasses {
+		referenced[*replaced.ClassHash] = struct{}{}
+	}
+
+	var missing []*felt.Felt
+	for classHash := range referenced {
+		classHash := classHash
+		err := s.txn.Get(db.Class.Key(classHash.Marshal()), func([]byte) error {
+			return nil
+		})
+		if errors.Is(err, db.ErrKeyNotFound) {
+			missing = append(missing, &classHash)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i].Cmp(missing[j]) < 0
+	})
+	return missing, nil
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/core/trie"
+	"github.com/NethermindEth/juno/db"
+)
+
+// NonExistenceProof returns the proof that no contract is deployed at the given address, i.e. that
+// its leaf in the global state trie is empty. The proof ends with the edge node whose path diverges
+// from the address, which is the leaf of a neighbouring contract if the address shares all but its
+// last bits with a deployed one. The proof of an empty global state trie has no nodes.
+// [ErrContractAlreadyDeployed] is returned if a contract is deployed at the address.
+func (s *State) NonExistenceProof(addr *felt.Felt) ([]trie.ProofNode, error) {
+	if _, err := classHash(addr, s.txn); err == nil {
+		return nil, ErrContractAlreadyDeployed
+	} else if !errors.Is(err, db.ErrKeyNotFound) {
+		return nil, err
+	}
+
+	stateTrie, _, err := s.storage()
+	if err != nil {
+		return nil, err
+	}
+	return stateTrie.Prove(addr)
+}
+
+// VerifyNonExistenceProof checks a proof returned by [State.NonExistenceProof] against the state
+// commitment. The classes root is needed to reconstruct the state commitment from the root of the
+// global state trie, which is the hash of the first node of the proof. A proof that ends before it
+// either diverges from addr or reaches its leaf, e.g. the proof of another address, proves nothing
+// about addr and is not verified.
+func VerifyNonExistenceProof(stateRoot, classesRoot, addr *felt.Felt, proof []trie.ProofNode) (bool, error) {
+	storageRoot := new(felt.Felt)
+	if len(proof) > 0 {
+		storageRoot = proof[0].Hash(crypto.Pedersen)
+	}
+
+	if !StateCommitment(storageRoot, classesRoot).Equal(stateRoot) {
+		return false, nil
+	}
+	verified, err := trie.VerifyProofPedersen(storageRoot, addr, globalTrieHeight, new(felt.Felt), proof)
+	if errors.Is(err, trie.ErrIncompleteProof) {
+		return false, nil
+	}
+	return verified, err
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/core/trie"
+	"github.com/NethermindEth/juno/db"
+)
+
+// NonceProof returns the proof of the nonce of the contract at the given address: the path of the
+// contract in the global state trie, its nonce, its class hash and its storage root. The nonce is not
+// committed on its own but folded into the contract commitment together with the class hash and
+// storage root, so all three are returned for a verifier to rebuild the leaf, see [VerifyNonceProof].
+// The class hash and the storage root are returned as two values rather than as the single hash that
+// enters the commitment, so that callers can check each of them.
+func (s *State) NonceProof(addr *felt.Felt) (proof []trie.ProofNode, nonce, classHash, storageRoot *felt.Felt, err error) {
+	contract, err := NewContract(addr, s.txn)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	nonce, err = contract.Nonce()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	classHash, err = contract.ClassHash()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	storageRoot, err = contract.Root()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	stateTrie, storageCloser, err := s.storage()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	proof, err = stateTrie.Prove(addr)
+	if err = db.CloseAndWrapOnError(storageCloser, err); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return proof, nonce, classHash, storageRoot, nil
+}
+
+// VerifyNonceProof checks the values returned by [State.NonceProof] against the state commitment. The
+// contract commitment is reconstructed from the nonce, class hash and storage root, and the classes
+// root is needed to reconstruct the state commitment from the root of the global state trie.
+func VerifyNonceProof(stateRoot, classesRoot, addr, nonce, classHash, storageRoot *felt.Felt, proof []trie.ProofNode) (bool, error) {
+	if len(proof) == 0 {
+		return false, nil
+	}
+
+	stateTrieRoot := proof[0].Hash(crypto.Pedersen)
+	if !StateCommitment(stateTrieRoot, classesRoot).Equal(stateRoot) {
+		return false, nil
+	}
+
+	commitment := calculateContractCommitment(storageRoot, classHash, nonce)
+	return trie.VerifyProofPedersen(stateTrieRoot, addr, globalTrieHeight, commitment, proof)
+}
@@ -0,0 +1,252 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/core/trie"
+	"github.com/bits-and-blooms/bitset"
+)
+
+// PartialProof proves the commitments of a subset of contracts against the state commitment, so
+// that they can be verified without the rest of the state. Nodes that are shared between the paths
+// of several contracts, e.g. the ones close to the root, are included once.
+type PartialProof struct {
+	StorageRoot *felt.Felt
+	ClassesRoot *felt.Felt
+	Nodes       []trie.ProofNode
+	Contracts   []ContractProof
+}
+
+// ContractProof is the path of a single contract in a [PartialProof]. Commitment is zero if the
+// contract is not deployed, in which case the path proves its absence.
+type ContractProof struct {
+	Address    *felt.Felt
+	Commitment *felt.Felt
+	// Path holds the indices of the nodes in [PartialProof.Nodes], from the root to the contract
+	Path []int
+}
+
+// PartialRootProof returns the proofs of the commitments of the contracts at the given addresses in
+// the global state trie, together with the roots needed to reconstruct the state commitment.
+func (s *State) PartialRootProof(addrs []*felt.Felt) (*PartialProof, error) {
+	stateTrie, _, err := s.storage()
+	if err != nil {
+		return nil, err
+	}
+
+	classesTrie, _, err := s.classesTrie()
+	if err != nil {
+		return nil, err
+	}
+
+	proof := new(PartialProof)
+	if proof.StorageRoot, err = stateTrie.Root(); err != nil {
+		return nil, err
+	}
+	if proof.ClassesRoot, err = classesTrie.Root(); err != nil {
+		return nil, err
+	}
+
+	var shared nodeSet
+	for _, addr := range addrs {
+		nodes, err := stateTrie.Prove(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		commitment, err := stateTrie.Get(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		proof.Contracts = append(proof.Contracts, ContractProof{
+			Address:    addr,
+			Commitment: commitment,
+			Path:       shared.add(nodes),
+		})
+	}
+	proof.Nodes = shared.nodes
+	return proof, nil
+}
+
+// nodeSet collects the nodes of several paths of the global state trie, keeping each node once
+type nodeSet struct {
+	nodes   []trie.ProofNode
+	indices map[felt.Felt]int
+}
+
+// add adds the nodes of a path that are missing and returns the indices of all of them in order
+func (s *nodeSet) add(path []trie.ProofNode) []int {
+	if s.indices == nil {
+		s.indices = make(map[felt.Felt]int)
+	}
+
+	indices := make([]int, 0, len(path))
+	for _, node := range path {
+		nodeHash := node.Hash(crypto.Pedersen)
+		idx, found := s.indices[*nodeHash]
+		if !found {
+			idx = len(s.nodes)
+			s.nodes = append(s.nodes, node)
+			s.indices[*nodeHash] = idx
+		}
+		indices = append(indices, idx)
+	}
+	return indices
+}
+
+// MultiContractProof returns the proofs of the contracts at the given addresses in the global state
+// trie, with the nodes that are shared between them, e.g. the ones close to the root, included once.
+// perContract holds the indices of the nodes in sharedNodes on the path of every contract, from the
+// root down, so that its proof is sharedNodes[i] for every index i. Addresses of contracts that are
+// not deployed get the path that proves their absence, like [State.NonExistenceProof].
+func (s *State) MultiContractProof(addrs []*felt.Felt) (
+	sharedNodes []trie.ProofNode, perContract map[felt.Felt][]int, err error,
+) {
+	stateTrie, _, err := s.storage()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var shared nodeSet
+	perContract = make(map[felt.Felt][]int, len(addrs))
+	for _, addr := range addrs {
+		if _, found := perContract[*addr]; found {
+			continue
+		}
+
+		nodes, err := stateTrie.Prove(addr)
+		if err != nil {
+			return nil, nil, err
+		}
+		perContract[*addr] = shared.add(nodes)
+	}
+	return shared.nodes, perContract, nil
+}
+
+// VerifyPartialProof checks that the roots in the proof make up the given state commitment and that
+// the commitment of every contract in the proof is part of the global state trie.
+func VerifyPartialProof(stateRoot *felt.Felt, proof *PartialProof) (bool, error) {
+	if !StateCommitment(proof.StorageRoot, proof.ClassesRoot).Equal(stateRoot) {
+		return false, nil
+	}
+
+	for _, contract := range proof.Contracts {
+		nodes := make([]trie.ProofNode, 0, len(contract.Path))
+		for _, idx := range contract.Path {
+			if idx < 0 || idx >= len(proof.Nodes) {
+				return false, fmt.Errorf("node index %d of contract %s is out of range", idx, contract.Address)
+			}
+			nodes = append(nodes, proof.Nodes[idx])
+		}
+
+		verified, err := trie.VerifyProofPedersen(proof.StorageRoot, contract.Address, globalTrieHeight, contract.Commitment, nodes)
+		if err != nil || !verified {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// ShardCommitment returns a commitment over the contracts at the given addresses, for verifiers that
+// only check a slice of the state, together with the global state trie nodes that bind the contracts
+// to the state commitment. The commitment is the Poseidon hash of the address and contract commitment
+// of every contract, ordered by address, with a zero commitment for contracts that are not deployed.
+// Nodes shared between the paths of the contracts are included once, in the order of addrs, like
+// the nodes of [State.PartialRootProof]. See [VerifyShardCommitment].
+func (s *State) ShardCommitment(addrs []*felt.Felt) (*felt.Felt, []trie.ProofNode, error) {
+	proof, err := s.PartialRootProof(addrs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	commitments := make(map[felt.Felt]*felt.Felt, len(proof.Contracts))
+	for _, contract := range proof.Contracts {
+		commitments[*contract.Address] = contract.Commitment
+	}
+	return ShardCommitmentOf(commitments), proof.Nodes, nil
+}
+
+// ShardCommitmentOf computes the commitment of [State.ShardCommitment] from the contract commitments
+// of the shard, keyed by address
+func ShardCommitmentOf(commitments map[felt.Felt]*felt.Felt) *felt.Felt {
+	addrs := make([]felt.Felt, 0, len(commitments))
+	for addr := range commitments {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return addrs[i].Cmp(&addrs[j]) < 0
+	})
+
+	elems := make([]*felt.Felt, 0, 2*len(addrs))
+	for i := range addrs {
+		elems = append(elems, &addrs[i], commitments[addrs[i]])
+	}
+	return crypto.PoseidonArray(elems...)
+}
+
+// VerifyShardCommitment checks a commitment returned by [State.ShardCommitment] against the state
+// commitment. commitments holds the contract commitment of every contract of the shard, keyed by
+// address, with zero for contracts that are not deployed. The path of every contract is looked up in
+// nodes by hash, starting at the storage root.
+func VerifyShardCommitment(stateRoot, storageRoot, classesRoot, commitment *felt.Felt,
+	commitments map[felt.Felt]*felt.Felt, nodes []trie.ProofNode,
+) (bool, error) {
+	if !StateCommitment(storageRoot, classesRoot).Equal(stateRoot) || !ShardCommitmentOf(commitments).Equal(commitment) {
+		return false, nil
+	}
+
+	nodesByHash := make(map[felt.Felt]*trie.ProofNode, len(nodes))
+	for i := range nodes {
+		nodesByHash[*nodes[i].Hash(crypto.Pedersen)] = &nodes[i]
+	}
+
+	for addr, contractCommitment := range commitments {
+		addr := addr
+		path := shardContractPath(storageRoot, &addr, nodesByHash)
+		verified, err := trie.VerifyProofPedersen(storageRoot, &addr, globalTrieHeight, contractCommitment, path)
+		if err != nil || !verified {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// shardContractPath follows the key from the root through the nodes with the expected hashes. It
+// stops at a missing node, at the bottom of the trie or at an edge that diverges from the key.
+func shardContractPath(root, key *felt.Felt, nodesByHash map[felt.Felt]*trie.ProofNode) []trie.ProofNode {
+	keyBits := key.Bits()
+	keyBitSet := bitset.FromWithLength(globalTrieHeight, keyBits[:])
+	var path []trie.ProofNode
+	expected, depth := root, uint(0)
+	for depth < globalTrieHeight {
+		node, found := nodesByHash[*expected]
+		if !found {
+			break
+		}
+		path = append(path, *node)
+
+		if node.Binary != nil {
+			if keyBitSet.Test(globalTrieHeight - depth - 1) {
+				expected = node.Binary.RightHash
+			} else {
+				expected = node.Binary.LeftHash
+			}
+			depth++
+			continue
+		}
+
+		edgePath := node.Edge.Path
+		for i := uint(0); i < edgePath.Len(); i++ {
+			if edgePath.Test(i) != keyBitSet.Test(globalTrieHeight-depth-edgePath.Len()+i) {
+				return path
+			}
+		}
+		expected = node.Edge.Child
+		depth += edgePath.Len()
+	}
+	return path
+}
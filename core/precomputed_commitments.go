@@ -0,0 +1,50 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// ErrCommitmentMismatch is returned when a contract commitment passed to
+// [State.ApplyDiffWithCommitments] doesn't match the one computed from the state.
+var ErrCommitmentMismatch = errors.New("precomputed contract commitment mismatch")
+
+// WithCommitmentVerification makes [State.ApplyDiffWithCommitments] compute the commitments of the
+// contracts anyway and fail with [ErrCommitmentMismatch] if a precomputed one differs.
+func (s *State) WithCommitmentVerification() *State {
+	s.verifyCommitments = true
+	return s
+}
+
+// ApplyDiffWithCommitments applies diff at blockNumber like [State.Update] does, but takes the
+// commitments of the contracts in precomputed from there instead of computing them, and returns the
+// new state root without checking it against anything. The storage tries of those contracts are
+// still updated. It is up to the caller to make sure that the precomputed commitments are the ones
+// the diff results in, or to enable [State.WithCommitmentVerification].
+func (s *State) ApplyDiffWithCommitments(blockNumber uint64, diff *StateDiff, precomputed map[felt.Felt]*felt.Felt,
+	classes map[felt.Felt]Class,
+) (*felt.Felt, error) {
+	if err := s.applyStateDiff(blockNumber, diff, classes, precomputed, true); err != nil {
+		return nil, err
+	}
+	return s.Root()
+}
+
+// commitmentOf returns the commitment of contract, which is precomputed if that is not nil
+func (s *State) commitmentOf(contract *Contract, precomputed *felt.Felt) (*felt.Felt, error) {
+	if precomputed != nil && !s.verifyCommitments {
+		return precomputed, nil
+	}
+
+	commitment, err := contractCommitment(contract)
+	if err != nil {
+		return nil, err
+	}
+	if precomputed != nil && !precomputed.Equal(commitment) {
+		return nil, fmt.Errorf("%w: contract %s: got %s, computed %s", ErrCommitmentMismatch, contract.Address,
+			precomputed, commitment)
+	}
+	return commitment, nil
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// Discrepancy is a value in the state that differs from the one a [StateUpdate] sets. Key is the
+// storage location for storage discrepancies and nil otherwise. Actual is nil if the contract is
+// not deployed.
+type Discrepancy struct {
+	Kind     ContractChangeKind
+	Address  *felt.Felt
+	Key      *felt.Felt
+	Expected *felt.Felt
+	Actual   *felt.Felt
+}
+
+// ReconcileReport is the result of [State.Reconcile]. Discrepancies are sorted by address, kind and key.
+type ReconcileReport struct {
+	Checked       int
+	Discrepancies []Discrepancy
+}
+
+// Consistent returns true if the state agrees with every value in the state update.
+func (r *ReconcileReport) Consistent() bool {
+	return len(r.Discrepancies) == 0
+}
+
+// Reconcile compares every class hash, nonce and storage value that the update's diff sets against
+// the value currently in the state, and reports the ones that differ. It is meant to be called on
+// a state that the update has been applied to, to pinpoint the contracts and keys that diverged
+// when the roots don't match. The state is not modified.
+func (s *State) Reconcile(update *StateUpdate) (*ReconcileReport, error) {
+	report := new(ReconcileReport)
+	check := func(kind ContractChangeKind, addr, key, expected *felt.Felt, actual func() (*felt.Felt, error)) error {
+		report.Checked++
+
+		value, err := actual()
+		if err != nil {
+			if !errors.Is(err, ErrContractNotDeployed) {
+				return err
+			}
+			value = nil
+		}
+
+		if value == nil || !value.Equal(expected) {
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{
+				Kind:     kind,
+				Address:  addr,
+				Key:      key,
+				Expected: expected,
+				Actual:   value,
+			})
+		}
+		return nil
+	}
+
+	diff := update.StateDiff
+	// a contract that is deployed and replaced in the same block ends up with the replacement class
+	classHashes := make(map[felt.Felt]*felt.Felt, len(diff.DeployedContracts)+len(diff.ReplacedClasses))
+	for _, deployed := range diff.DeployedContracts {
+		classHashes[*deployed.Address] = deployed.ClassHash
+	}
+	for _, replaced := range diff.ReplacedClasses {
+		classHashes[*replaced.Address] = replaced.ClassHash
+	}
+
+	for addr, classHash := range classHashes {
+		addr := addr
+		if err := check(ClassHashChange, &addr, nil, classHash, func() (*felt.Felt, error) {
+			return s.ContractClassHash(&addr)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	for addr, nonce := range diff.Nonces {
+		addr := addr
+		if err := check(NonceChange, &addr, nil, nonce, func() (*felt.Felt, error) {
+			return s.ContractNonce(&addr)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	for addr, storageDiffs := range diff.StorageDiffs {
+		addr := addr
+		// only the last write to a location in a block counts
+		values := make(map[felt.Felt]*felt.Felt, len(storageDiffs))
+		for _, storageDiff := range storageDiffs {
+			values[*storageDiff.Key] = storageDiff.Value
+		}
+
+		for key, value := range values {
+			key := key
+			if err := check(StorageChange, &addr, &key, value, func() (*felt.Felt, error) {
+				return s.ContractStorage(&addr, &key)
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.Slice(report.Discrepancies, func(i, j int) bool {
+		a, b := &report.Discrepancies[i], &report.Discrepancies[j]
+		if cmp := a.Address.Cmp(b.Address); cmp != 0 {
+			return cmp < 0
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Kind == StorageChange && a.Key.Cmp(b.Key) < 0
+	})
+	return report, nil
+}
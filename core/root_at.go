@@ -0,0 +1,181 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+	"github.com/NethermindEth/juno/encoder"
+)
+
+// RootAt returns the state commitment right after the block with the given number was applied. The
+// changes of the later blocks are undone using the history logs on an in-memory overlay, which is
+// discarded afterwards, so the state is left untouched. [ErrHistoryIncomplete] is returned if the
+// logs don't go back far enough.
+//
+// Note that this walks over all the history logs, deployments and declared classes.
+func (s *State) RootAt(blockNumber uint64) (*felt.Felt, error) {
+	if err := s.checkHistorySince(blockNumber + 1); err != nil {
+		return nil, err
+	}
+
+	overlayTxn := db.NewOverlayTransaction(s.txn)
+	root, err := s.withTxn(overlayTxn).rollBack(blockNumber)
+	return root, db.CloseAndWrapOnError(overlayTxn.Discard, err)
+}
+
+// VerifyAgainstL1Root checks that the state commitment right after the block with the given number
+// was applied matches the root posted to L1 for that block. A mismatch is reported with a
+// [RootMismatchError].
+func (s *State) VerifyAgainstL1Root(l1Root *felt.Felt, blockNumber uint64) error {
+	root, err := s.RootAt(blockNumber)
+	if err != nil {
+		return fmt.Errorf("compute root at block %d: %w", blockNumber, err)
+	}
+
+	if !root.Equal(l1Root) {
+		return fmt.Errorf("block %d: %w", blockNumber, &RootMismatchError{
+			Root:     "L1 state",
+			Expected: l1Root,
+			Actual:   root,
+		})
+	}
+	return nil
+}
+
+// rollBack undoes all the changes made after the given block and returns the resulting root
+func (s *State) rollBack(blockNumber uint64) (*felt.Felt, error) {
+	ctx := context.Background()
+
+	// contracts deployed later are purged, their logs don't need to be undone
+	purged := make(map[felt.Felt]struct{})
+	if err := s.scanDeployments(ctx, atOrAfter(blockNumber+1), func(addr []byte) {
+		purged[*new(felt.Felt).SetBytes(addr)] = struct{}{}
+	}); err != nil {
+		return nil, err
+	}
+
+	diff := &StateDiff{
+		StorageDiffs: make(map[felt.Felt][]StorageDiff),
+		Nonces:       make(map[felt.Felt]*felt.Felt),
+	}
+	for _, bucket := range []db.Bucket{db.ContractStorageHistory, db.ContractNonceHistory, db.ContractClassHashHistory} {
+		bucket := bucket
+		if err := s.earliestLogsAfter(bucket.Key(), blockNumber, func(subKey, oldValue []byte) {
+			addr := new(felt.Felt).SetBytes(subKey[:felt.Bytes])
+			if _, found := purged[*addr]; found {
+				return
+			}
+
+			value := new(felt.Felt).SetBytes(oldValue)
+			switch bucket {
+			case db.ContractStorageHistory:
+				key := new(felt.Felt).SetBytes(subKey[felt.Bytes:])
+				diff.StorageDiffs[*addr] = append(diff.StorageDiffs[*addr], StorageDiff{Key: key, Value: value})
+			case db.ContractNonceHistory:
+				diff.Nonces[*addr] = value
+			default:
+				diff.ReplacedClasses = append(diff.ReplacedClasses, ReplacedClass{Address: addr, ClassHash: value})
+			}
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	stateTrie, storageCloser, err := s.storage()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.updateContracts(stateTrie, blockNumber, diff, nil, false); err != nil {
+		return nil, err
+	}
+
+	if err = storageCloser(); err != nil {
+		return nil, err
+	}
+
+	for addr := range purged {
+		addr := addr
+		if err = s.purgeContract(&addr); err != nil {
+			return nil, err
+		}
+	}
+
+	declaredLater, err := s.classesDeclaredAfter(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.updateDeclaredClassesTrie(declaredLater, true); err != nil {
+		return nil, err
+	}
+	return s.Root()
+}
+
+// earliestLogsAfter calls fn with the sub key and the old value of the earliest log after height of
+// every sub key under prefix. The old value of that log is the value the sub key had at height.
+func (s *State) earliestLogsAfter(prefix []byte, height uint64, fn func(subKey, oldValue []byte)) error {
+	it, err := s.txn.NewIterator()
+	if err != nil {
+		return err
+	}
+
+	var lastSubKey []byte
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key()
+		if len(key) < len(prefix)+8 || !bytes.HasPrefix(key, prefix) {
+			break
+		}
+
+		// logs of a sub key are sorted by height, so the first one after height is the earliest
+		subKey := key[len(prefix) : len(key)-8]
+		if binary.BigEndian.Uint64(key[len(key)-8:]) <= height || bytes.Equal(subKey, lastSubKey) {
+			continue
+		}
+		lastSubKey = bytes.Clone(subKey)
+
+		val, itErr := it.Value()
+		if itErr != nil {
+			return db.CloseAndWrapOnError(it.Close, itErr)
+		}
+		fn(lastSubKey, bytes.Clone(val))
+	}
+	return it.Close()
+}
+
+// classesDeclaredAfter returns the Cairo 1 classes declared after the given height. Only the class
+// hashes are set, which is enough to remove them from the classes trie.
+func (s *State) classesDeclaredAfter(height uint64) ([]DeclaredV1Class, error) {
+	it, err := s.txn.NewIterator()
+	if err != nil {
+		return nil, err
+	}
+
+	var classes []DeclaredV1Class
+	prefix := db.Class.Key()
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+
+		val, itErr := it.Value()
+		if itErr != nil {
+			return nil, db.CloseAndWrapOnError(it.Close, itErr)
+		}
+
+		var declaredClass DeclaredClass
+		if err = encoder.Unmarshal(val, &declaredClass); err != nil {
+			return nil, db.CloseAndWrapOnError(it.Close, err)
+		}
+
+		if declaredClass.At > height && declaredClass.Class.Version() == 1 {
+			classes = append(classes, DeclaredV1Class{ClassHash: new(felt.Felt).SetBytes(key[len(prefix):])})
+		}
+	}
+	return classes, it.Close()
+}
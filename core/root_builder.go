@@ -0,0 +1,127 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+)
+
+// RootBuilder tracks the state commitment of a base [State] as changes are applied to it one at a
+// time, without modifying the base state. Changes are buffered and only applied to an in-memory
+// overlay of the base state when [RootBuilder.CurrentRoot] is called, at which point only the
+// commitments of the contracts changed since the previous call are recomputed.
+//
+// The base state must not be modified while the builder is in use. [RootBuilder.Discard] must be
+// called once the builder is no longer needed.
+type RootBuilder struct {
+	txn   db.Transaction
+	state *State
+	root  *felt.Felt
+
+	storage     map[felt.Felt]map[felt.Felt]*felt.Felt
+	nonces      map[felt.Felt]*felt.Felt
+	classHashes map[felt.Felt]*felt.Felt
+}
+
+// NewRootBuilder returns a [RootBuilder] on top of base.
+func NewRootBuilder(base *State) *RootBuilder {
+	txn := db.NewOverlayTransaction(base.txn)
+	b := &RootBuilder{
+		txn:   txn,
+		state: base.withTxn(txn),
+	}
+	b.reset()
+	return b
+}
+
+func (b *RootBuilder) reset() {
+	b.storage = make(map[felt.Felt]map[felt.Felt]*felt.Felt)
+	b.nonces = make(map[felt.Felt]*felt.Felt)
+	b.classHashes = make(map[felt.Felt]*felt.Felt)
+}
+
+// ApplyChange sets the storage value at key, the nonce or the class hash of the contract at addr,
+// depending on kind. key is only used for storage changes. Setting the class hash of a contract
+// that is not deployed deploys it.
+func (b *RootBuilder) ApplyChange(kind ContractChangeKind, addr, key, value *felt.Felt) error {
+	switch kind {
+	case StorageChange:
+		if key == nil {
+			return errors.New("storage change without a key")
+		}
+		if b.storage[*addr] == nil {
+			b.storage[*addr] = make(map[felt.Felt]*felt.Felt)
+		}
+		b.storage[*addr][*key] = value
+	case NonceChange:
+		b.nonces[*addr] = value
+	case ClassHashChange:
+		b.classHashes[*addr] = value
+	default:
+		return fmt.Errorf("unknown change kind %d", kind)
+	}
+	return nil
+}
+
+// CurrentRoot returns the state commitment of the base state with all the changes applied so far.
+// It is cheap to call repeatedly: only the changes applied since the previous call are processed.
+// If an error is returned, the builder is left in an undefined state and should be discarded.
+func (b *RootBuilder) CurrentRoot() (*felt.Felt, error) {
+	if b.root != nil && len(b.storage) == 0 && len(b.nonces) == 0 && len(b.classHashes) == 0 {
+		return b.root, nil
+	}
+
+	diff, err := b.pendingDiff()
+	if err != nil {
+		return nil, err
+	}
+
+	// block number is irrelevant for the commitment and nothing is logged to the history
+	if err = b.state.applyStateDiff(0, diff, nil, nil, false); err != nil {
+		return nil, err
+	}
+	b.reset()
+
+	if b.root, err = b.state.Root(); err != nil {
+		return nil, err
+	}
+	return b.root, nil
+}
+
+// pendingDiff turns the buffered changes into a [StateDiff]
+func (b *RootBuilder) pendingDiff() (*StateDiff, error) {
+	diff := &StateDiff{
+		StorageDiffs: make(map[felt.Felt][]StorageDiff, len(b.storage)),
+		Nonces:       b.nonces,
+	}
+
+	for addr, classHash := range b.classHashes {
+		addr := addr
+		_, err := b.state.ContractClassHash(&addr)
+		switch {
+		case errors.Is(err, ErrContractNotDeployed):
+			diff.DeployedContracts = append(diff.DeployedContracts, DeployedContract{Address: &addr, ClassHash: classHash})
+		case err != nil:
+			return nil, err
+		default:
+			diff.ReplacedClasses = append(diff.ReplacedClasses, ReplacedClass{Address: &addr, ClassHash: classHash})
+		}
+	}
+
+	for addr, values := range b.storage {
+		storage := make([]StorageDiff, 0, len(values))
+		for key, value := range values {
+			key := key
+			storage = append(storage, StorageDiff{Key: &key, Value: value})
+		}
+		diff.StorageDiffs[addr] = storage
+	}
+	return diff, nil
+}
+
+// Discard drops the applied changes and releases the builder's resources.
+func (b *RootBuilder) Discard() error {
+	return b.txn.Discard()
+}
@@ -0,0 +1,81 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/NethermindEth/juno/clients/feeder"
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db/pebble"
+	adaptfeeder "github.com/NethermindEth/juno/starknetdata/feeder"
+	"github.com/NethermindEth/juno/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRootBuilder(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+	state := core.NewState(txn)
+
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+
+	su1, err := gw.StateUpdate(context.Background(), 1)
+	require.NoError(t, err)
+
+	builder := core.NewRootBuilder(state)
+	t.Cleanup(func() {
+		require.NoError(t, builder.Discard())
+	})
+
+	root, err := builder.CurrentRoot()
+	require.NoError(t, err)
+	assert.Equal(t, su0.NewRoot, root)
+
+	// feed block 1 one contract at a time, checking the running root against a projection
+	partial := &core.StateDiff{StorageDiffs: make(map[felt.Felt][]core.StorageDiff)}
+	for _, deployed := range su1.StateDiff.DeployedContracts {
+		require.NoError(t, builder.ApplyChange(core.ClassHashChange, deployed.Address, nil, deployed.ClassHash))
+		partial.DeployedContracts = append(partial.DeployedContracts, deployed)
+	}
+	for addr, diffs := range su1.StateDiff.StorageDiffs {
+		addr := addr
+		for _, diff := range diffs {
+			require.NoError(t, builder.ApplyChange(core.StorageChange, &addr, diff.Key, diff.Value))
+		}
+		partial.StorageDiffs[addr] = diffs
+
+		projected, err := state.ProjectRoot(partial, nil)
+		require.NoError(t, err)
+
+		root, err = builder.CurrentRoot()
+		require.NoError(t, err)
+		assert.Equal(t, projected, root)
+	}
+	for addr, nonce := range su1.StateDiff.Nonces {
+		addr := addr
+		require.NoError(t, builder.ApplyChange(core.NonceChange, &addr, nil, nonce))
+	}
+
+	root, err = builder.CurrentRoot()
+	require.NoError(t, err)
+	assert.Equal(t, su1.NewRoot, root)
+
+	baseRoot, err := state.Root()
+	require.NoError(t, err)
+	assert.Equal(t, su0.NewRoot, baseRoot, "base state must be left untouched")
+
+	t.Run("storage change without a key", func(t *testing.T) {
+		require.Error(t, builder.ApplyChange(core.StorageChange, su1.NewRoot, nil, su1.NewRoot))
+	})
+}
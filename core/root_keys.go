@@ -0,0 +1,65 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/NethermindEth/juno/db"
+)
+
+// RootKeyCheckpoint holds the root keys of the global state trie and of the classes trie, as
+// returned by [State.SaveRootKeys].
+type RootKeyCheckpoint struct {
+	stateRootKey   []byte
+	classesRootKey []byte
+}
+
+// SaveRootKeys captures the keys of the root nodes of the global state trie and of the classes trie.
+func (s *State) SaveRootKeys() (*RootKeyCheckpoint, error) {
+	stateRootKey, err := s.rootKey(db.StateTrie)
+	if err != nil {
+		return nil, err
+	}
+
+	classesRootKey, err := s.rootKey(db.ClassesTrie)
+	if err != nil {
+		return nil, err
+	}
+	return &RootKeyCheckpoint{
+		stateRootKey:   stateRootKey,
+		classesRootKey: classesRootKey,
+	}, nil
+}
+
+// RestoreRootKeys points the global state trie and the classes trie back to the root nodes captured
+// in the checkpoint.
+//
+// Only the root keys are restored. Trie nodes are stored by their path and updated in place, and
+// the root keys of contract storage tries are not captured, so the state is only back to where it
+// was if the underlying database restores the rest of the data, e.g. because the changes made since
+// the checkpoint were written to a batch or an overlay that is discarded.
+func (s *State) RestoreRootKeys(checkpoint *RootKeyCheckpoint) error {
+	if err := s.setRootKey(db.StateTrie, checkpoint.stateRootKey); err != nil {
+		return err
+	}
+	return s.setRootKey(db.ClassesTrie, checkpoint.classesRootKey)
+}
+
+// rootKey returns the encoded root key of the global trie in bucket, or nil if the trie is empty
+func (s *State) rootKey(bucket db.Bucket) ([]byte, error) {
+	var rootKey []byte
+	err := s.txn.Get(bucket.Key(), func(val []byte) error {
+		rootKey = append([]byte{}, val...)
+		return nil
+	})
+	if err != nil && !errors.Is(err, db.ErrKeyNotFound) {
+		return nil, err
+	}
+	return rootKey, nil
+}
+
+func (s *State) setRootKey(bucket db.Bucket, rootKey []byte) error {
+	if rootKey == nil {
+		return s.txn.Delete(bucket.Key())
+	}
+	return s.txn.Set(bucket.Key(), rootKey)
+}
@@ -1,9 +1,12 @@
 package core
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"runtime"
+	"sort"
 
 	"github.com/NethermindEth/juno/core/crypto"
 	"github.com/NethermindEth/juno/core/felt"
@@ -11,6 +14,7 @@ import (
 	"github.com/NethermindEth/juno/db"
 	"github.com/NethermindEth/juno/encoder"
 	"github.com/bits-and-blooms/bitset"
+	"github.com/sourcegraph/conc/pool"
 )
 
 const globalTrieHeight = 251
@@ -42,29 +46,37 @@ type StateReader interface {
 type State struct {
 	*History
 	txn db.Transaction
+
+	// verifyCommitments makes the state recompute precomputed contract commitments, see
+	// [State.WithCommitmentVerification]
+	verifyCommitments bool
+	classLeafVersion  *felt.Felt
 }
 
-func NewState(txn db.Transaction) *State {
-	return &State{
-		History: NewHistory(txn),
-		txn:     txn,
+// StateOption configures a [State] created with [NewState]
+type StateOption func(*State)
+
+func NewState(txn db.Transaction, opts ...StateOption) *State {
+	s := &State{
+		History:          NewHistory(txn),
+		txn:              txn,
+		classLeafVersion: leafVersion,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 // putNewContract creates a contract storage instance in the state and stores the relation between contract address and class hash to be
-// queried later with [GetContractClass].
-func (s *State) putNewContract(stateTrie *trie.Trie, addr, classHash *felt.Felt, blockNumber uint64) error {
-	contract, err := DeployContract(addr, classHash, s.txn)
-	if err != nil {
+// queried later with [GetContractClass]. The contract commitment is not updated, see [State.updateContracts].
+func (s *State) putNewContract(addr, classHash *felt.Felt, blockNumber uint64) error {
+	if _, err := DeployContract(addr, classHash, s.txn); err != nil {
 		return err
 	}
 
 	numBytes := MarshalBlockNumber(blockNumber)
-	if err = s.txn.Set(db.ContractDeploymentHeight.Key(addr.Marshal()), numBytes); err != nil {
-		return err
-	}
-
-	return s.updateContractCommitment(stateTrie, contract)
+	return s.txn.Set(db.ContractDeploymentHeight.Key(addr.Marshal()), numBytes)
 }
 
 // ContractClassHash returns class hash of a contract at a given address.
@@ -76,6 +88,28 @@ func (s *State) ContractClassHash(addr *felt.Felt) (*felt.Felt, error) {
 	return contract.ClassHash()
 }
 
+// ContractsWithClass returns the addresses of the contracts that currently instantiate the class with the
+// given hash, sorted. The addresses are read from a reverse index of contract class hashes that is kept up to
+// date when contracts are deployed, replaced and purged, so the cost is proportional to the number of
+// matching contracts rather than to the number of contracts in the state.
+func (s *State) ContractsWithClass(classHash *felt.Felt) ([]*felt.Felt, error) {
+	it, err := s.txn.NewIterator()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := db.ContractAddressesByClassHash.Key(classHash.Marshal())
+	var addrs []*felt.Felt
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+		addrs = append(addrs, new(felt.Felt).SetBytes(key[len(prefix):]))
+	}
+	return addrs, it.Close()
+}
+
 // ContractNonce returns nonce of a contract at a given address.
 func (s *State) ContractNonce(addr *felt.Felt) (*felt.Felt, error) {
 	contract, err := NewContract(addr, s.txn)
@@ -95,41 +129,131 @@ func (s *State) ContractStorage(addr, key *felt.Felt) (*felt.Felt, error) {
 	return contract.Storage(key)
 }
 
+// ContractStorageProof returns the proof of the value of a key in the storage of the contract at the given address.
+func (s *State) ContractStorageProof(addr, key *felt.Felt) ([]trie.ProofNode, error) {
+	contract, err := NewContract(addr, s.txn)
+	if err != nil {
+		return nil, err
+	}
+
+	return contract.StorageProof(key)
+}
+
+// ProofSize returns the number of nodes in the proof of the contract at the given address in the
+// global state trie and in the proof of the key in the contract's storage trie. The proofs themselves
+// are not built. [ErrContractNotDeployed] is returned for contracts that are not deployed.
+func (s *State) ProofSize(addr, key *felt.Felt) (contractPathLen, storagePathLen int, err error) {
+	contract, err := NewContract(addr, s.txn)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	stateTrie, _, err := s.storage()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if contractPathLen, err = stateTrie.ProofLen(addr); err != nil {
+		return 0, 0, err
+	}
+
+	cStorage, err := storage(contract.Address, s.txn)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if storagePathLen, err = cStorage.ProofLen(key); err != nil {
+		return 0, 0, err
+	}
+	return contractPathLen, storagePathLen, nil
+}
+
 // Root returns the state commitment.
 func (s *State) Root() (*felt.Felt, error) {
-	var storageRoot, classesRoot *felt.Felt
+	_, _, stateRoot, err := s.Roots()
+	return stateRoot, err
+}
 
+// Roots returns the root of the global contracts trie, the root of the classes trie and the
+// state commitment that is derived from them.
+func (s *State) Roots() (storageRoot, classesRoot, stateRoot *felt.Felt, err error) {
 	sStorage, closer, err := s.storage()
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	if storageRoot, err = sStorage.Root(); err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	if err = closer(); err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	classes, closer, err := s.classesTrie()
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	if classesRoot, err = classes.Root(); err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	if err = closer(); err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
+	return storageRoot, classesRoot, StateCommitment(storageRoot, classesRoot), nil
+}
+
+// StateCommitment combines the root of the global contracts trie and the root of the classes trie
+// into the state commitment. Before any Cairo 1 class is declared the classes root is zero and the
+// state commitment is the root of the global contracts trie.
+func StateCommitment(storageRoot, classesRoot *felt.Felt) *felt.Felt {
 	if classesRoot.IsZero() {
-		return storageRoot, nil
+		return storageRoot
 	}
+	return crypto.PoseidonArray(stateVersion, storageRoot, classesRoot)
+}
+
+var ErrMismatchedRoot = errors.New("mismatched root")
+
+// RootMismatchError describes a root that doesn't match its expected value. It matches [ErrMismatchedRoot].
+type RootMismatchError struct {
+	// Root is one of "storage", "classes" or "state"
+	Root     string
+	Expected *felt.Felt
+	Actual   *felt.Felt
+}
 
-	return crypto.PoseidonArray(stateVersion, storageRoot, classesRoot), nil
+func (e *RootMismatchError) Error() string {
+	return fmt.Sprintf("%s root %s does not match the expected root %s", e.Root, e.Actual, e.Expected)
+}
+
+func (e *RootMismatchError) Is(target error) bool {
+	return target == ErrMismatchedRoot
+}
+
+// VerifyRoots checks the root of the global contracts trie, the root of the classes trie and the state
+// commitment against the expected values. Every mismatch is reported with a [RootMismatchError].
+func (s *State) VerifyRoots(expectedStorageRoot, expectedClassesRoot, expectedStateRoot *felt.Felt) error {
+	storageRoot, classesRoot, stateRoot, err := s.Roots()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, root := range []RootMismatchError{
+		{Root: "storage", Expected: expectedStorageRoot, Actual: storageRoot},
+		{Root: "classes", Expected: expectedClassesRoot, Actual: classesRoot},
+		{Root: "state", Expected: expectedStateRoot, Actual: stateRoot},
+	} {
+		if !root.Actual.Equal(root.Expected) {
+			root := root
+			errs = append(errs, &root)
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // storage returns a [core.Trie] that represents the Starknet global state in the given Txn context.
@@ -141,6 +265,20 @@ func (s *State) classesTrie() (*trie.Trie, func() error, error) {
 	return s.globalTrie(db.ClassesTrie, trie.NewTriePoseidon)
 }
 
+// StorageTrie returns the global state trie, which maps contract addresses to contract commitments,
+// for tooling that needs to traverse it directly. The returned closer must be called once the trie
+// is no longer used. The trie must only be read: the state is changed through [State.Update].
+func (s *State) StorageTrie() (*trie.Trie, func() error, error) {
+	return s.storage()
+}
+
+// ClassesTrieHandle returns the classes trie, which maps the hashes of Cairo 1 classes to their
+// leaves, for tooling that needs to traverse it directly. The same rules as for [State.StorageTrie]
+// apply.
+func (s *State) ClassesTrieHandle() (*trie.Trie, func() error, error) {
+	return s.classesTrie()
+}
+
 func (s *State) globalTrie(bucket db.Bucket, newTrie trie.NewTrieFunc) (*trie.Trie, func() error, error) {
 	dbPrefix := bucket.Key()
 	tTxn := trie.NewTransactionStorage(s.txn, dbPrefix)
@@ -189,16 +327,16 @@ func (s *State) globalTrie(bucket db.Bucket, newTrie trie.NewTrieFunc) (*trie.Tr
 	return gTrie, closer, nil
 }
 
-func (s *State) verifyStateUpdateRoot(root *felt.Felt) error {
+func (s *State) verifyStateUpdateRoot(root *felt.Felt) (*felt.Felt, error) {
 	currentRoot, err := s.Root()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if !root.Equal(currentRoot) {
-		return fmt.Errorf("state's current root: %s does not match the expected root: %s", currentRoot, root)
+		return nil, fmt.Errorf("state's current root: %s does not match the expected root: %s", currentRoot, root)
 	}
-	return nil
+	return currentRoot, nil
 }
 
 // Update applies a StateUpdate to the State object. State is not
@@ -206,49 +344,143 @@ func (s *State) verifyStateUpdateRoot(root *felt.Felt) error {
 // old or new root does not match the state's old or new roots,
 // [ErrMismatchedRoot] is returned.
 func (s *State) Update(blockNumber uint64, update *StateUpdate, declaredClasses map[felt.Felt]Class) error {
-	err := s.verifyStateUpdateRoot(update.OldRoot)
-	if err != nil {
-		return err
+	_, _, err := s.UpdateReturningRoots(blockNumber, update, declaredClasses)
+	return err
+}
+
+// UpdateReturningRoots is like [State.Update] but also returns the state's roots before and
+// after the update, as verified against the update's old and new roots.
+func (s *State) UpdateReturningRoots(blockNumber uint64, update *StateUpdate,
+	declaredClasses map[felt.Felt]Class,
+) (oldRoot, newRoot *felt.Felt, err error) {
+	if oldRoot, err = s.verifyStateUpdateRoot(update.OldRoot); err != nil {
+		return nil, nil, err
+	}
+
+	if err = s.applyStateDiff(blockNumber, update.StateDiff, declaredClasses, nil, true); err != nil {
+		return nil, nil, err
+	}
+
+	if oldRoot.IsZero() && blockNumber > 0 {
+		// the state starts after genesis, there is no history of the blocks before
+		if err = s.setHistoryLowWaterMark(blockNumber); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if newRoot, err = s.verifyStateUpdateRoot(update.NewRoot); err != nil {
+		return nil, nil, err
+	}
+	return oldRoot, newRoot, nil
+}
+
+// Checkpoint is called by [State.UpdateBatch] after each block is applied, with the number
+// and the resulting root of that block. Returning an error aborts the batch.
+type Checkpoint func(blockNumber uint64, root *felt.Felt) error
+
+// UpdateBatch applies consecutive StateUpdates to the State, the first one at blockNumber.
+// declaredClasses is either nil or holds the classes declared in each update. If checkpoint is
+// not nil, it is called after every applied block.
+func (s *State) UpdateBatch(blockNumber uint64, updates []*StateUpdate, declaredClasses []map[felt.Felt]Class,
+	checkpoint Checkpoint,
+) error {
+	if declaredClasses != nil && len(declaredClasses) != len(updates) {
+		return fmt.Errorf("got %d declared class sets for %d state updates", len(declaredClasses), len(updates))
+	}
+
+	for i, update := range updates {
+		var classes map[felt.Felt]Class
+		if declaredClasses != nil {
+			classes = declaredClasses[i]
+		}
+
+		height := blockNumber + uint64(i)
+		if err := s.Update(height, update, classes); err != nil {
+			return fmt.Errorf("update state at block %d: %w", height, err)
+		}
+
+		if checkpoint != nil {
+			// Update makes sure that the state's root matches update.NewRoot
+			if err := checkpoint(height, update.NewRoot); err != nil {
+				return fmt.Errorf("checkpoint at block %d: %w", height, err)
+			}
+		}
+	}
+	return nil
+}
+
+// applyStateDiff registers the declared classes and applies the diff to the tries without
+// checking any roots. The commitments of the contracts in precomputed are taken from there, see
+// [State.ApplyDiffWithCommitments]. Changes are logged to the history only if logChanges is set.
+func (s *State) applyStateDiff(blockNumber uint64, diff *StateDiff, declaredClasses map[felt.Felt]Class,
+	precomputed map[felt.Felt]*felt.Felt, logChanges bool,
+) error {
+	compiledClassHashes := make(map[felt.Felt]*felt.Felt, len(diff.DeclaredV1Classes))
+	for _, declaredClass := range diff.DeclaredV1Classes {
+		compiledClassHashes[*declaredClass.ClassHash] = declaredClass.CompiledClassHash
 	}
 
 	// register declared classes mentioned in stateDiff.deployedContracts and stateDiff.declaredClasses
 	for cHash, class := range declaredClasses {
-		if err = s.putClass(&cHash, class, blockNumber); err != nil {
+		if err := s.putClass(&cHash, class, blockNumber, compiledClassHashes[cHash]); err != nil {
 			return err
 		}
 	}
 
-	if err = s.updateDeclaredClassesTrie(update.StateDiff.DeclaredV1Classes, false); err != nil {
+	if err := s.updateDeclaredClassesTrie(diff.DeclaredV1Classes, false); err != nil {
 		return err
 	}
 
+	// register deployed contracts, their commitments are computed together with the other touched contracts
+	for _, contract := range diff.DeployedContracts {
+		if err := s.putNewContract(contract.Address, contract.ClassHash, blockNumber); err != nil {
+			return err
+		}
+	}
+
 	stateTrie, storageCloser, err := s.storage()
 	if err != nil {
 		return err
 	}
 
-	// register deployed contracts
-	for _, contract := range update.StateDiff.DeployedContracts {
-		if err = s.putNewContract(stateTrie, contract.Address, contract.ClassHash, blockNumber); err != nil {
+	if err = s.updateContracts(stateTrie, blockNumber, diff, precomputed, logChanges); err != nil {
+		return err
+	}
+
+	if logChanges {
+		if err = s.putStorageWriteCount(blockNumber, diff); err != nil {
+			return err
+		}
+		if err = s.putDiffHash(blockNumber, diff); err != nil {
 			return err
 		}
 	}
 
-	if err = s.updateContracts(stateTrie, blockNumber, update.StateDiff, true); err != nil {
-		return err
-	}
+	return storageCloser()
+}
 
-	if err = storageCloser(); err != nil {
-		return err
+// ProjectRoot returns the state commitment that would result from applying the given diff
+// and classes to the current state. The diff is applied to an in-memory overlay which is
+// discarded afterwards, so the state is left untouched.
+func (s *State) ProjectRoot(diff *StateDiff, classes map[felt.Felt]Class) (*felt.Felt, error) {
+	overlayTxn := db.NewOverlayTransaction(s.txn)
+	overlay := s.withTxn(overlayTxn)
+
+	// block number is irrelevant for the commitment and nothing is logged to the history
+	if err := overlay.applyStateDiff(0, diff, classes, nil, false); err != nil {
+		return nil, db.CloseAndWrapOnError(overlayTxn.Discard, err)
 	}
 
-	return s.verifyStateUpdateRoot(update.NewRoot)
+	root, err := overlay.Root()
+	return root, db.CloseAndWrapOnError(overlayTxn.Discard, err)
 }
 
-func (s *State) updateContracts(stateTrie *trie.Trie, blockNumber uint64, diff *StateDiff, logChanges bool) error {
+func (s *State) updateContracts(stateTrie *trie.Trie, blockNumber uint64, diff *StateDiff,
+	precomputed map[felt.Felt]*felt.Felt, logChanges bool,
+) error {
 	// replace contract instances
 	for _, replace := range diff.ReplacedClasses {
-		oldClassHash, err := s.replaceContract(stateTrie, replace.Address, replace.ClassHash)
+		oldClassHash, err := s.replaceContract(replace.Address, replace.ClassHash)
 		if err != nil {
 			return err
 		}
@@ -262,7 +494,7 @@ func (s *State) updateContracts(stateTrie *trie.Trie, blockNumber uint64, diff *
 
 	// update contract nonces
 	for addr, nonce := range diff.Nonces {
-		oldNonce, err := s.updateContractNonce(stateTrie, &addr, nonce)
+		oldNonce, err := s.updateContractNonce(&addr, nonce)
 		if err != nil {
 			return err
 		}
@@ -274,25 +506,99 @@ func (s *State) updateContracts(stateTrie *trie.Trie, blockNumber uint64, diff *
 		}
 	}
 
-	// update contract storages
-	for addr, storageDiff := range diff.StorageDiffs {
-		onValueChanged := func(location, oldValue *felt.Felt) error {
-			if logChanges {
-				return s.LogContractStorage(&addr, location, oldValue, blockNumber)
-			}
-			return nil
-		}
+	// update contract storages and commitments
+	touched := touchedContracts(diff)
+	commitments, err := s.updateContractStoragesAndCommitments(touched, blockNumber, diff.StorageDiffs, precomputed,
+		logChanges)
+	if err != nil {
+		return err
+	}
 
-		if err := s.updateContractStorage(stateTrie, &addr, storageDiff, onValueChanged); err != nil {
+	for idx, addr := range touched {
+		if _, err = stateTrie.Put(addr, commitments[idx]); err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
-// replaceContract replaces the class that a contract at a given address instantiates
-func (s *State) replaceContract(stateTrie *trie.Trie, addr, classHash *felt.Felt) (*felt.Felt, error) {
+// touchedContracts returns the addresses of the contracts whose commitment is changed by the diff, sorted.
+// A contract that is touched in several ways, e.g. deployed and given storage and a nonce, is listed once
+// so that its commitment is only computed once.
+func touchedContracts(diff *StateDiff) []*felt.Felt {
+	addrSet := make(map[felt.Felt]struct{}, len(diff.DeployedContracts)+len(diff.StorageDiffs)+len(diff.Nonces)+
+		len(diff.ReplacedClasses))
+	for _, deployed := range diff.DeployedContracts {
+		addrSet[*deployed.Address] = struct{}{}
+	}
+	for addr := range diff.StorageDiffs {
+		addrSet[addr] = struct{}{}
+	}
+	for addr := range diff.Nonces {
+		addrSet[addr] = struct{}{}
+	}
+	for _, replace := range diff.ReplacedClasses {
+		addrSet[*replace.Address] = struct{}{}
+	}
+
+	addrs := make([]*felt.Felt, 0, len(addrSet))
+	for addr := range addrSet {
+		addr := addr
+		addrs = append(addrs, &addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return addrs[i].Cmp(addrs[j]) < 0
+	})
+	return addrs
+}
+
+// updateContractStoragesAndCommitments applies the storage diffs of the given contracts and returns their
+// new commitments, in the same order as addrs. The storage tries of different contracts are independent, so
+// contracts are processed concurrently and only access to the transaction is serialised. The commitments
+// found in precomputed are not computed, unless the state verifies them.
+func (s *State) updateContractStoragesAndCommitments(addrs []*felt.Felt, blockNumber uint64,
+	storageDiffs map[felt.Felt][]StorageDiff, precomputed map[felt.Felt]*felt.Felt, logChanges bool,
+) ([]*felt.Felt, error) {
+	syncTxn := db.NewSyncTransaction(s.txn)
+	history := NewHistory(syncTxn)
+
+	commitments := make([]*felt.Felt, len(addrs))
+	p := pool.New().WithErrors().WithMaxGoroutines(runtime.GOMAXPROCS(0))
+	for idx, addr := range addrs {
+		idx, addr := idx, addr
+		p.Go(func() error {
+			contract, err := NewContract(addr, syncTxn)
+			if err != nil {
+				return err
+			}
+
+			if storageDiff, found := storageDiffs[*addr]; found {
+				onValueChanged := func(location, oldValue *felt.Felt) error {
+					if logChanges {
+						return history.LogContractStorage(addr, location, oldValue, blockNumber)
+					}
+					return nil
+				}
+
+				if err = contract.UpdateStorage(storageDiff, onValueChanged); err != nil {
+					return err
+				}
+			}
+
+			commitments[idx], err = s.commitmentOf(contract, precomputed[*addr])
+			return err
+		})
+	}
+
+	if err := p.Wait(); err != nil {
+		return nil, err
+	}
+	return commitments, nil
+}
+
+// replaceContract replaces the class that a contract at a given address instantiates.
+// The contract commitment is not updated.
+func (s *State) replaceContract(addr, classHash *felt.Felt) (*felt.Felt, error) {
 	contract, err := NewContract(addr, s.txn)
 	if err != nil {
 		return nil, err
@@ -307,10 +613,6 @@ func (s *State) replaceContract(stateTrie *trie.Trie, addr, classHash *felt.Felt
 		return nil, err
 	}
 
-	if err = s.updateContractCommitment(stateTrie, contract); err != nil {
-		return nil, err
-	}
-
 	return oldClassHash, nil
 }
 
@@ -319,7 +621,10 @@ type DeclaredClass struct {
 	Class Class
 }
 
-func (s *State) putClass(classHash *felt.Felt, class Class, declaredAt uint64) error {
+// putClass stores the class with the given hash as declared at declaredAt, and records the declaration
+// with the compiled class hash of Cairo 1 classes in [db.ClassesByDeclarationHeight]. Classes that are
+// already stored keep their declaration height, see [State.removeDeclaredClasses].
+func (s *State) putClass(classHash *felt.Felt, class Class, declaredAt uint64, compiledClassHash *felt.Felt) error {
 	classKey := db.Class.Key(classHash.Marshal())
 
 	err := s.txn.Get(classKey, func(val []byte) error {
@@ -327,6 +632,14 @@ func (s *State) putClass(classHash *felt.Felt, class Class, declaredAt uint64) e
 	})
 
 	if errors.Is(err, db.ErrKeyNotFound) {
+		var declaration []byte
+		if class.Version() == 1 {
+			if compiledClassHash == nil {
+				return fmt.Errorf("compiled class hash of class %s is not in the state diff", classHash)
+			}
+			declaration = compiledClassHash.Marshal()
+		}
+
 		classEncoded, encErr := encoder.Marshal(DeclaredClass{
 			At:    declaredAt,
 			Class: class,
@@ -335,7 +648,10 @@ func (s *State) putClass(classHash *felt.Felt, class Class, declaredAt uint64) e
 			return encErr
 		}
 
-		return s.txn.Set(classKey, classEncoded)
+		if err = s.txn.Set(classKey, classEncoded); err != nil {
+			return err
+		}
+		return s.txn.Set(db.ClassesByDeclarationHeight.Key(MarshalBlockNumber(declaredAt), classHash.Marshal()), declaration)
 	}
 	return err
 }
@@ -354,24 +670,66 @@ func (s *State) Class(classHash *felt.Felt) (*DeclaredClass, error) {
 	return &class, nil
 }
 
-// updateContractStorage applies the diff set to the Trie of the
-// contract at the given address in the given Txn context.
-func (s *State) updateContractStorage(stateTrie *trie.Trie, addr *felt.Felt, diff []StorageDiff, onChanged OnValueChanged) error {
-	contract, err := NewContract(addr, s.txn)
+// ClassDeclarationHeight returns the number of the block that declared the class with the given hash.
+// [db.ErrKeyNotFound] is returned if the class is not declared.
+func (s *State) ClassDeclarationHeight(classHash *felt.Felt) (uint64, error) {
+	class, err := s.Class(classHash)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	return class.At, nil
+}
 
-	if err = contract.UpdateStorage(diff, onChanged); err != nil {
-		return err
+// Classes returns the class objects corresponding to the given class hashes, keyed by class hash.
+// The classes are read with a single iterator in key order, instead of a lookup per class. Classes
+// that are not declared are left out of the result if skipMissing is set, otherwise an error
+// wrapping [db.ErrKeyNotFound] is returned.
+func (s *State) Classes(classHashes []*felt.Felt, skipMissing bool) (map[felt.Felt]*DeclaredClass, error) {
+	keys := make([][]byte, len(classHashes))
+	for i, classHash := range classHashes {
+		keys[i] = db.Class.Key(classHash.Marshal())
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+
+	it, err := s.txn.NewIterator()
+	if err != nil {
+		return nil, err
 	}
 
-	return s.updateContractCommitment(stateTrie, contract)
+	prefixLen := len(db.Class.Key())
+	classes := make(map[felt.Felt]*DeclaredClass, len(classHashes))
+	for _, key := range keys {
+		classHash := new(felt.Felt).SetBytes(key[prefixLen:])
+		if _, found := classes[*classHash]; found {
+			continue
+		}
+
+		if !it.Seek(key) || !bytes.Equal(it.Key(), key) {
+			if skipMissing {
+				continue
+			}
+			return nil, db.CloseAndWrapOnError(it.Close, fmt.Errorf("class %s: %w", classHash, db.ErrKeyNotFound))
+		}
+
+		val, itErr := it.Value()
+		if itErr != nil {
+			return nil, db.CloseAndWrapOnError(it.Close, itErr)
+		}
+
+		class := new(DeclaredClass)
+		if err = encoder.Unmarshal(val, class); err != nil {
+			return nil, db.CloseAndWrapOnError(it.Close, err)
+		}
+		classes[*classHash] = class
+	}
+	return classes, it.Close()
 }
 
 // updateContractNonce updates nonce of the contract at the
-// given address in the given Txn context.
-func (s *State) updateContractNonce(stateTrie *trie.Trie, addr, nonce *felt.Felt) (*felt.Felt, error) {
+// given address in the given Txn context. The contract commitment is not updated.
+func (s *State) updateContractNonce(addr, nonce *felt.Felt) (*felt.Felt, error) {
 	contract, err := NewContract(addr, s.txn)
 	if err != nil {
 		return nil, err
@@ -386,34 +744,27 @@ func (s *State) updateContractNonce(stateTrie *trie.Trie, addr, nonce *felt.Felt
 		return nil, err
 	}
 
-	if err = s.updateContractCommitment(stateTrie, contract); err != nil {
-		return nil, err
-	}
-
 	return oldNonce, nil
 }
 
-// updateContractCommitment recalculates the contract commitment and updates its value in the global state Trie
-func (s *State) updateContractCommitment(stateTrie *trie.Trie, contract *Contract) error {
+// contractCommitment calculates the commitment of the contract from its storage root, class hash and nonce
+func contractCommitment(contract *Contract) (*felt.Felt, error) {
 	root, err := contract.Root()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	cHash, err := contract.ClassHash()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	nonce, err := contract.Nonce()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	commitment := calculateContractCommitment(root, cHash, nonce)
-
-	_, err = stateTrie.Put(contract.Address, commitment)
-	return err
+	return calculateContractCommitment(root, cHash, nonce), nil
 }
 
 func calculateContractCommitment(storageRoot, classHash, nonce *felt.Felt) *felt.Felt {
@@ -421,6 +772,9 @@ func calculateContractCommitment(storageRoot, classHash, nonce *felt.Felt) *felt
 }
 
 func (s *State) updateDeclaredClassesTrie(declaredClasses []DeclaredV1Class, revert bool) error {
+	if len(declaredClasses) == 0 {
+		return nil
+	}
 	classesTrie, classesCloser, err := s.classesTrie()
 	if err != nil {
 		return err
@@ -430,7 +784,7 @@ func (s *State) updateDeclaredClassesTrie(declaredClasses []DeclaredV1Class, rev
 		// https://docs.starknet.io/documentation/starknet_versions/upcoming_versions/#commitment
 		leafValue := &felt.Zero
 		if !revert {
-			leafValue = crypto.Poseidon(leafVersion, declaredClass.CompiledClassHash)
+			leafValue = s.classesTrieLeaf(declaredClass.CompiledClassHash)
 		}
 		if _, err = classesTrie.Put(declaredClass.ClassHash, leafValue); err != nil {
 			return err
@@ -456,12 +810,23 @@ func (s *State) ContractIsAlreadyDeployedAt(addr *felt.Felt, blockNumber uint64)
 }
 
 func (s *State) Revert(blockNumber uint64, update *StateUpdate) error {
-	err := s.verifyStateUpdateRoot(update.NewRoot)
+	_, err := s.verifyStateUpdateRoot(update.NewRoot)
 	if err != nil {
 		return err
 	}
 
-	if err = s.removeDeclaredClasses(update.StateDiff.DeclaredV0Classes, update.StateDiff.DeclaredV1Classes); err != nil {
+	if err = s.revertStateUpdate(blockNumber, update); err != nil {
+		return err
+	}
+
+	_, err = s.verifyStateUpdateRoot(update.OldRoot)
+	return err
+}
+
+// revertStateUpdate undoes the changes of the update applied at blockNumber without checking the roots
+func (s *State) revertStateUpdate(blockNumber uint64, update *StateUpdate) error {
+	err := s.removeDeclaredClasses(blockNumber, update.StateDiff)
+	if err != nil {
 		return err
 	}
 
@@ -481,7 +846,7 @@ func (s *State) Revert(blockNumber uint64, update *StateUpdate) error {
 		return err
 	}
 
-	if err = s.updateContracts(stateTrie, blockNumber, reversedDiff, false); err != nil {
+	if err = s.updateContracts(stateTrie, blockNumber, reversedDiff, nil, false); err != nil {
 		return err
 	}
 
@@ -496,23 +861,49 @@ func (s *State) Revert(blockNumber uint64, update *StateUpdate) error {
 		}
 	}
 
-	return s.verifyStateUpdateRoot(update.OldRoot)
+	if err = s.txn.Delete(db.StorageWritesByBlockNumber.Key(MarshalBlockNumber(blockNumber))); err != nil {
+		return err
+	}
+	return s.txn.Delete(db.StateDiffHashesByBlockNumber.Key(MarshalBlockNumber(blockNumber)))
 }
 
-func (s *State) removeDeclaredClasses(v0Classes []*felt.Felt, v1Classes []DeclaredV1Class) error {
+// removeDeclaredClasses removes the classes declared by the diff applied at blockNumber. Before
+// v0.9.0, the classes of deployed contracts were declared implicitly and are missing from the
+// declared classes of the diff, so they are removed too if they were stored at blockNumber.
+// Otherwise, they would keep their declaration height and [State.putClass] would skip them if they
+// were declared again.
+func (s *State) removeDeclaredClasses(blockNumber uint64, diff *StateDiff) error {
 	var classKeys [][]byte
 
-	for _, class := range v0Classes {
+	for _, class := range diff.DeclaredV0Classes {
 		classKeys = append(classKeys, db.Class.Key(class.Marshal()))
 	}
-	for _, class := range v1Classes {
+	for _, class := range diff.DeclaredV1Classes {
 		classKeys = append(classKeys, db.Class.Key(class.ClassHash.Marshal()))
 	}
+	for _, deployed := range diff.DeployedContracts {
+		declaredAt, err := s.ClassDeclarationHeight(deployed.ClassHash)
+		if errors.Is(err, db.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if declaredAt == blockNumber {
+			classKeys = append(classKeys, db.Class.Key(deployed.ClassHash.Marshal()))
+		}
+	}
 
+	prefixLen := len(db.Class.Key())
 	for _, key := range classKeys {
 		if err := s.txn.Delete(key); err != nil {
 			return err
 		}
+
+		declarationKey := db.ClassesByDeclarationHeight.Key(MarshalBlockNumber(blockNumber), key[prefixLen:])
+		if err := s.txn.Delete(declarationKey); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -615,3 +1006,107 @@ func (s *State) buildReverseDiff(blockNumber uint64, diff *StateDiff) (*StateDif
 
 	return &reversed, nil
 }
+
+var ErrReverseDiffMismatch = errors.New("reverse diff does not reconstruct the state")
+
+// VerifyReverseDiff checks that the reverse of the diff applied at blockNumber, as built from the
+// history logs, takes the state back to a point from which re-applying the diff reproduces the
+// current state commitment. The state must be at blockNumber. All changes are made to an in-memory
+// overlay which is discarded afterwards, so the state and its history are left untouched.
+func (s *State) VerifyReverseDiff(blockNumber uint64, diff *StateDiff) error {
+	postRoot, err := s.Root()
+	if err != nil {
+		return err
+	}
+
+	overlayTxn := db.NewOverlayTransaction(s.txn)
+	overlay := s.withTxn(overlayTxn)
+	root, err := overlay.reverseAndReapply(blockNumber, diff)
+	if err = db.CloseAndWrapOnError(overlayTxn.Discard, err); err != nil {
+		return err
+	}
+
+	if !root.Equal(postRoot) {
+		return fmt.Errorf("%w at block %d: expected root %s, got %s", ErrReverseDiffMismatch, blockNumber, postRoot, root)
+	}
+	return nil
+}
+
+var ErrRevertRangeMismatch = errors.New("reverting the range does not restore the prior root")
+
+// VerifyRevertRange checks that reverting the updates of the blocks up to topBlock, ordered by block
+// number with updates[len(updates)-1] applied at topBlock, takes the state back to the OldRoot of
+// updates[0]. The state must be at topBlock. The roots are checked after every reverted block, so
+// the first block whose revert diverges is reported. All changes are made to an in-memory overlay
+// which is discarded afterwards, so the state and its history are left untouched.
+func (s *State) VerifyRevertRange(updates []*StateUpdate, topBlock uint64) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	if uint64(len(updates)) > topBlock+1 {
+		return fmt.Errorf("%d updates do not fit below block %d", len(updates), topBlock)
+	}
+
+	if _, err := s.verifyStateUpdateRoot(updates[len(updates)-1].NewRoot); err != nil {
+		return err
+	}
+
+	overlayTxn := db.NewOverlayTransaction(s.txn)
+	overlay := s.withTxn(overlayTxn)
+	err := overlay.revertRange(updates, topBlock)
+	return db.CloseAndWrapOnError(overlayTxn.Discard, err)
+}
+
+// revertRange reverts the updates from the one applied at topBlock down, checking the root after each
+func (s *State) revertRange(updates []*StateUpdate, topBlock uint64) error {
+	for i := len(updates) - 1; i >= 0; i-- {
+		blockNumber := topBlock - uint64(len(updates)-1-i)
+		if err := s.revertStateUpdate(blockNumber, updates[i]); err != nil {
+			return fmt.Errorf("revert block %d: %w", blockNumber, err)
+		}
+
+		root, err := s.Root()
+		if err != nil {
+			return err
+		}
+		if !root.Equal(updates[i].OldRoot) {
+			return fmt.Errorf("%w at block %d: expected root %s, got %s", ErrRevertRangeMismatch, blockNumber,
+				updates[i].OldRoot, root)
+		}
+	}
+	return nil
+}
+
+// reverseAndReapply reverts the contract changes of the diff like [State.Revert] does, applies the
+// diff again and returns the resulting state commitment.
+func (s *State) reverseAndReapply(blockNumber uint64, diff *StateDiff) (*felt.Felt, error) {
+	reversedDiff, err := s.buildReverseDiff(blockNumber, diff)
+	if err != nil {
+		return nil, err
+	}
+
+	stateTrie, storageCloser, err := s.storage()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.updateContracts(stateTrie, blockNumber, reversedDiff, nil, false); err != nil {
+		return nil, err
+	}
+
+	if err = storageCloser(); err != nil {
+		return nil, err
+	}
+
+	for _, contract := range diff.DeployedContracts {
+		if err = s.purgeContract(contract.Address); err != nil {
+			return nil, err
+		}
+	}
+
+	// declared classes are left in place, re-adding them to the classes trie is a no-op
+	if err = s.applyStateDiff(blockNumber, diff, nil, nil, false); err != nil {
+		return nil, err
+	}
+	return s.Root()
+}
@@ -0,0 +1,42 @@
+package core
+
+import (
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// TouchedAddressesBloom returns a bloom filter of the addresses of all the contracts that the update
+// deploys, replaces the class of, or changes the nonce or storage of. The filter is sized for the
+// number of touched addresses so that it has the given false positive rate.
+//
+// Addresses are added in their [felt.Felt.Marshal] encoding, so a contract can be looked up with
+// filter.Test(addr.Marshal()).
+func (s *State) TouchedAddressesBloom(update *StateUpdate, falsePositiveRate float64) *bloom.BloomFilter {
+	diff := update.StateDiff
+	addrs := make(map[felt.Felt]struct{}, len(diff.DeployedContracts)+len(diff.ReplacedClasses)+
+		len(diff.Nonces)+len(diff.StorageDiffs))
+	for _, deployed := range diff.DeployedContracts {
+		addrs[*deployed.Address] = struct{}{}
+	}
+	for _, replaced := range diff.ReplacedClasses {
+		addrs[*replaced.Address] = struct{}{}
+	}
+	for addr := range diff.Nonces {
+		addrs[addr] = struct{}{}
+	}
+	for addr := range diff.StorageDiffs {
+		addrs[addr] = struct{}{}
+	}
+
+	// an empty filter still needs room for a single element
+	numAddrs := uint(len(addrs))
+	if numAddrs == 0 {
+		numAddrs = 1
+	}
+
+	filter := bloom.NewWithEstimates(numAddrs, falsePositiveRate)
+	for addr := range addrs {
+		filter.Add(addr.Marshal())
+	}
+	return filter
+}
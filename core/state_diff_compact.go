@@ -0,0 +1,233 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// CompactEncode writes the diff to w in a compact binary format intended for network transmission.
+// Every felt is written as a uvarint length followed by its big-endian bytes without leading zeros,
+// and every collection is prefixed with its uvarint length. Entries are sorted so that equal diffs
+// always have the same encoding.
+//
+// Note that the order of the slices in the diff is not preserved.
+func (d *StateDiff) CompactEncode(w io.Writer) error {
+	cw := &compactWriter{w: w}
+
+	addrs := sortedFeltKeys(d.StorageDiffs)
+	cw.uvarint(uint64(len(addrs)))
+	for _, addr := range addrs {
+		addr := addr
+		diffs := append([]StorageDiff{}, d.StorageDiffs[addr]...)
+		sort.Slice(diffs, func(i, j int) bool {
+			return diffs[i].Key.Cmp(diffs[j].Key) < 0
+		})
+
+		cw.felt(&addr)
+		cw.uvarint(uint64(len(diffs)))
+		for _, diff := range diffs {
+			cw.felt(diff.Key)
+			cw.felt(diff.Value)
+		}
+	}
+
+	addrs = sortedFeltKeys(d.Nonces)
+	cw.uvarint(uint64(len(addrs)))
+	for _, addr := range addrs {
+		addr := addr
+		cw.felt(&addr)
+		cw.felt(d.Nonces[addr])
+	}
+
+	deployed := append([]DeployedContract{}, d.DeployedContracts...)
+	sort.Slice(deployed, func(i, j int) bool {
+		return deployed[i].Address.Cmp(deployed[j].Address) < 0
+	})
+	cw.uvarint(uint64(len(deployed)))
+	for _, contract := range deployed {
+		cw.felt(contract.Address)
+		cw.felt(contract.ClassHash)
+	}
+
+	v0Classes := append([]*felt.Felt{}, d.DeclaredV0Classes...)
+	sort.Slice(v0Classes, func(i, j int) bool {
+		return v0Classes[i].Cmp(v0Classes[j]) < 0
+	})
+	cw.uvarint(uint64(len(v0Classes)))
+	for _, classHash := range v0Classes {
+		cw.felt(classHash)
+	}
+
+	v1Classes := append([]DeclaredV1Class{}, d.DeclaredV1Classes...)
+	sort.Slice(v1Classes, func(i, j int) bool {
+		return v1Classes[i].ClassHash.Cmp(v1Classes[j].ClassHash) < 0
+	})
+	cw.uvarint(uint64(len(v1Classes)))
+	for _, class := range v1Classes {
+		cw.felt(class.ClassHash)
+		cw.felt(class.CompiledClassHash)
+	}
+
+	replaced := append([]ReplacedClass{}, d.ReplacedClasses...)
+	sort.Slice(replaced, func(i, j int) bool {
+		return replaced[i].Address.Cmp(replaced[j].Address) < 0
+	})
+	cw.uvarint(uint64(len(replaced)))
+	for _, class := range replaced {
+		cw.felt(class.Address)
+		cw.felt(class.ClassHash)
+	}
+
+	return cw.err
+}
+
+// CompactDecode reads a diff written by [StateDiff.CompactEncode] from r into d.
+// It does not read past the end of the encoded diff.
+func (d *StateDiff) CompactDecode(r io.Reader) error {
+	cr := &compactReader{r: r}
+
+	numContracts := cr.uvarint()
+	d.StorageDiffs = make(map[felt.Felt][]StorageDiff)
+	for i := uint64(0); i < numContracts && cr.err == nil; i++ {
+		addr := cr.felt()
+		numDiffs := cr.uvarint()
+		var diffs []StorageDiff
+		for j := uint64(0); j < numDiffs && cr.err == nil; j++ {
+			diffs = append(diffs, StorageDiff{
+				Key:   cr.felt(),
+				Value: cr.felt(),
+			})
+		}
+		if cr.err == nil {
+			d.StorageDiffs[*addr] = diffs
+		}
+	}
+
+	numNonces := cr.uvarint()
+	d.Nonces = make(map[felt.Felt]*felt.Felt)
+	for i := uint64(0); i < numNonces && cr.err == nil; i++ {
+		addr := cr.felt()
+		nonce := cr.felt()
+		if cr.err == nil {
+			d.Nonces[*addr] = nonce
+		}
+	}
+
+	numDeployed := cr.uvarint()
+	d.DeployedContracts = nil
+	for i := uint64(0); i < numDeployed && cr.err == nil; i++ {
+		d.DeployedContracts = append(d.DeployedContracts, DeployedContract{
+			Address:   cr.felt(),
+			ClassHash: cr.felt(),
+		})
+	}
+
+	numV0Classes := cr.uvarint()
+	d.DeclaredV0Classes = nil
+	for i := uint64(0); i < numV0Classes && cr.err == nil; i++ {
+		d.DeclaredV0Classes = append(d.DeclaredV0Classes, cr.felt())
+	}
+
+	numV1Classes := cr.uvarint()
+	d.DeclaredV1Classes = nil
+	for i := uint64(0); i < numV1Classes && cr.err == nil; i++ {
+		d.DeclaredV1Classes = append(d.DeclaredV1Classes, DeclaredV1Class{
+			ClassHash:         cr.felt(),
+			CompiledClassHash: cr.felt(),
+		})
+	}
+
+	numReplaced := cr.uvarint()
+	d.ReplacedClasses = nil
+	for i := uint64(0); i < numReplaced && cr.err == nil; i++ {
+		d.ReplacedClasses = append(d.ReplacedClasses, ReplacedClass{
+			Address:   cr.felt(),
+			ClassHash: cr.felt(),
+		})
+	}
+
+	return cr.err
+}
+
+func sortedFeltKeys[V any](m map[felt.Felt]V) []felt.Felt {
+	keys := make([]felt.Felt, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Cmp(&keys[j]) < 0
+	})
+	return keys
+}
+
+// compactWriter writes the compact encoding and keeps the first error, so that callers can
+// check it once at the end.
+type compactWriter struct {
+	w       io.Writer
+	scratch [binary.MaxVarintLen64]byte
+	err     error
+}
+
+func (cw *compactWriter) write(b []byte) {
+	if cw.err == nil {
+		_, cw.err = cw.w.Write(b)
+	}
+}
+
+func (cw *compactWriter) uvarint(v uint64) {
+	n := binary.PutUvarint(cw.scratch[:], v)
+	cw.write(cw.scratch[:n])
+}
+
+func (cw *compactWriter) felt(f *felt.Felt) {
+	fBytes := f.Bytes()
+	trimmed := bytes.TrimLeft(fBytes[:], "\x00")
+	cw.uvarint(uint64(len(trimmed)))
+	cw.write(trimmed)
+}
+
+// compactReader reads the compact encoding byte by byte, so that it never consumes more than
+// the encoded diff from the underlying reader. It keeps the first error like [compactWriter].
+type compactReader struct {
+	r   io.Reader
+	one [1]byte
+	err error
+}
+
+func (cr *compactReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(cr.r, cr.one[:])
+	return cr.one[0], err
+}
+
+func (cr *compactReader) uvarint() uint64 {
+	if cr.err != nil {
+		return 0
+	}
+
+	var v uint64
+	v, cr.err = binary.ReadUvarint(cr)
+	return v
+}
+
+func (cr *compactReader) felt() *felt.Felt {
+	length := cr.uvarint()
+	if cr.err != nil {
+		return nil
+	}
+
+	if length > felt.Bytes {
+		cr.err = fmt.Errorf("felt length %d exceeds %d bytes", length, felt.Bytes)
+		return nil
+	}
+
+	var fBytes [felt.Bytes]byte
+	if _, cr.err = io.ReadFull(cr.r, fBytes[:length]); cr.err != nil {
+		return nil
+	}
+	return new(felt.Felt).SetBytes(fBytes[:length])
+}
@@ -0,0 +1,98 @@
+package core_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/NethermindEth/juno/clients/feeder"
+	"github.com/NethermindEth/juno/core"
+	adaptfeeder "github.com/NethermindEth/juno/starknetdata/feeder"
+	"github.com/NethermindEth/juno/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateDiffCompactEncoding(t *testing.T) {
+	tests := map[string]struct {
+		network     utils.Network
+		blockNumber uint64
+	}{
+		"mainnet 0": {
+			network:     utils.MAINNET,
+			blockNumber: 0,
+		},
+		"mainnet 21656": {
+			network:     utils.MAINNET,
+			blockNumber: 21656,
+		},
+		"integration 283364 with declared classes": {
+			network:     utils.INTEGRATION,
+			blockNumber: 283364,
+		},
+		"integration 283746 with replaced classes": {
+			network:     utils.INTEGRATION,
+			blockNumber: 283746,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			client, closeFn := feeder.NewTestClient(test.network)
+			t.Cleanup(closeFn)
+
+			gw := adaptfeeder.New(client)
+			su, err := gw.StateUpdate(context.Background(), test.blockNumber)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			require.NoError(t, su.StateDiff.CompactEncode(&buf))
+			encodedSize := buf.Len()
+
+			decoded := new(core.StateDiff)
+			require.NoError(t, decoded.CompactDecode(&buf))
+			assert.Zero(t, buf.Len())
+
+			require.Len(t, decoded.StorageDiffs, len(su.StateDiff.StorageDiffs))
+			for addr, diffs := range su.StateDiff.StorageDiffs {
+				assert.ElementsMatch(t, diffs, decoded.StorageDiffs[addr])
+			}
+			require.Len(t, decoded.Nonces, len(su.StateDiff.Nonces))
+			for addr, nonce := range su.StateDiff.Nonces {
+				assert.Equal(t, nonce, decoded.Nonces[addr])
+			}
+			assert.ElementsMatch(t, su.StateDiff.DeployedContracts, decoded.DeployedContracts)
+			assert.ElementsMatch(t, su.StateDiff.DeclaredV0Classes, decoded.DeclaredV0Classes)
+			assert.ElementsMatch(t, su.StateDiff.DeclaredV1Classes, decoded.DeclaredV1Classes)
+			assert.ElementsMatch(t, su.StateDiff.ReplacedClasses, decoded.ReplacedClasses)
+
+			// the same diff always has the same encoding
+			var reencoded bytes.Buffer
+			require.NoError(t, decoded.CompactEncode(&reencoded))
+			require.NoError(t, su.StateDiff.CompactEncode(&buf))
+			assert.Equal(t, buf.Bytes(), reencoded.Bytes())
+
+			feederSU, err := client.StateUpdate(context.Background(), strconv.FormatUint(test.blockNumber, 10))
+			require.NoError(t, err)
+			jsonDiff, err := json.Marshal(feederSU.StateDiff)
+			require.NoError(t, err)
+			assert.Less(t, encodedSize, len(jsonDiff))
+		})
+	}
+
+	t.Run("truncated input", func(t *testing.T) {
+		client, closeFn := feeder.NewTestClient(utils.MAINNET)
+		t.Cleanup(closeFn)
+
+		gw := adaptfeeder.New(client)
+		su, err := gw.StateUpdate(context.Background(), 0)
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, su.StateDiff.CompactEncode(&buf))
+		truncated := bytes.NewReader(buf.Bytes()[:buf.Len()/2])
+		require.Error(t, new(core.StateDiff).CompactDecode(truncated))
+	})
+}
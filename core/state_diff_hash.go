@@ -0,0 +1,97 @@
+package core
+
+import (
+	"sort"
+
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+)
+
+// StateDiffHash returns the Poseidon hash of the contents of the diff. Entries are sorted and every
+// collection is prefixed with its length, like in [StateDiff.CompactEncode], so that equal diffs
+// always have the same hash regardless of the order of their slices.
+func StateDiffHash(diff *StateDiff) *felt.Felt {
+	var elems []*felt.Felt
+	appendLen := func(n int) {
+		elems = append(elems, new(felt.Felt).SetUint64(uint64(n)))
+	}
+
+	addrs := sortedFeltKeys(diff.StorageDiffs)
+	appendLen(len(addrs))
+	for _, addr := range addrs {
+		addr := addr
+		storageDiffs := append([]StorageDiff{}, diff.StorageDiffs[addr]...)
+		sort.Slice(storageDiffs, func(i, j int) bool {
+			return storageDiffs[i].Key.Cmp(storageDiffs[j].Key) < 0
+		})
+
+		elems = append(elems, &addr)
+		appendLen(len(storageDiffs))
+		for _, storageDiff := range storageDiffs {
+			elems = append(elems, storageDiff.Key, storageDiff.Value)
+		}
+	}
+
+	addrs = sortedFeltKeys(diff.Nonces)
+	appendLen(len(addrs))
+	for _, addr := range addrs {
+		addr := addr
+		elems = append(elems, &addr, diff.Nonces[addr])
+	}
+
+	deployed := append([]DeployedContract{}, diff.DeployedContracts...)
+	sort.Slice(deployed, func(i, j int) bool {
+		return deployed[i].Address.Cmp(deployed[j].Address) < 0
+	})
+	appendLen(len(deployed))
+	for _, contract := range deployed {
+		elems = append(elems, contract.Address, contract.ClassHash)
+	}
+
+	v0Classes := append([]*felt.Felt{}, diff.DeclaredV0Classes...)
+	sort.Slice(v0Classes, func(i, j int) bool {
+		return v0Classes[i].Cmp(v0Classes[j]) < 0
+	})
+	appendLen(len(v0Classes))
+	elems = append(elems, v0Classes...)
+
+	v1Classes := append([]DeclaredV1Class{}, diff.DeclaredV1Classes...)
+	sort.Slice(v1Classes, func(i, j int) bool {
+		return v1Classes[i].ClassHash.Cmp(v1Classes[j].ClassHash) < 0
+	})
+	appendLen(len(v1Classes))
+	for _, class := range v1Classes {
+		elems = append(elems, class.ClassHash, class.CompiledClassHash)
+	}
+
+	replaced := append([]ReplacedClass{}, diff.ReplacedClasses...)
+	sort.Slice(replaced, func(i, j int) bool {
+		return replaced[i].Address.Cmp(replaced[j].Address) < 0
+	})
+	appendLen(len(replaced))
+	for _, class := range replaced {
+		elems = append(elems, class.Address, class.ClassHash)
+	}
+
+	return crypto.PoseidonArray(elems...)
+}
+
+// DiffHashAt returns the [StateDiffHash] of the diff that was applied at the block with the given
+// number, so that nodes can compare their blocks one by one to find where they diverge.
+// [db.ErrKeyNotFound] is returned for blocks that are not applied. The hashes of blocks applied before
+// they were kept are filled in by a migration.
+func (s *State) DiffHashAt(blockNumber uint64) (*felt.Felt, error) {
+	var hash *felt.Felt
+	err := s.txn.Get(db.StateDiffHashesByBlockNumber.Key(MarshalBlockNumber(blockNumber)), func(val []byte) error {
+		hash = new(felt.Felt).SetBytes(val)
+		return nil
+	})
+	return hash, err
+}
+
+// putDiffHash stores the hash of the diff applied at blockNumber
+func (s *State) putDiffHash(blockNumber uint64, diff *StateDiff) error {
+	hash := StateDiffHash(diff)
+	return s.txn.Set(db.StateDiffHashesByBlockNumber.Key(MarshalBlockNumber(blockNumber)), hash.Marshal())
+}
@@ -0,0 +1,206 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+)
+
+var ErrHistoryIncomplete = errors.New("history is incomplete for the requested range")
+
+// ExportedChange is a single entry written by [State.ExportChangesSince]. Key is the storage
+// location for storage changes and nil otherwise. Value is the value at the head of the state.
+type ExportedChange struct {
+	Kind    ContractChangeKind
+	Address *felt.Felt
+	Key     *felt.Felt
+	Value   *felt.Felt
+}
+
+// ExportChangesSince writes the current value of every storage location, nonce and class hash that
+// changed at or after sinceBlock to w. Contracts deployed at or after sinceBlock are exported with
+// their class hash. The changes are found by scanning the history logs, so the export is only
+// complete if the logs go back to sinceBlock, otherwise [ErrHistoryIncomplete] is returned.
+//
+// The output starts with the number of changes followed by the changes, sorted by address, kind and
+// key, in the same compact encoding as [StateDiff.CompactEncode]. Use [ReadExportedChanges] to decode it.
+func (s *State) ExportChangesSince(ctx context.Context, sinceBlock uint64, w io.Writer) error {
+	err := s.checkHistorySince(sinceBlock)
+	if err != nil {
+		return err
+	}
+
+	changed := make(map[string]ExportedChange)
+	addChange := func(kind ContractChangeKind, subKey []byte) {
+		change := ExportedChange{
+			Kind:    kind,
+			Address: new(felt.Felt).SetBytes(subKey[:felt.Bytes]),
+		}
+		if kind == StorageChange {
+			change.Key = new(felt.Felt).SetBytes(subKey[felt.Bytes:])
+		}
+		changed[string(append([]byte{byte(kind)}, subKey...))] = change
+	}
+
+	for kind, bucket := range map[ContractChangeKind]db.Bucket{
+		StorageChange:   db.ContractStorageHistory,
+		NonceChange:     db.ContractNonceHistory,
+		ClassHashChange: db.ContractClassHashHistory,
+	} {
+		if err = s.scanLogs(ctx, bucket.Key(), sinceBlock, func(subKey []byte) {
+			addChange(kind, subKey)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err = s.scanDeployments(ctx, atOrAfter(sinceBlock), func(addr []byte) {
+		addChange(ClassHashChange, addr)
+	}); err != nil {
+		return err
+	}
+
+	changes := make([]ExportedChange, 0, len(changed))
+	for _, change := range changed {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		if change.Value, err = s.headValue(&change); err != nil {
+			return err
+		}
+		changes = append(changes, change)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if cmp := changes[i].Address.Cmp(changes[j].Address); cmp != 0 {
+			return cmp < 0
+		}
+		if changes[i].Kind != changes[j].Kind {
+			return changes[i].Kind < changes[j].Kind
+		}
+		return changes[i].Kind == StorageChange && changes[i].Key.Cmp(changes[j].Key) < 0
+	})
+
+	cw := &compactWriter{w: w}
+	cw.uvarint(uint64(len(changes)))
+	for idx := range changes {
+		change := &changes[idx]
+		cw.uvarint(uint64(change.Kind))
+		cw.felt(change.Address)
+		if change.Kind == StorageChange {
+			cw.felt(change.Key)
+		}
+		cw.felt(change.Value)
+	}
+	return cw.err
+}
+
+// ReadExportedChanges decodes the output of [State.ExportChangesSince].
+func ReadExportedChanges(r io.Reader) ([]ExportedChange, error) {
+	cr := &compactReader{r: r}
+	count := cr.uvarint()
+	if cr.err != nil {
+		return nil, cr.err
+	}
+
+	var changes []ExportedChange
+	for i := uint64(0); i < count; i++ {
+		change := ExportedChange{
+			Kind: ContractChangeKind(cr.uvarint()),
+		}
+		if cr.err == nil && change.Kind > ClassHashChange {
+			return nil, fmt.Errorf("unknown change kind %d", change.Kind)
+		}
+
+		change.Address = cr.felt()
+		if change.Kind == StorageChange {
+			change.Key = cr.felt()
+		}
+		change.Value = cr.felt()
+		if cr.err != nil {
+			return nil, cr.err
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// scanLogs calls fn with the sub key of every log under prefix with a height of at least sinceBlock.
+func (s *State) scanLogs(ctx context.Context, prefix []byte, sinceBlock uint64, fn func(subKey []byte)) error {
+	it, err := s.txn.NewIterator()
+	if err != nil {
+		return err
+	}
+
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		if err = ctx.Err(); err != nil {
+			return db.CloseAndWrapOnError(it.Close, err)
+		}
+
+		key := it.Key()
+		if len(key) < len(prefix)+8 || !bytes.HasPrefix(key, prefix) {
+			break
+		}
+
+		if binary.BigEndian.Uint64(key[len(key)-8:]) >= sinceBlock {
+			fn(bytes.Clone(key[len(prefix) : len(key)-8]))
+		}
+	}
+	return it.Close()
+}
+
+// scanDeployments calls fn with the address of every contract whose deployment height matches.
+func (s *State) scanDeployments(ctx context.Context, match func(height uint64) bool, fn func(addr []byte)) error {
+	it, err := s.txn.NewIterator()
+	if err != nil {
+		return err
+	}
+
+	prefix := db.ContractDeploymentHeight.Key()
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		if err = ctx.Err(); err != nil {
+			return db.CloseAndWrapOnError(it.Close, err)
+		}
+
+		key := it.Key()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+
+		val, itErr := it.Value()
+		if itErr != nil {
+			return db.CloseAndWrapOnError(it.Close, itErr)
+		}
+
+		if match(binary.BigEndian.Uint64(val)) {
+			fn(bytes.Clone(key[len(prefix):]))
+		}
+	}
+	return it.Close()
+}
+
+// atOrAfter matches the heights from blockNumber on, for [State.scanDeployments]
+func atOrAfter(blockNumber uint64) func(height uint64) bool {
+	return func(height uint64) bool {
+		return height >= blockNumber
+	}
+}
+
+func (s *State) headValue(change *ExportedChange) (*felt.Felt, error) {
+	switch change.Kind {
+	case StorageChange:
+		return s.ContractStorage(change.Address, change.Key)
+	case NonceChange:
+		return s.ContractNonce(change.Address)
+	default:
+		return s.ContractClassHash(change.Address)
+	}
+}
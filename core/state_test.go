@@ -1,20 +1,27 @@
 package core_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
 	"reflect"
+	"sort"
 	"testing"
 
 	"github.com/NethermindEth/juno/clients/feeder"
 	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/crypto"
 	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/core/trie"
 	"github.com/NethermindEth/juno/db"
 	"github.com/NethermindEth/juno/db/pebble"
 	"github.com/NethermindEth/juno/encoder"
 	adaptfeeder "github.com/NethermindEth/juno/starknetdata/feeder"
 	"github.com/NethermindEth/juno/utils"
+	"github.com/bits-and-blooms/bloom/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -97,6 +104,133 @@ func TestUpdate(t *testing.T) {
 
 		require.NoError(t, state.Update(3, su, nil))
 		assert.NotEqual(t, su.NewRoot, su.OldRoot)
+
+		t.Run("state commitment of the sub-roots", func(t *testing.T) {
+			storageRoot, classesRoot, _, err := state.Roots()
+			require.NoError(t, err)
+			require.False(t, classesRoot.IsZero())
+
+			// the storage root is left unchanged by the declared class
+			assert.Equal(t, su2.NewRoot, storageRoot)
+			assert.Equal(t, utils.HexToFelt(t, "0x46f1033cfb8e0b2e16e1ad6f95c41fd3a123f168fe72665452b6cddbc1d8e7a"),
+				core.StateCommitment(storageRoot, classesRoot))
+			assert.Equal(t, su2.NewRoot, core.StateCommitment(su2.NewRoot, new(felt.Felt)))
+		})
+	})
+}
+
+func TestProjectRoot(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	state := core.NewState(txn)
+
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+
+	su1, err := gw.StateUpdate(context.Background(), 1)
+	require.NoError(t, err)
+
+	t.Run("empty state", func(t *testing.T) {
+		projected, err := state.ProjectRoot(su0.StateDiff, nil)
+		require.NoError(t, err)
+		assert.Equal(t, su0.NewRoot, projected)
+
+		root, err := state.Root()
+		require.NoError(t, err)
+		assert.Equal(t, &felt.Zero, root)
+	})
+
+	t.Run("non-empty state", func(t *testing.T) {
+		require.NoError(t, state.Update(0, su0, nil))
+
+		projected, err := state.ProjectRoot(su1.StateDiff, nil)
+		require.NoError(t, err)
+		assert.Equal(t, su1.NewRoot, projected)
+
+		root, err := state.Root()
+		require.NoError(t, err)
+		assert.Equal(t, su0.NewRoot, root)
+
+		require.NoError(t, state.Update(1, su1, nil))
+	})
+}
+
+func TestUpdateBatch(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	var updates []*core.StateUpdate
+	for i := uint64(0); i < 3; i++ {
+		su, err := gw.StateUpdate(context.Background(), i)
+		require.NoError(t, err)
+		updates = append(updates, su)
+	}
+
+	t.Run("checkpoint is called after each block", func(t *testing.T) {
+		testDB := pebble.NewMemTest()
+		txn := testDB.NewTransaction(true)
+		t.Cleanup(func() {
+			require.NoError(t, txn.Discard())
+		})
+
+		state := core.NewState(txn)
+
+		var checkpoints []uint64
+		require.NoError(t, state.UpdateBatch(0, updates, nil, func(blockNumber uint64, root *felt.Felt) error {
+			assert.Equal(t, updates[blockNumber].NewRoot, root)
+			checkpoints = append(checkpoints, blockNumber)
+			return nil
+		}))
+		assert.Equal(t, []uint64{0, 1, 2}, checkpoints)
+
+		root, err := state.Root()
+		require.NoError(t, err)
+		assert.Equal(t, updates[2].NewRoot, root)
+	})
+
+	t.Run("checkpoint error aborts the batch", func(t *testing.T) {
+		testDB := pebble.NewMemTest()
+		txn := testDB.NewTransaction(true)
+		t.Cleanup(func() {
+			require.NoError(t, txn.Discard())
+		})
+
+		state := core.NewState(txn)
+
+		checkpointErr := errors.New("checkpoint failed")
+		err := state.UpdateBatch(0, updates, nil, func(blockNumber uint64, _ *felt.Felt) error {
+			if blockNumber == 1 {
+				return checkpointErr
+			}
+			return nil
+		})
+		require.ErrorIs(t, err, checkpointErr)
+
+		root, err := state.Root()
+		require.NoError(t, err)
+		assert.Equal(t, updates[1].NewRoot, root)
+	})
+
+	t.Run("mismatching declared classes", func(t *testing.T) {
+		testDB := pebble.NewMemTest()
+		txn := testDB.NewTransaction(true)
+		t.Cleanup(func() {
+			require.NoError(t, txn.Discard())
+		})
+
+		state := core.NewState(txn)
+		require.Error(t, state.UpdateBatch(0, updates, []map[felt.Felt]core.Class{nil}, nil))
 	})
 }
 
@@ -268,6 +402,230 @@ func TestStateHistory(t *testing.T) {
 	})
 }
 
+func TestContractHistory(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+
+	contractAddr := utils.HexToFelt(t, "0x20cfa74ee3564b4cd5435cdace0f9c4d43b939620e4a0bb5076105df0a626c6")
+	changedLoc := utils.HexToFelt(t, "0x5")
+	su := &core.StateUpdate{
+		NewRoot: utils.HexToFelt(t, "0xac747e0ea7497dad7407ecf2baf24b1598b0b40943207fc9af8ded09a64f1c"),
+		OldRoot: su0.NewRoot,
+		StateDiff: &core.StateDiff{
+			StorageDiffs: map[felt.Felt][]core.StorageDiff{
+				*contractAddr: {
+					{
+						Key:   changedLoc,
+						Value: utils.HexToFelt(t, "0x44"),
+					},
+				},
+			},
+		},
+	}
+	require.NoError(t, state.Update(1, su, nil))
+
+	locChanges := func(timeline *core.ContractTimeline) []core.ContractChange {
+		var changes []core.ContractChange
+		for _, change := range timeline.Changes {
+			if change.Kind == core.StorageChange && change.Key.Equal(changedLoc) {
+				changes = append(changes, change)
+			}
+		}
+		return changes
+	}
+
+	t.Run("full history", func(t *testing.T) {
+		timeline, err := state.ContractHistory(contractAddr)
+		require.NoError(t, err)
+		assert.Equal(t, contractAddr, timeline.Address)
+
+		for i := 1; i < len(timeline.Changes); i++ {
+			assert.LessOrEqual(t, timeline.Changes[i-1].BlockNumber, timeline.Changes[i].BlockNumber)
+		}
+
+		assert.Equal(t, []core.ContractChange{
+			{
+				BlockNumber: 0,
+				Kind:        core.StorageChange,
+				Key:         changedLoc,
+				OldValue:    &felt.Zero,
+				NewValue:    utils.HexToFelt(t, "0x22b"),
+			},
+			{
+				BlockNumber: 1,
+				Kind:        core.StorageChange,
+				Key:         changedLoc,
+				OldValue:    utils.HexToFelt(t, "0x22b"),
+				NewValue:    utils.HexToFelt(t, "0x44"),
+			},
+		}, locChanges(timeline))
+	})
+
+	t.Run("block range", func(t *testing.T) {
+		timeline, err := state.ContractHistoryInRange(contractAddr, 1, 1)
+		require.NoError(t, err)
+		require.Len(t, timeline.Changes, 1)
+		assert.Equal(t, uint64(1), timeline.Changes[0].BlockNumber)
+		assert.Equal(t, utils.HexToFelt(t, "0x44"), timeline.Changes[0].NewValue)
+	})
+
+	t.Run("range before a later change", func(t *testing.T) {
+		timeline, err := state.ContractHistoryInRange(contractAddr, 0, 0)
+		require.NoError(t, err)
+		for _, change := range timeline.Changes {
+			assert.Zero(t, change.BlockNumber)
+		}
+		assert.Equal(t, []core.ContractChange{{
+			BlockNumber: 0,
+			Kind:        core.StorageChange,
+			Key:         changedLoc,
+			OldValue:    &felt.Zero,
+			NewValue:    utils.HexToFelt(t, "0x22b"),
+		}}, locChanges(timeline))
+	})
+
+	t.Run("not deployed contract", func(t *testing.T) {
+		_, err := state.ContractHistory(utils.HexToFelt(t, "0xDEADBEEF"))
+		require.ErrorIs(t, err, core.ErrContractNotDeployed)
+	})
+}
+
+func TestStorageSlotHistory(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+
+	contractAddr := utils.HexToFelt(t, "0x20cfa74ee3564b4cd5435cdace0f9c4d43b939620e4a0bb5076105df0a626c6")
+	changedLoc := utils.HexToFelt(t, "0x5")
+	su := &core.StateUpdate{
+		NewRoot: utils.HexToFelt(t, "0xac747e0ea7497dad7407ecf2baf24b1598b0b40943207fc9af8ded09a64f1c"),
+		OldRoot: su0.NewRoot,
+		StateDiff: &core.StateDiff{
+			StorageDiffs: map[felt.Felt][]core.StorageDiff{
+				*contractAddr: {
+					{
+						Key:   changedLoc,
+						Value: utils.HexToFelt(t, "0x44"),
+					},
+				},
+			},
+		},
+	}
+	require.NoError(t, state.Update(1, su, nil))
+
+	tests := map[string]struct {
+		from, to uint64
+		want     []core.SlotValueAt
+	}{
+		"full history": {
+			from: 0,
+			to:   10,
+			want: []core.SlotValueAt{
+				{BlockNumber: 0, Value: utils.HexToFelt(t, "0x22b")},
+				{BlockNumber: 1, Value: utils.HexToFelt(t, "0x44")},
+			},
+		},
+		"value set before a later change": {
+			from: 0,
+			to:   0,
+			want: []core.SlotValueAt{{BlockNumber: 0, Value: utils.HexToFelt(t, "0x22b")}},
+		},
+		"latest value": {
+			from: 1,
+			to:   1,
+			want: []core.SlotValueAt{{BlockNumber: 1, Value: utils.HexToFelt(t, "0x44")}},
+		},
+		"not set in range": {
+			from: 2,
+			to:   10,
+		},
+	}
+
+	for desc, test := range tests {
+		test := test
+		t.Run(desc, func(t *testing.T) {
+			history, err := state.StorageSlotHistory(contractAddr, changedLoc, test.from, test.to)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, history)
+		})
+	}
+
+	t.Run("never set", func(t *testing.T) {
+		history, err := state.StorageSlotHistory(contractAddr, utils.HexToFelt(t, "0xDEADBEEF"), 0, 10)
+		require.NoError(t, err)
+		assert.Empty(t, history)
+	})
+
+	t.Run("invalid range", func(t *testing.T) {
+		_, err := state.StorageSlotHistory(contractAddr, changedLoc, 1, 0)
+		require.Error(t, err)
+	})
+}
+
+func TestProofSize(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+
+	t.Run("deployed contract", func(t *testing.T) {
+		addr := utils.HexToFelt(t, "0x20cfa74ee3564b4cd5435cdace0f9c4d43b939620e4a0bb5076105df0a626c6")
+		key := utils.HexToFelt(t, "0x5")
+
+		contractPathLen, storagePathLen, err := state.ProofSize(addr, key)
+		require.NoError(t, err)
+		assert.Positive(t, contractPathLen)
+		assert.Positive(t, storagePathLen)
+
+		proof, err := state.ContractStorageProof(addr, key)
+		require.NoError(t, err)
+		assert.Len(t, proof, storagePathLen)
+	})
+
+	t.Run("not deployed contract", func(t *testing.T) {
+		contractPathLen, storagePathLen, err := state.ProofSize(utils.HexToFelt(t, "0xDEADBEEF"), utils.HexToFelt(t, "0x5"))
+		require.ErrorIs(t, err, core.ErrContractNotDeployed)
+		assert.Zero(t, contractPathLen)
+		assert.Zero(t, storagePathLen)
+	})
+}
+
 func TestContractIsDeployedAt(t *testing.T) {
 	client, closeFn := feeder.NewTestClient(utils.MAINNET)
 	t.Cleanup(closeFn)
@@ -364,9 +722,26 @@ func TestClass(t *testing.T) {
 	require.NoError(t, err)
 	assert.Zero(t, gotCairo0Class.At)
 	assert.Equal(t, cairo0Class, gotCairo0Class.Class)
+
+	t.Run("batch", func(t *testing.T) {
+		missingHash := utils.HexToFelt(t, "0xDEADBEEF")
+		classes, err := state.Classes([]*felt.Felt{cairo1Hash, missingHash, cairo0Hash, cairo1Hash}, true)
+		require.NoError(t, err)
+		assert.Equal(t, map[felt.Felt]*core.DeclaredClass{
+			*cairo0Hash: gotCairo0Class,
+			*cairo1Hash: gotCairo1Class,
+		}, classes)
+
+		_, err = state.Classes([]*felt.Felt{cairo0Hash, missingHash}, false)
+		require.ErrorIs(t, err, db.ErrKeyNotFound)
+
+		classes, err = state.Classes(nil, false)
+		require.NoError(t, err)
+		assert.Empty(t, classes)
+	})
 }
 
-func TestRevert(t *testing.T) {
+func TestRevertableDepth(t *testing.T) {
 	testDB := pebble.NewMemTest()
 	txn := testDB.NewTransaction(true)
 	t.Cleanup(func() {
@@ -379,59 +754,302 @@ func TestRevert(t *testing.T) {
 	gw := adaptfeeder.New(client)
 
 	state := core.NewState(txn)
-	su0, err := gw.StateUpdate(context.Background(), 0)
-	require.NoError(t, err)
-	require.NoError(t, state.Update(0, su0, nil))
-	su1, err := gw.StateUpdate(context.Background(), 1)
-	require.NoError(t, err)
-	require.NoError(t, state.Update(1, su1, nil))
-
-	t.Run("revert a replaced class", func(t *testing.T) {
-		addr := su1.StateDiff.DeployedContracts[0].Address
-		replaceStateUpdate := &core.StateUpdate{
-			NewRoot: utils.HexToFelt(t, "0x30b1741b28893b892ac30350e6372eac3a6f32edee12f9cdca7fbe7540a5ee"),
-			OldRoot: su1.NewRoot,
-			StateDiff: &core.StateDiff{
-				ReplacedClasses: []core.ReplacedClass{
-					{
-						Address:   addr,
-						ClassHash: utils.HexToFelt(t, "0xDEADBEEF"),
-					},
-				},
-			},
-		}
 
-		require.NoError(t, state.Update(2, replaceStateUpdate, nil))
-		require.NoError(t, state.Revert(2, replaceStateUpdate))
-		classHash, sErr := state.ContractClassHash(addr)
-		require.NoError(t, sErr)
-		assert.Equal(t, su1.StateDiff.DeployedContracts[0].ClassHash, classHash)
+	t.Run("empty state", func(t *testing.T) {
+		_, ok, err := state.RevertableDepth()
+		require.NoError(t, err)
+		assert.False(t, ok)
 	})
 
-	t.Run("revert a nonce update", func(t *testing.T) {
-		addr := su1.StateDiff.DeployedContracts[0].Address
-		nonceStateUpdate := &core.StateUpdate{
-			NewRoot: utils.HexToFelt(t, "0x6683657d2b6797d95f318e7c6091dc2255de86b72023c15b620af12543eb62c"),
-			OldRoot: su1.NewRoot,
-			StateDiff: &core.StateDiff{
-				Nonces: map[felt.Felt]*felt.Felt{
-					*addr: utils.HexToFelt(t, "0xDEADBEEF"),
-				},
-			},
-		}
+	t.Run("state starting after genesis", func(t *testing.T) {
+		su0, err := gw.StateUpdate(context.Background(), 0)
+		require.NoError(t, err)
+		require.NoError(t, state.Update(5, su0, nil))
+		su1, err := gw.StateUpdate(context.Background(), 1)
+		require.NoError(t, err)
+		require.NoError(t, state.Update(6, su1, nil))
 
-		require.NoError(t, state.Update(2, nonceStateUpdate, nil))
-		require.NoError(t, state.Revert(2, nonceStateUpdate))
-		nonce, sErr := state.ContractNonce(addr)
-		require.NoError(t, sErr)
-		assert.Equal(t, &felt.Zero, nonce)
+		depth, ok, err := state.RevertableDepth()
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, uint64(5), depth)
 	})
+}
 
-	t.Run("revert declared classes", func(t *testing.T) {
-		classesM := make(map[felt.Felt]core.Class)
-		cairo0 := &core.Cairo0Class{
-			Abi:          json.RawMessage("some cairo 0 class abi"),
-			Externals:    []core.EntryPoint{{new(felt.Felt).SetBytes([]byte("e1")), new(felt.Felt).SetBytes([]byte("e2"))}},
+func TestPruneHistory(t *testing.T) {
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	updates := make([]*core.StateUpdate, 3)
+	for i := range updates {
+		var err error
+		updates[i], err = gw.StateUpdate(context.Background(), uint64(i))
+		require.NoError(t, err)
+		require.NoError(t, state.Update(uint64(i), updates[i], nil))
+	}
+
+	depth, ok, err := state.RevertableDepth()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Zero(t, depth)
+
+	require.NoError(t, state.PruneHistory(2))
+	depth, _, err = state.RevertableDepth()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), depth)
+
+	require.NoError(t, state.StorageChangesAt(1, func(_, _, _ *felt.Felt) error {
+		return errors.New("storage log of a pruned block")
+	}))
+	_, err = state.RootAt(0)
+	require.ErrorIs(t, err, core.ErrHistoryIncomplete)
+	root, err := state.RootAt(1)
+	require.NoError(t, err)
+	assert.Equal(t, updates[1].NewRoot, root)
+
+	t.Run("pruning below the mark does nothing", func(t *testing.T) {
+		require.NoError(t, state.PruneHistory(1))
+		depth, _, err := state.RevertableDepth()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), depth)
+	})
+
+	t.Run("blocks after the mark can be reverted", func(t *testing.T) {
+		require.NoError(t, state.Revert(2, updates[2]))
+		root, err := state.Root()
+		require.NoError(t, err)
+		assert.Equal(t, updates[1].NewRoot, root)
+	})
+}
+
+func TestRebuildClassesTrie(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	err := encoder.RegisterType(reflect.TypeOf(core.Cairo1Class{}))
+	if err != nil {
+		require.Contains(t, err.Error(), "already exists in TagSet")
+	}
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	var su2 *core.StateUpdate
+	for i := uint64(0); i < 3; i++ {
+		su2, err = gw.StateUpdate(context.Background(), i)
+		require.NoError(t, err)
+		require.NoError(t, state.Update(i, su2, nil))
+	}
+
+	classHash := utils.HexToFelt(t, "0xDEADBEEF")
+	su := &core.StateUpdate{
+		OldRoot: su2.NewRoot,
+		NewRoot: utils.HexToFelt(t, "0x46f1033cfb8e0b2e16e1ad6f95c41fd3a123f168fe72665452b6cddbc1d8e7a"),
+		StateDiff: &core.StateDiff{
+			DeclaredV1Classes: []core.DeclaredV1Class{
+				{
+					ClassHash:         classHash,
+					CompiledClassHash: utils.HexToFelt(t, "0xBEEFDEAD"),
+				},
+			},
+		},
+	}
+	require.NoError(t, state.Update(3, su, map[felt.Felt]core.Class{
+		*classHash: &core.Cairo1Class{SemanticVersion: "0.1.0"},
+	}))
+
+	// corrupt the classes trie
+	require.NoError(t, txn.Delete(db.ClassesTrie.Key()))
+	root, err := state.Root()
+	require.NoError(t, err)
+	require.NotEqual(t, su.NewRoot, root)
+
+	classesRoot, err := state.RebuildClassesTrie(context.Background())
+	require.NoError(t, err)
+	assert.False(t, classesRoot.IsZero())
+
+	root, err = state.Root()
+	require.NoError(t, err)
+	assert.Equal(t, su.NewRoot, root)
+
+	t.Run("for each declared class", func(t *testing.T) {
+		classesTrie, closer, err := state.ClassesTrieHandle()
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			require.NoError(t, closer())
+		})
+
+		calls := 0
+		require.NoError(t, state.ForEachDeclaredClass(func(gotClassHash, compiledClassHash *felt.Felt, at uint64) error {
+			calls++
+			assert.Equal(t, classHash, gotClassHash)
+			assert.Equal(t, utils.HexToFelt(t, "0xBEEFDEAD"), compiledClassHash)
+			assert.Equal(t, uint64(3), at)
+
+			leaf, err := classesTrie.Get(gotClassHash)
+			require.NoError(t, err)
+			assert.Equal(t, leaf, core.ClassesTrieLeaf(compiledClassHash))
+			return nil
+		}))
+		assert.Equal(t, 1, calls)
+
+		stopErr := errors.New("stop")
+		require.ErrorIs(t, state.ForEachDeclaredClass(func(*felt.Felt, *felt.Felt, uint64) error {
+			return stopErr
+		}), stopErr)
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := state.RebuildClassesTrie(ctx)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestClassesTrieDiff(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	err := encoder.RegisterType(reflect.TypeOf(core.Cairo1Class{}))
+	if err != nil {
+		require.Contains(t, err.Error(), "already exists in TagSet")
+	}
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	var su2 *core.StateUpdate
+	for i := uint64(0); i < 3; i++ {
+		su2, err = gw.StateUpdate(context.Background(), i)
+		require.NoError(t, err)
+		require.NoError(t, state.Update(i, su2, nil))
+	}
+
+	declared := core.DeclaredV1Class{
+		ClassHash:         utils.HexToFelt(t, "0xDEADBEEF"),
+		CompiledClassHash: utils.HexToFelt(t, "0xBEEFDEAD"),
+	}
+	su := &core.StateUpdate{
+		OldRoot: su2.NewRoot,
+		NewRoot: utils.HexToFelt(t, "0x46f1033cfb8e0b2e16e1ad6f95c41fd3a123f168fe72665452b6cddbc1d8e7a"),
+		StateDiff: &core.StateDiff{
+			DeclaredV1Classes: []core.DeclaredV1Class{declared},
+		},
+	}
+	require.NoError(t, state.Update(3, su, map[felt.Felt]core.Class{
+		*declared.ClassHash: &core.Cairo1Class{SemanticVersion: "0.1.0"},
+	}))
+
+	t.Run("empty trie", func(t *testing.T) {
+		diff, err := state.ClassesTrieDiff(new(felt.Felt))
+		require.NoError(t, err)
+		assert.Equal(t, []core.DeclaredV1Class{declared}, diff)
+	})
+
+	t.Run("current root", func(t *testing.T) {
+		classesRoot, err := state.RebuildClassesTrie(context.Background())
+		require.NoError(t, err)
+
+		diff, err := state.ClassesTrieDiff(classesRoot)
+		require.NoError(t, err)
+		assert.Empty(t, diff)
+	})
+
+	t.Run("unknown root", func(t *testing.T) {
+		_, err := state.ClassesTrieDiff(utils.HexToFelt(t, "0x1"))
+		require.ErrorIs(t, err, core.ErrUnknownClassesRoot)
+	})
+
+	// the state is left untouched
+	root, err := state.Root()
+	require.NoError(t, err)
+	assert.Equal(t, su.NewRoot, root)
+}
+
+func TestRevert(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+	su1, err := gw.StateUpdate(context.Background(), 1)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(1, su1, nil))
+
+	t.Run("revert a replaced class", func(t *testing.T) {
+		addr := su1.StateDiff.DeployedContracts[0].Address
+		replaceStateUpdate := &core.StateUpdate{
+			NewRoot: utils.HexToFelt(t, "0x30b1741b28893b892ac30350e6372eac3a6f32edee12f9cdca7fbe7540a5ee"),
+			OldRoot: su1.NewRoot,
+			StateDiff: &core.StateDiff{
+				ReplacedClasses: []core.ReplacedClass{
+					{
+						Address:   addr,
+						ClassHash: utils.HexToFelt(t, "0xDEADBEEF"),
+					},
+				},
+			},
+		}
+
+		require.NoError(t, state.Update(2, replaceStateUpdate, nil))
+		require.NoError(t, state.Revert(2, replaceStateUpdate))
+		classHash, sErr := state.ContractClassHash(addr)
+		require.NoError(t, sErr)
+		assert.Equal(t, su1.StateDiff.DeployedContracts[0].ClassHash, classHash)
+	})
+
+	t.Run("revert a nonce update", func(t *testing.T) {
+		addr := su1.StateDiff.DeployedContracts[0].Address
+		nonceStateUpdate := &core.StateUpdate{
+			NewRoot: utils.HexToFelt(t, "0x6683657d2b6797d95f318e7c6091dc2255de86b72023c15b620af12543eb62c"),
+			OldRoot: su1.NewRoot,
+			StateDiff: &core.StateDiff{
+				Nonces: map[felt.Felt]*felt.Felt{
+					*addr: utils.HexToFelt(t, "0xDEADBEEF"),
+				},
+			},
+		}
+
+		require.NoError(t, state.Update(2, nonceStateUpdate, nil))
+		require.NoError(t, state.Revert(2, nonceStateUpdate))
+		nonce, sErr := state.ContractNonce(addr)
+		require.NoError(t, sErr)
+		assert.Equal(t, &felt.Zero, nonce)
+	})
+
+	t.Run("revert declared classes", func(t *testing.T) {
+		classesM := make(map[felt.Felt]core.Class)
+		cairo0 := &core.Cairo0Class{
+			Abi:          json.RawMessage("some cairo 0 class abi"),
+			Externals:    []core.EntryPoint{{new(felt.Felt).SetBytes([]byte("e1")), new(felt.Felt).SetBytes([]byte("e2"))}},
 			L1Handlers:   []core.EntryPoint{{new(felt.Felt).SetBytes([]byte("l1")), new(felt.Felt).SetBytes([]byte("l2"))}},
 			Constructors: []core.EntryPoint{{new(felt.Felt).SetBytes([]byte("c1")), new(felt.Felt).SetBytes([]byte("c2"))}},
 			Program:      "some cairo 0 program",
@@ -520,3 +1138,2059 @@ func TestRevert(t *testing.T) {
 		}))
 	})
 }
+
+func TestExportChangesSince(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	var updates []*core.StateUpdate
+	for i := uint64(0); i < 3; i++ {
+		su, err := gw.StateUpdate(context.Background(), i)
+		require.NoError(t, err)
+		require.NoError(t, state.Update(i, su, nil))
+		updates = append(updates, su)
+	}
+
+	export := func(t *testing.T, sinceBlock uint64) []core.ExportedChange {
+		var buf bytes.Buffer
+		require.NoError(t, state.ExportChangesSince(context.Background(), sinceBlock, &buf))
+
+		changes, err := core.ReadExportedChanges(&buf)
+		require.NoError(t, err)
+		return changes
+	}
+
+	t.Run("changes since block 1", func(t *testing.T) {
+		changes := export(t, 1)
+		exported := make(map[string]*felt.Felt)
+		for _, change := range changes {
+			key := fmt.Sprint(change.Kind, change.Address, change.Key)
+			exported[key] = change.Value
+		}
+
+		for _, su := range updates[1:] {
+			for addr, diffs := range su.StateDiff.StorageDiffs {
+				for _, diff := range diffs {
+					if diff.Value.IsZero() {
+						continue
+					}
+					addr := addr
+					value, err := state.ContractStorage(&addr, diff.Key)
+					require.NoError(t, err)
+					assert.Equal(t, value, exported[fmt.Sprint(core.StorageChange, &addr, diff.Key)])
+				}
+			}
+
+			for _, deployed := range su.StateDiff.DeployedContracts {
+				assert.Equal(t, deployed.ClassHash, exported[fmt.Sprint(core.ClassHashChange, deployed.Address, (*felt.Felt)(nil))])
+			}
+		}
+
+		assert.Less(t, len(changes), len(export(t, 0)))
+	})
+
+	t.Run("no changes after head", func(t *testing.T) {
+		assert.Empty(t, export(t, 3))
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		require.ErrorIs(t, state.ExportChangesSince(ctx, 1, new(bytes.Buffer)), context.Canceled)
+	})
+}
+
+func TestVerifyReverseDiff(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+
+	su1, err := gw.StateUpdate(context.Background(), 1)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(1, su1, nil))
+
+	t.Run("reverse diff reconstructs the state", func(t *testing.T) {
+		require.NoError(t, state.VerifyReverseDiff(1, su1.StateDiff))
+
+		root, err := state.Root()
+		require.NoError(t, err)
+		assert.Equal(t, su1.NewRoot, root)
+	})
+
+	t.Run("tampered diff", func(t *testing.T) {
+		tampered := *su1.StateDiff
+		tampered.StorageDiffs = make(map[felt.Felt][]core.StorageDiff, len(su1.StateDiff.StorageDiffs))
+		tamperedOne := false
+		for addr, diffs := range su1.StateDiff.StorageDiffs {
+			diffs = append([]core.StorageDiff{}, diffs...)
+			if !tamperedOne {
+				diffs[0].Value = new(felt.Felt).Add(diffs[0].Value, new(felt.Felt).SetUint64(1))
+				tamperedOne = true
+			}
+			tampered.StorageDiffs[addr] = diffs
+		}
+
+		require.ErrorIs(t, state.VerifyReverseDiff(1, &tampered), core.ErrReverseDiffMismatch)
+	})
+
+	t.Run("history is left untouched", func(t *testing.T) {
+		require.NoError(t, state.Revert(1, su1))
+
+		root, err := state.Root()
+		require.NoError(t, err)
+		assert.Equal(t, su0.NewRoot, root)
+	})
+}
+
+// BenchmarkUpdateManyContracts measures the cost of applying a diff that touches many contracts.
+// Run it with e.g. `-cpu 1,4,8` to see how the contract commitments scale with the number of cores.
+func BenchmarkUpdateManyContracts(b *testing.B) {
+	const numContracts, keysPerContract = 200, 50
+
+	diff := &core.StateDiff{
+		StorageDiffs: make(map[felt.Felt][]core.StorageDiff, numContracts),
+	}
+	classHash := new(felt.Felt).SetUint64(1)
+	for i := uint64(0); i < numContracts; i++ {
+		addr := new(felt.Felt).SetUint64(1000 + i)
+		diff.DeployedContracts = append(diff.DeployedContracts, core.DeployedContract{
+			Address:   addr,
+			ClassHash: classHash,
+		})
+
+		storageDiffs := make([]core.StorageDiff, 0, keysPerContract)
+		for j := uint64(0); j < keysPerContract; j++ {
+			storageDiffs = append(storageDiffs, core.StorageDiff{
+				Key:   new(felt.Felt).SetUint64(j),
+				Value: new(felt.Felt).SetUint64(i*keysPerContract + j + 1),
+			})
+		}
+		diff.StorageDiffs[*addr] = storageDiffs
+	}
+
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	b.Cleanup(func() {
+		require.NoError(b, txn.Discard())
+	})
+	state := core.NewState(txn)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := state.ProjectRoot(diff, nil)
+		require.NoError(b, err)
+	}
+}
+
+func TestContractsWithClass(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+
+	expected := make(map[felt.Felt][]*felt.Felt)
+	for _, deployed := range su0.StateDiff.DeployedContracts {
+		expected[*deployed.ClassHash] = append(expected[*deployed.ClassHash], deployed.Address)
+	}
+
+	for classHash, addrs := range expected {
+		classHash := classHash
+		got, err := state.ContractsWithClass(&classHash)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, addrs, got)
+	}
+
+	t.Run("unknown class", func(t *testing.T) {
+		got, err := state.ContractsWithClass(utils.HexToFelt(t, "0xDEADBEEF"))
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("index is maintained on revert", func(t *testing.T) {
+		require.NoError(t, state.Revert(0, su0))
+
+		for classHash := range expected {
+			classHash := classHash
+			got, err := state.ContractsWithClass(&classHash)
+			require.NoError(t, err)
+			assert.Empty(t, got)
+		}
+	})
+}
+
+func TestNonExistenceProof(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	addr := utils.HexToFelt(t, "0xDEADBEEF")
+
+	t.Run("empty state", func(t *testing.T) {
+		proof, err := state.NonExistenceProof(addr)
+		require.NoError(t, err)
+		assert.Empty(t, proof)
+
+		verified, err := core.VerifyNonExistenceProof(new(felt.Felt), new(felt.Felt), addr, proof)
+		require.NoError(t, err)
+		assert.True(t, verified)
+	})
+
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+	_, classesRoot, _, err := state.Roots()
+	require.NoError(t, err)
+
+	deployed := su0.StateDiff.DeployedContracts[0].Address
+	// differs from a deployed contract only in the last bit, so the proof ends at the leaf of that contract
+	neighbour := new(felt.Felt).SetBigInt(new(big.Int).Xor(deployed.BigInt(new(big.Int)), big.NewInt(1)))
+
+	for desc, notDeployed := range map[string]*felt.Felt{
+		"empty subtree":   addr,
+		"existing branch": neighbour,
+	} {
+		notDeployed := notDeployed
+		t.Run(desc, func(t *testing.T) {
+			proof, err := state.NonExistenceProof(notDeployed)
+			require.NoError(t, err)
+			require.NotEmpty(t, proof)
+
+			verified, err := core.VerifyNonExistenceProof(su0.NewRoot, classesRoot, notDeployed, proof)
+			require.NoError(t, err)
+			assert.True(t, verified)
+
+			verified, err = core.VerifyNonExistenceProof(su0.OldRoot, classesRoot, notDeployed, proof)
+			require.NoError(t, err)
+			assert.False(t, verified)
+
+			verified, err = core.VerifyNonExistenceProof(su0.NewRoot, classesRoot, deployed, proof)
+			require.NoError(t, err)
+			assert.False(t, verified)
+		})
+	}
+
+	t.Run("deployed contract", func(t *testing.T) {
+		_, err := state.NonExistenceProof(deployed)
+		require.ErrorIs(t, err, core.ErrContractAlreadyDeployed)
+	})
+}
+
+func TestTrieHandles(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+
+	storageRoot, classesRoot, _, err := state.Roots()
+	require.NoError(t, err)
+
+	storageTrie, storageCloser, err := state.StorageTrie()
+	require.NoError(t, err)
+	root, err := storageTrie.Root()
+	require.NoError(t, err)
+	assert.Equal(t, storageRoot, root)
+
+	deployed := su0.StateDiff.DeployedContracts[0].Address
+	commitment, err := storageTrie.Get(deployed)
+	require.NoError(t, err)
+	assert.False(t, commitment.IsZero())
+	require.NoError(t, storageCloser())
+
+	classesTrie, classesCloser, err := state.ClassesTrieHandle()
+	require.NoError(t, err)
+	root, err = classesTrie.Root()
+	require.NoError(t, err)
+	assert.Equal(t, classesRoot, root)
+	require.NoError(t, classesCloser())
+
+	stateRoot, err := state.Root()
+	require.NoError(t, err)
+	assert.Equal(t, su0.NewRoot, stateRoot)
+}
+
+func TestVerifyStorageProofsBatch(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+
+	contractAddr := utils.HexToFelt(t, "0x20cfa74ee3564b4cd5435cdace0f9c4d43b939620e4a0bb5076105df0a626c6")
+	var claims []core.StorageClaim
+	for _, diff := range su0.StateDiff.StorageDiffs[*contractAddr] {
+		claim, err := state.StorageClaim(contractAddr, diff.Key)
+		require.NoError(t, err)
+		assert.Equal(t, diff.Value, claim.Value)
+		claims = append(claims, *claim)
+	}
+	require.Greater(t, len(claims), 1)
+
+	unsetClaim, err := state.StorageClaim(contractAddr, utils.HexToFelt(t, "0xDEADBEEF"))
+	require.NoError(t, err)
+	assert.True(t, unsetClaim.Value.IsZero())
+	claims = append(claims, *unsetClaim)
+
+	allValid := make([]bool, len(claims))
+	for i := range allValid {
+		allValid[i] = true
+	}
+
+	valid, err := core.VerifyStorageProofsBatch(su0.NewRoot, claims)
+	require.NoError(t, err)
+	assert.Equal(t, allValid, valid)
+
+	t.Run("wrong value", func(t *testing.T) {
+		tampered := append([]core.StorageClaim{}, claims...)
+		tampered[0].Value = new(felt.Felt).SetUint64(1)
+
+		expected := append([]bool{}, allValid...)
+		expected[0] = false
+
+		valid, err := core.VerifyStorageProofsBatch(su0.NewRoot, tampered)
+		require.NoError(t, err)
+		assert.Equal(t, expected, valid)
+	})
+
+	t.Run("wrong contract commitment", func(t *testing.T) {
+		tampered := append([]core.StorageClaim{}, claims...)
+		tampered[1].Nonce = new(felt.Felt).SetUint64(1)
+
+		expected := append([]bool{}, allValid...)
+		expected[1] = false
+
+		valid, err := core.VerifyStorageProofsBatch(su0.NewRoot, tampered)
+		require.NoError(t, err)
+		assert.Equal(t, expected, valid)
+	})
+
+	t.Run("wrong classes root", func(t *testing.T) {
+		tampered := append([]core.StorageClaim{}, claims...)
+		tampered[2].ClassesRoot = new(felt.Felt).SetUint64(1)
+
+		expected := append([]bool{}, allValid...)
+		expected[2] = false
+
+		valid, err := core.VerifyStorageProofsBatch(su0.NewRoot, tampered)
+		require.NoError(t, err)
+		assert.Equal(t, expected, valid)
+	})
+
+	t.Run("wrong state root", func(t *testing.T) {
+		valid, err := core.VerifyStorageProofsBatch(su0.OldRoot, claims)
+		require.ErrorIs(t, err, core.ErrNoStateTrieRoot)
+		assert.Equal(t, make([]bool, len(claims)), valid)
+	})
+}
+
+func TestPartialRootProof(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+
+	var addrs []*felt.Felt
+	for _, deployed := range su0.StateDiff.DeployedContracts {
+		addrs = append(addrs, deployed.Address)
+	}
+	notDeployed := utils.HexToFelt(t, "0xDEADBEEF")
+	addrs = append(addrs, notDeployed)
+
+	proof, err := state.PartialRootProof(addrs)
+	require.NoError(t, err)
+	require.Len(t, proof.Contracts, len(addrs))
+
+	verified, err := core.VerifyPartialProof(su0.NewRoot, proof)
+	require.NoError(t, err)
+	assert.True(t, verified)
+
+	t.Run("shared nodes are included once", func(t *testing.T) {
+		totalPathLen := 0
+		for _, contract := range proof.Contracts {
+			totalPathLen += len(contract.Path)
+		}
+		assert.Less(t, len(proof.Nodes), totalPathLen)
+	})
+
+	t.Run("not deployed contract has a zero commitment", func(t *testing.T) {
+		assert.True(t, proof.Contracts[len(addrs)-1].Commitment.IsZero())
+	})
+
+	t.Run("wrong commitment", func(t *testing.T) {
+		tampered := *proof
+		tampered.Contracts = append([]core.ContractProof{}, proof.Contracts...)
+		tampered.Contracts[0].Commitment = new(felt.Felt).SetUint64(1)
+
+		verified, err := core.VerifyPartialProof(su0.NewRoot, &tampered)
+		require.NoError(t, err)
+		assert.False(t, verified)
+	})
+
+	t.Run("wrong state root", func(t *testing.T) {
+		verified, err := core.VerifyPartialProof(new(felt.Felt).SetUint64(1), proof)
+		require.NoError(t, err)
+		assert.False(t, verified)
+	})
+}
+
+func TestShardCommitment(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+
+	storageRoot, classesRoot, _, err := state.Roots()
+	require.NoError(t, err)
+
+	addrs := []*felt.Felt{
+		su0.StateDiff.DeployedContracts[2].Address,
+		utils.HexToFelt(t, "0xDEADBEEF"),
+		su0.StateDiff.DeployedContracts[0].Address,
+	}
+	partialProof, err := state.PartialRootProof(addrs)
+	require.NoError(t, err)
+	commitments := make(map[felt.Felt]*felt.Felt)
+	for _, contract := range partialProof.Contracts {
+		commitments[*contract.Address] = contract.Commitment
+	}
+
+	commitment, nodes, err := state.ShardCommitment(addrs)
+	require.NoError(t, err)
+	assert.Equal(t, partialProof.Nodes, nodes)
+
+	verified, err := core.VerifyShardCommitment(su0.NewRoot, storageRoot, classesRoot, commitment, commitments, nodes)
+	require.NoError(t, err)
+	assert.True(t, verified)
+
+	t.Run("order of addresses doesn't matter", func(t *testing.T) {
+		reversed := []*felt.Felt{addrs[2], addrs[1], addrs[0]}
+		other, _, err := state.ShardCommitment(reversed)
+		require.NoError(t, err)
+		assert.Equal(t, commitment, other)
+	})
+
+	t.Run("wrong contract commitment", func(t *testing.T) {
+		tampered := make(map[felt.Felt]*felt.Felt)
+		for addr, c := range commitments {
+			tampered[addr] = c
+		}
+		tampered[*addrs[0]] = new(felt.Felt).SetUint64(1)
+
+		verified, err := core.VerifyShardCommitment(su0.NewRoot, storageRoot, classesRoot, commitment, tampered, nodes)
+		require.NoError(t, err)
+		assert.False(t, verified)
+
+		verified, err = core.VerifyShardCommitment(su0.NewRoot, storageRoot, classesRoot, core.ShardCommitmentOf(tampered), tampered, nodes)
+		require.NoError(t, err)
+		assert.False(t, verified)
+	})
+
+	t.Run("wrong state root", func(t *testing.T) {
+		verified, err := core.VerifyShardCommitment(new(felt.Felt).SetUint64(1), storageRoot, classesRoot, commitment, commitments, nodes)
+		require.NoError(t, err)
+		assert.False(t, verified)
+	})
+
+	t.Run("missing nodes", func(t *testing.T) {
+		// the paths end early, which is reported as an incomplete proof
+		verified, err := core.VerifyShardCommitment(su0.NewRoot, storageRoot, classesRoot, commitment, commitments, nodes[:1])
+		require.ErrorIs(t, err, trie.ErrIncompleteProof)
+		assert.False(t, verified)
+	})
+}
+
+func TestDiffTries(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	su1, err := gw.StateUpdate(context.Background(), 1)
+	require.NoError(t, err)
+
+	newTxn := func(t *testing.T) db.Transaction {
+		txn := pebble.NewMemTest().NewTransaction(true)
+		t.Cleanup(func() {
+			require.NoError(t, txn.Discard())
+		})
+		return txn
+	}
+
+	aTxn := newTxn(t)
+	require.NoError(t, core.NewState(aTxn).Update(0, su0, nil))
+
+	bTxn := newTxn(t)
+	bState := core.NewState(bTxn)
+	require.NoError(t, bState.Update(0, su0, nil))
+	require.NoError(t, bState.Update(1, su1, nil))
+
+	t.Run("identical states", func(t *testing.T) {
+		addrs, err := core.DiffTries(su0.NewRoot, su0.NewRoot, aTxn, aTxn)
+		require.NoError(t, err)
+		assert.Empty(t, addrs)
+	})
+
+	t.Run("contracts touched by a block", func(t *testing.T) {
+		touched := make(map[felt.Felt]struct{})
+		for addr := range su1.StateDiff.StorageDiffs {
+			touched[addr] = struct{}{}
+		}
+		for addr := range su1.StateDiff.Nonces {
+			touched[addr] = struct{}{}
+		}
+		for _, deployed := range su1.StateDiff.DeployedContracts {
+			touched[*deployed.Address] = struct{}{}
+		}
+
+		addrs, err := core.DiffTries(su0.NewRoot, su1.NewRoot, aTxn, bTxn)
+		require.NoError(t, err)
+		require.NotEmpty(t, addrs)
+		for _, addr := range addrs {
+			assert.Contains(t, touched, addr)
+		}
+	})
+
+	t.Run("unexpected root", func(t *testing.T) {
+		_, err := core.DiffTries(su1.NewRoot, su1.NewRoot, aTxn, bTxn)
+		assert.Error(t, err)
+	})
+}
+
+func TestUpdateReturningRoots(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	for i := uint64(0); i < 2; i++ {
+		su, err := gw.StateUpdate(context.Background(), i)
+		require.NoError(t, err)
+
+		oldRoot, newRoot, err := state.UpdateReturningRoots(i, su, nil)
+		require.NoError(t, err)
+		assert.Equal(t, su.OldRoot, oldRoot)
+		assert.Equal(t, su.NewRoot, newRoot)
+	}
+
+	t.Run("mismatched old root", func(t *testing.T) {
+		su, err := gw.StateUpdate(context.Background(), 1)
+		require.NoError(t, err)
+
+		oldRoot, newRoot, err := state.UpdateReturningRoots(2, su, nil)
+		require.Error(t, err)
+		assert.Nil(t, oldRoot)
+		assert.Nil(t, newRoot)
+	})
+}
+
+func TestVerifyRoots(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+
+	storageRoot, classesRoot, stateRoot, err := state.Roots()
+	require.NoError(t, err)
+	// no classes were declared, so the state commitment is the storage root
+	assert.Equal(t, su0.NewRoot, storageRoot)
+	assert.True(t, classesRoot.IsZero())
+	assert.Equal(t, su0.NewRoot, stateRoot)
+
+	require.NoError(t, state.VerifyRoots(su0.NewRoot, &felt.Zero, su0.NewRoot))
+
+	t.Run("mismatched classes root", func(t *testing.T) {
+		err := state.VerifyRoots(su0.NewRoot, new(felt.Felt).SetUint64(1), su0.NewRoot)
+		require.ErrorIs(t, err, core.ErrMismatchedRoot)
+
+		var mismatch *core.RootMismatchError
+		require.ErrorAs(t, err, &mismatch)
+		assert.Equal(t, "classes", mismatch.Root)
+		assert.True(t, mismatch.Actual.IsZero())
+	})
+}
+
+func TestTouchedAddressesBloom(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	su, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+
+	state := core.NewState(pebble.NewMemTest().NewTransaction(false))
+	filter := state.TouchedAddressesBloom(su, 0.01)
+
+	for _, deployed := range su.StateDiff.DeployedContracts {
+		assert.True(t, filter.Test(deployed.Address.Marshal()))
+	}
+	for addr := range su.StateDiff.StorageDiffs {
+		assert.True(t, filter.Test(addr.Marshal()))
+	}
+
+	t.Run("serialization round trip", func(t *testing.T) {
+		encoded, err := filter.MarshalBinary()
+		require.NoError(t, err)
+
+		decoded := new(bloom.BloomFilter)
+		require.NoError(t, decoded.UnmarshalBinary(encoded))
+		assert.True(t, filter.Equal(decoded))
+	})
+
+	t.Run("false positive rate", func(t *testing.T) {
+		strict := state.TouchedAddressesBloom(su, 0.0001)
+		assert.Greater(t, strict.Cap(), filter.Cap())
+
+		falsePositives := 0
+		for i := uint64(0); i < 10000; i++ {
+			if strict.Test(new(felt.Felt).SetUint64(1<<32 + i).Marshal()) {
+				falsePositives++
+			}
+		}
+		assert.Less(t, falsePositives, 10)
+	})
+
+	t.Run("empty diff", func(t *testing.T) {
+		empty := state.TouchedAddressesBloom(&core.StateUpdate{StateDiff: new(core.StateDiff)}, 0.01)
+		assert.False(t, empty.Test(new(felt.Felt).SetUint64(1).Marshal()))
+	})
+}
+
+func TestSeedGenesis(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+
+	// rebuild mainnet's genesis from its first state update
+	classes := make(map[felt.Felt]core.Class)
+	allocs := make([]core.GenesisContract, 0, len(su0.StateDiff.DeployedContracts))
+	for _, deployed := range su0.StateDiff.DeployedContracts {
+		classes[*deployed.ClassHash] = &core.Cairo0Class{Program: "program"}
+
+		storage := make(map[felt.Felt]*felt.Felt)
+		for _, diff := range su0.StateDiff.StorageDiffs[*deployed.Address] {
+			storage[*diff.Key] = diff.Value
+		}
+		allocs = append(allocs, core.GenesisContract{
+			Address:   deployed.Address,
+			ClassHash: deployed.ClassHash,
+			Nonce:     su0.StateDiff.Nonces[*deployed.Address],
+			Storage:   storage,
+		})
+	}
+
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+	state := core.NewState(txn)
+
+	root, err := state.SeedGenesis(allocs, classes)
+	require.NoError(t, err)
+	assert.Equal(t, su0.NewRoot, root)
+
+	for _, alloc := range allocs {
+		classHash, err := state.ContractClassHash(alloc.Address)
+		require.NoError(t, err)
+		assert.Equal(t, alloc.ClassHash, classHash)
+
+		deployed, err := state.ContractIsAlreadyDeployedAt(alloc.Address, 0)
+		require.NoError(t, err)
+		assert.True(t, deployed)
+
+		for key, value := range alloc.Storage {
+			key := key
+			got, err := state.ContractStorage(alloc.Address, &key)
+			require.NoError(t, err)
+			assert.Equal(t, value, got)
+		}
+
+		class, err := state.Class(alloc.ClassHash)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), class.At)
+	}
+
+	t.Run("genesis can be followed by regular updates", func(t *testing.T) {
+		su1, err := gw.StateUpdate(context.Background(), 1)
+		require.NoError(t, err)
+		require.NoError(t, state.Update(1, su1, nil))
+	})
+
+	t.Run("state must be empty", func(t *testing.T) {
+		_, err := state.SeedGenesis(nil, nil)
+		require.ErrorIs(t, err, core.ErrStateNotEmpty)
+	})
+
+	t.Run("undeclared class", func(t *testing.T) {
+		emptyState := core.NewState(pebble.NewMemTest().NewTransaction(true))
+		_, err := emptyState.SeedGenesis([]core.GenesisContract{{
+			Address:   new(felt.Felt).SetUint64(1),
+			ClassHash: new(felt.Felt).SetUint64(2),
+		}}, nil)
+		require.EqualError(t, err, "class 0x2 of genesis contract 0x1 is not declared")
+	})
+
+	t.Run("cairo 1 classes are rejected", func(t *testing.T) {
+		emptyState := core.NewState(pebble.NewMemTest().NewTransaction(true))
+		_, err := emptyState.SeedGenesis(nil, map[felt.Felt]core.Class{
+			*new(felt.Felt).SetUint64(2): &core.Cairo1Class{},
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestReconcile(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+	state := core.NewState(txn)
+
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+
+	t.Run("applied update is consistent", func(t *testing.T) {
+		report, err := state.Reconcile(su0)
+		require.NoError(t, err)
+		assert.True(t, report.Consistent())
+		assert.Positive(t, report.Checked)
+	})
+
+	t.Run("pending update is reported", func(t *testing.T) {
+		su1, err := gw.StateUpdate(context.Background(), 1)
+		require.NoError(t, err)
+
+		report, err := state.Reconcile(su1)
+		require.NoError(t, err)
+		require.False(t, report.Consistent())
+		for _, deployed := range su1.StateDiff.DeployedContracts {
+			assert.Contains(t, report.Discrepancies, core.Discrepancy{
+				Kind:     core.ClassHashChange,
+				Address:  deployed.Address,
+				Expected: deployed.ClassHash,
+			})
+		}
+	})
+
+	t.Run("diverged storage value", func(t *testing.T) {
+		addr := su0.StateDiff.DeployedContracts[0].Address
+		stored := su0.StateDiff.StorageDiffs[*addr][0]
+		wrong := new(felt.Felt).Add(stored.Value, new(felt.Felt).SetUint64(1))
+
+		report, err := state.Reconcile(&core.StateUpdate{
+			StateDiff: &core.StateDiff{
+				StorageDiffs: map[felt.Felt][]core.StorageDiff{
+					*addr: {{Key: stored.Key, Value: wrong}},
+				},
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Checked)
+		assert.Equal(t, []core.Discrepancy{{
+			Kind:     core.StorageChange,
+			Address:  addr,
+			Key:      stored.Key,
+			Expected: wrong,
+			Actual:   stored.Value,
+		}}, report.Discrepancies)
+	})
+}
+
+func TestContractStorageSize(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+	state := core.NewState(txn)
+
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+
+	expected := make([]core.ContractStorageUsage, 0, len(su0.StateDiff.DeployedContracts))
+	for _, deployed := range su0.StateDiff.DeployedContracts {
+		slots := make(map[felt.Felt]struct{})
+		for _, diff := range su0.StateDiff.StorageDiffs[*deployed.Address] {
+			if !diff.Value.IsZero() {
+				slots[*diff.Key] = struct{}{}
+			}
+		}
+
+		size, err := state.ContractStorageSize(deployed.Address)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(len(slots)), size)
+
+		expected = append(expected, core.ContractStorageUsage{Address: deployed.Address, Slots: size})
+	}
+
+	sort.Slice(expected, func(i, j int) bool {
+		if expected[i].Slots != expected[j].Slots {
+			return expected[i].Slots > expected[j].Slots
+		}
+		return expected[i].Address.Cmp(expected[j].Address) < 0
+	})
+
+	top, err := state.TopContractsByStorage(2)
+	require.NoError(t, err)
+	assert.Equal(t, expected[:2], top)
+
+	all, err := state.TopContractsByStorage(len(expected) + 1)
+	require.NoError(t, err)
+	assert.Equal(t, expected, all)
+
+	t.Run("contract not deployed", func(t *testing.T) {
+		_, err := state.ContractStorageSize(new(felt.Felt).SetUint64(1))
+		require.ErrorIs(t, err, core.ErrContractNotDeployed)
+	})
+}
+
+func TestRootAt(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+	state := core.NewState(txn)
+
+	var updates []*core.StateUpdate
+	for i := uint64(0); i < 3; i++ {
+		su, err := gw.StateUpdate(context.Background(), i)
+		require.NoError(t, err)
+		require.NoError(t, state.Update(i, su, nil))
+		updates = append(updates, su)
+	}
+
+	for i, su := range updates {
+		root, err := state.RootAt(uint64(i))
+		require.NoError(t, err)
+		assert.Equal(t, su.NewRoot, root, "block %d", i)
+	}
+
+	head, err := state.Root()
+	require.NoError(t, err)
+	assert.Equal(t, updates[2].NewRoot, head, "state must be left untouched")
+
+	t.Run("verify against L1 root", func(t *testing.T) {
+		require.NoError(t, state.VerifyAgainstL1Root(updates[1].NewRoot, 1))
+
+		err := state.VerifyAgainstL1Root(updates[2].NewRoot, 1)
+		require.ErrorIs(t, err, core.ErrMismatchedRoot)
+
+		var mismatch *core.RootMismatchError
+		require.ErrorAs(t, err, &mismatch)
+		assert.Equal(t, updates[1].NewRoot, mismatch.Actual)
+		assert.Equal(t, updates[2].NewRoot, mismatch.Expected)
+	})
+}
+
+func TestContractStorageRootAt(t *testing.T) {
+	// contracts deployed at block 0 of integration have their storage changed at block 1
+	client, closeFn := feeder.NewTestClient(utils.INTEGRATION)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+	state := core.NewState(txn)
+
+	// the reference state only has block 0 applied, to recompute the storage roots at that block
+	referenceTxn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, referenceTxn.Discard())
+	})
+
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+	require.NoError(t, core.NewState(referenceTxn).Update(0, su0, nil))
+
+	deployedAt0 := make(map[felt.Felt]struct{})
+	for _, deployed := range su0.StateDiff.DeployedContracts {
+		deployedAt0[*deployed.Address] = struct{}{}
+	}
+
+	su1, err := gw.StateUpdate(context.Background(), 1)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(1, su1, nil))
+
+	checked := 0
+	for addr := range su1.StateDiff.StorageDiffs {
+		addr := addr
+		if _, found := deployedAt0[addr]; !found {
+			continue
+		}
+
+		reference, err := core.NewContract(&addr, referenceTxn)
+		require.NoError(t, err)
+		expected, err := reference.Root()
+		require.NoError(t, err)
+
+		contract, err := core.NewContract(&addr, txn)
+		require.NoError(t, err)
+		head, err := contract.Root()
+		require.NoError(t, err)
+		require.NotEqual(t, expected, head)
+
+		root, err := state.ContractStorageRootAt(&addr, 0)
+		require.NoError(t, err)
+		assert.Equal(t, expected, root)
+
+		root, err = state.ContractStorageRootAt(&addr, 1)
+		require.NoError(t, err)
+		assert.Equal(t, head, root)
+
+		// the state is left untouched
+		root, err = contract.Root()
+		require.NoError(t, err)
+		assert.Equal(t, head, root)
+		checked++
+	}
+	require.NotZero(t, checked)
+
+	t.Run("contract deployed later", func(t *testing.T) {
+		for _, deployed := range su1.StateDiff.DeployedContracts {
+			if _, found := deployedAt0[*deployed.Address]; !found {
+				_, err := state.ContractStorageRootAt(deployed.Address, 0)
+				require.ErrorIs(t, err, core.ErrContractNotDeployed)
+				return
+			}
+		}
+	})
+
+	t.Run("unknown contract", func(t *testing.T) {
+		_, err := state.ContractStorageRootAt(utils.HexToFelt(t, "0xDEADBEEF"), 1)
+		require.ErrorIs(t, err, core.ErrContractNotDeployed)
+	})
+}
+
+func TestRootKeyCheckpoint(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+	state := core.NewState(txn)
+
+	emptyCheckpoint, err := state.SaveRootKeys()
+	require.NoError(t, err)
+
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+
+	t.Run("restore an empty state", func(t *testing.T) {
+		overlayTxn := db.NewOverlayTransaction(txn)
+		t.Cleanup(func() {
+			require.NoError(t, overlayTxn.Discard())
+		})
+		overlay := core.NewState(overlayTxn)
+
+		require.NoError(t, overlay.RestoreRootKeys(emptyCheckpoint))
+		root, err := overlay.Root()
+		require.NoError(t, err)
+		assert.True(t, root.IsZero())
+	})
+
+	checkpoint, err := state.SaveRootKeys()
+	require.NoError(t, err)
+
+	su1, err := gw.StateUpdate(context.Background(), 1)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(1, su1, nil))
+
+	require.NoError(t, state.RestoreRootKeys(checkpoint))
+	restored, err := state.SaveRootKeys()
+	require.NoError(t, err)
+	assert.Equal(t, checkpoint, restored)
+}
+
+func TestDeployedContractCommitment(t *testing.T) {
+	addr := new(felt.Felt).SetUint64(1)
+	classHash := new(felt.Felt).SetUint64(2)
+	key := new(felt.Felt).SetUint64(3)
+	value := new(felt.Felt).SetUint64(4)
+	nonce := new(felt.Felt).SetUint64(5)
+
+	// deploying a contract and touching it in the same block must give the same commitment
+	// as touching it in a later block
+	combined := core.NewState(pebble.NewMemTest().NewTransaction(true))
+	combinedRoot, err := combined.ProjectRoot(&core.StateDiff{
+		DeployedContracts: []core.DeployedContract{{Address: addr, ClassHash: classHash}},
+		StorageDiffs:      map[felt.Felt][]core.StorageDiff{*addr: {{Key: key, Value: value}}},
+		Nonces:            map[felt.Felt]*felt.Felt{*addr: nonce},
+	}, nil)
+	require.NoError(t, err)
+
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+	separate := core.NewState(txn)
+	deployRoot, err := separate.ProjectRoot(&core.StateDiff{
+		DeployedContracts: []core.DeployedContract{{Address: addr, ClassHash: classHash}},
+	}, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, separate.Update(0, &core.StateUpdate{
+		OldRoot: new(felt.Felt),
+		NewRoot: deployRoot,
+		StateDiff: &core.StateDiff{
+			DeployedContracts: []core.DeployedContract{{Address: addr, ClassHash: classHash}},
+		},
+	}, nil))
+
+	separateRoot, err := separate.ProjectRoot(&core.StateDiff{
+		StorageDiffs: map[felt.Felt][]core.StorageDiff{*addr: {{Key: key, Value: value}}},
+		Nonces:       map[felt.Felt]*felt.Felt{*addr: nonce},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, separateRoot, combinedRoot)
+	assert.NotEqual(t, deployRoot, combinedRoot)
+}
+
+func TestVerifyDeploymentConsistency(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+	state := core.NewState(txn)
+
+	for i := uint64(0); i < 2; i++ {
+		su, err := gw.StateUpdate(context.Background(), i)
+		require.NoError(t, err)
+		require.NoError(t, state.Update(i, su, nil))
+	}
+
+	orphans, err := state.VerifyDeploymentConsistency(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, orphans)
+
+	t.Run("orphans on both sides", func(t *testing.T) {
+		su0, err := gw.StateUpdate(context.Background(), 0)
+		require.NoError(t, err)
+
+		missingHeight := su0.StateDiff.DeployedContracts[0].Address
+		require.NoError(t, txn.Delete(db.ContractDeploymentHeight.Key(missingHeight.Marshal())))
+
+		missingCommitment := new(felt.Felt).SetUint64(1)
+		require.NoError(t, txn.Set(db.ContractDeploymentHeight.Key(missingCommitment.Marshal()), core.MarshalBlockNumber(1)))
+
+		orphans, err := state.VerifyDeploymentConsistency(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []*felt.Felt{missingCommitment, missingHeight}, orphans)
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := state.VerifyDeploymentConsistency(ctx)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestMissingClasses(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+	state := core.NewState(txn)
+
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+
+	classes := make(map[felt.Felt]core.Class)
+	for _, deployed := range su0.StateDiff.DeployedContracts {
+		classes[*deployed.ClassHash] = &core.Cairo0Class{Program: "program"}
+	}
+	expected := make([]*felt.Felt, 0, len(classes))
+	for classHash := range classes {
+		classHash := classHash
+		expected = append(expected, &classHash)
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		return expected[i].Cmp(expected[j]) < 0
+	})
+
+	missing, err := state.MissingClasses(su0)
+	require.NoError(t, err)
+	assert.Equal(t, expected, missing)
+
+	require.NoError(t, state.Update(0, su0, classes))
+
+	missing, err = state.MissingClasses(su0)
+	require.NoError(t, err)
+	assert.Empty(t, missing)
+
+	t.Run("replaced classes", func(t *testing.T) {
+		replacement := new(felt.Felt).SetUint64(1)
+		missing, err := state.MissingClasses(&core.StateUpdate{
+			StateDiff: &core.StateDiff{
+				ReplacedClasses: []core.ReplacedClass{{Address: su0.StateDiff.DeployedContracts[0].Address, ClassHash: replacement}},
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []*felt.Felt{replacement}, missing)
+	})
+}
+
+func TestStateUpdateForBlock(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+	state := core.NewState(txn)
+
+	var updates []*core.StateUpdate
+	for i := uint64(0); i < 3; i++ {
+		su, err := gw.StateUpdate(context.Background(), i)
+		require.NoError(t, err)
+		require.NoError(t, state.Update(i, su, nil))
+		updates = append(updates, su)
+	}
+
+	for i, want := range updates {
+		got, err := state.StateUpdateForBlock(uint64(i))
+		require.NoError(t, err)
+
+		assert.Equal(t, want.NewRoot, got.NewRoot, "block %d", i)
+		assert.Equal(t, want.OldRoot, got.OldRoot, "block %d", i)
+		assert.ElementsMatch(t, want.StateDiff.DeployedContracts, got.StateDiff.DeployedContracts, "block %d", i)
+		assert.ElementsMatch(t, want.StateDiff.ReplacedClasses, got.StateDiff.ReplacedClasses, "block %d", i)
+		assert.ElementsMatch(t, want.StateDiff.DeclaredV0Classes, got.StateDiff.DeclaredV0Classes, "block %d", i)
+		assert.ElementsMatch(t, want.StateDiff.DeclaredV1Classes, got.StateDiff.DeclaredV1Classes, "block %d", i)
+		assert.Len(t, got.StateDiff.Nonces, len(want.StateDiff.Nonces), "block %d", i)
+		for addr, nonce := range want.StateDiff.Nonces {
+			assert.Equal(t, nonce, got.StateDiff.Nonces[addr], "block %d", i)
+		}
+
+		require.Len(t, got.StateDiff.StorageDiffs, len(want.StateDiff.StorageDiffs), "block %d", i)
+		for addr, diffs := range want.StateDiff.StorageDiffs {
+			assert.ElementsMatch(t, diffs, got.StateDiff.StorageDiffs[addr], "block %d, contract %s", i, addr.String())
+		}
+	}
+
+	head, err := state.Root()
+	require.NoError(t, err)
+	assert.Equal(t, updates[2].NewRoot, head, "state must be left untouched")
+}
+
+func TestVerifyRevertRange(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+	state := core.NewState(txn)
+
+	var updates []*core.StateUpdate
+	for i := uint64(0); i < 3; i++ {
+		su, err := gw.StateUpdate(context.Background(), i)
+		require.NoError(t, err)
+		require.NoError(t, state.Update(i, su, nil))
+		updates = append(updates, su)
+	}
+
+	t.Run("reverting the range restores the prior root", func(t *testing.T) {
+		require.NoError(t, state.VerifyRevertRange(updates[1:], 2))
+		require.NoError(t, state.VerifyRevertRange(updates, 2))
+	})
+
+	t.Run("range must end at the head", func(t *testing.T) {
+		require.Error(t, state.VerifyRevertRange(updates[:2], 1))
+		require.Error(t, state.VerifyRevertRange(updates, 1))
+	})
+
+	t.Run("diverging revert", func(t *testing.T) {
+		tampered := *updates[2]
+		tampered.OldRoot = new(felt.Felt).Add(updates[2].OldRoot, new(felt.Felt).SetUint64(1))
+
+		err := state.VerifyRevertRange([]*core.StateUpdate{updates[1], &tampered}, 2)
+		require.ErrorIs(t, err, core.ErrRevertRangeMismatch)
+		assert.Contains(t, err.Error(), "block 2")
+	})
+
+	t.Run("state and history are left untouched", func(t *testing.T) {
+		root, err := state.Root()
+		require.NoError(t, err)
+		assert.Equal(t, updates[2].NewRoot, root)
+
+		require.NoError(t, state.Revert(2, updates[2]))
+		require.NoError(t, state.Revert(1, updates[1]))
+
+		root, err = state.Root()
+		require.NoError(t, err)
+		assert.Equal(t, updates[0].NewRoot, root)
+	})
+}
+
+func TestMultiContractProof(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+
+	storageRoot, _, _, err := state.Roots()
+	require.NoError(t, err)
+
+	var addrs []*felt.Felt
+	for _, deployed := range su0.StateDiff.DeployedContracts {
+		addrs = append(addrs, deployed.Address)
+	}
+	notDeployed := utils.HexToFelt(t, "0xDEADBEEF")
+	addrs = append(addrs, notDeployed)
+
+	sharedNodes, perContract, err := state.MultiContractProof(addrs)
+	require.NoError(t, err)
+	require.Len(t, perContract, len(addrs))
+
+	stateTrie, closer, err := state.StorageTrie()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, closer())
+	})
+
+	totalPathLen := 0
+	for _, addr := range addrs {
+		indices := perContract[*addr]
+		totalPathLen += len(indices)
+
+		proof := make([]trie.ProofNode, 0, len(indices))
+		for _, idx := range indices {
+			proof = append(proof, sharedNodes[idx])
+		}
+
+		independent, err := stateTrie.Prove(addr)
+		require.NoError(t, err)
+		assert.Equal(t, independent, proof, "contract %s", addr)
+
+		commitment, err := stateTrie.Get(addr)
+		require.NoError(t, err)
+		verified, err := trie.VerifyProofPedersen(storageRoot, addr, 251, commitment, proof)
+		require.NoError(t, err)
+		assert.True(t, verified, "contract %s", addr)
+	}
+	assert.Less(t, len(sharedNodes), totalPathLen, "shared nodes are included once")
+}
+
+func TestStorageWritesAtBlock(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+	state := core.NewState(txn)
+
+	_, err := state.StorageWritesAtBlock(0)
+	require.ErrorIs(t, err, db.ErrKeyNotFound)
+
+	var updates []*core.StateUpdate
+	for i := uint64(0); i < 2; i++ {
+		su, err := gw.StateUpdate(context.Background(), i)
+		require.NoError(t, err)
+		require.NoError(t, state.Update(i, su, nil))
+		updates = append(updates, su)
+	}
+
+	for i, su := range updates {
+		want := 0
+		for _, diffs := range su.StateDiff.StorageDiffs {
+			want += len(diffs)
+		}
+		assert.Equal(t, want, state.StorageWriteCount(su))
+
+		count, err := state.StorageWritesAtBlock(uint64(i))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(want), count, "block %d", i)
+	}
+
+	t.Run("revert removes the count", func(t *testing.T) {
+		require.NoError(t, state.Revert(1, updates[1]))
+
+		_, err := state.StorageWritesAtBlock(1)
+		require.ErrorIs(t, err, db.ErrKeyNotFound)
+
+		_, err = state.StorageWritesAtBlock(0)
+		require.NoError(t, err)
+	})
+}
+
+func TestEstimateUpdateCost(t *testing.T) {
+	addr1 := utils.HexToFelt(t, "0x1")
+	addr2 := utils.HexToFelt(t, "0x2")
+	addr3 := utils.HexToFelt(t, "0x3")
+	one := new(felt.Felt).SetUint64(1)
+
+	update := &core.StateUpdate{
+		StateDiff: &core.StateDiff{
+			DeployedContracts: []core.DeployedContract{{Address: addr1, ClassHash: one}},
+			StorageDiffs: map[felt.Felt][]core.StorageDiff{
+				*addr1: {{Key: one, Value: one}, {Key: addr2, Value: one}},
+				*addr2: {{Key: one, Value: one}},
+			},
+			Nonces:            map[felt.Felt]*felt.Felt{*addr2: one},
+			ReplacedClasses:   []core.ReplacedClass{{Address: addr3, ClassHash: one}},
+			DeclaredV0Classes: []*felt.Felt{one},
+			DeclaredV1Classes: []core.DeclaredV1Class{{ClassHash: addr2, CompiledClassHash: one}},
+		},
+	}
+
+	assert.Equal(t, core.UpdateCost{
+		DeployedContracts: 1,
+		DeclaredClasses:   2,
+		NonceUpdates:      1,
+		StorageWrites:     3,
+		ReplacedClasses:   1,
+		// 3 storage writes, 3 touched contracts and 1 Cairo 1 class
+		TriePuts: 7,
+	}, core.EstimateUpdateCost(update))
+
+	assert.Equal(t, core.UpdateCost{}, core.EstimateUpdateCost(&core.StateUpdate{StateDiff: new(core.StateDiff)}))
+}
+
+func TestClassDeclarationHeight(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+	state := core.NewState(txn)
+
+	err := encoder.RegisterType(reflect.TypeOf(&core.Cairo0Class{}))
+	if err != nil {
+		require.Contains(t, err.Error(), "already exists in TagSet")
+	}
+
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	su0Classes := make(map[felt.Felt]core.Class)
+	for _, deployed := range su0.StateDiff.DeployedContracts {
+		su0Classes[*deployed.ClassHash] = &core.Cairo0Class{Program: "program"}
+	}
+	require.NoError(t, state.Update(0, su0, su0Classes))
+
+	at, err := state.ClassDeclarationHeight(su0.StateDiff.DeployedContracts[0].ClassHash)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), at)
+
+	// before v0.9.0, deploying a contract declared its class implicitly
+	classHash := utils.HexToFelt(t, "0xDEADBEEF")
+	classes := map[felt.Felt]core.Class{*classHash: &core.Cairo0Class{Program: "program"}}
+	diff := &core.StateDiff{
+		DeployedContracts: []core.DeployedContract{{Address: utils.HexToFelt(t, "0xBEEF"), ClassHash: classHash}},
+	}
+	newRoot, err := state.ProjectRoot(diff, classes)
+	require.NoError(t, err)
+
+	declare := func(blockNumber uint64) *core.StateUpdate {
+		su := &core.StateUpdate{OldRoot: su0.NewRoot, NewRoot: newRoot, StateDiff: diff}
+		require.NoError(t, state.Update(blockNumber, su, classes))
+		return su
+	}
+
+	su1 := declare(1)
+	at, err = state.ClassDeclarationHeight(classHash)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), at)
+
+	require.NoError(t, state.Revert(1, su1))
+	_, err = state.ClassDeclarationHeight(classHash)
+	require.ErrorIs(t, err, db.ErrKeyNotFound)
+
+	t.Run("re-declared class gets the new height", func(t *testing.T) {
+		empty := &core.StateUpdate{OldRoot: su0.NewRoot, NewRoot: su0.NewRoot, StateDiff: new(core.StateDiff)}
+		require.NoError(t, state.Update(1, empty, nil))
+		declare(2)
+
+		at, err := state.ClassDeclarationHeight(classHash)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), at)
+	})
+
+	t.Run("classes declared earlier are kept on revert", func(t *testing.T) {
+		deployed := su0.StateDiff.DeployedContracts[0]
+		diff := &core.StateDiff{
+			DeployedContracts: []core.DeployedContract{{Address: utils.HexToFelt(t, "0xCAFE"), ClassHash: deployed.ClassHash}},
+		}
+		oldRoot, err := state.Root()
+		require.NoError(t, err)
+		newRoot, err := state.ProjectRoot(diff, nil)
+		require.NoError(t, err)
+
+		su3 := &core.StateUpdate{OldRoot: oldRoot, NewRoot: newRoot, StateDiff: diff}
+		require.NoError(t, state.Update(3, su3, nil))
+		require.NoError(t, state.Revert(3, su3))
+
+		at, err := state.ClassDeclarationHeight(deployed.ClassHash)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), at)
+	})
+}
+
+func TestCommitmentSnapshot(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+	state := core.NewState(txn)
+
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+
+	snapshot, err := state.CommitmentSnapshot()
+	require.NoError(t, err)
+	assert.Equal(t, su0.NewRoot, snapshot.StateRoot)
+	assert.Equal(t, uint64(len(su0.StateDiff.DeployedContracts)), snapshot.ContractCount)
+	assert.Zero(t, snapshot.ClassCount)
+	require.NoError(t, state.VerifyCommitmentSnapshot(snapshot))
+
+	t.Run("missing contract", func(t *testing.T) {
+		addr := su0.StateDiff.DeployedContracts[0].Address
+		key := db.ContractDeploymentHeight.Key(addr.Marshal())
+		require.NoError(t, txn.Delete(key))
+		t.Cleanup(func() {
+			require.NoError(t, txn.Set(key, core.MarshalBlockNumber(0)))
+		})
+
+		err := state.VerifyCommitmentSnapshot(snapshot)
+		require.ErrorIs(t, err, core.ErrCommitmentSnapshotMismatch)
+		assert.Contains(t, err.Error(), "contract count")
+	})
+
+	t.Run("state moved on", func(t *testing.T) {
+		su1, err := gw.StateUpdate(context.Background(), 1)
+		require.NoError(t, err)
+		require.NoError(t, state.Update(1, su1, nil))
+
+		err = state.VerifyCommitmentSnapshot(snapshot)
+		require.ErrorIs(t, err, core.ErrCommitmentSnapshotMismatch)
+		assert.Contains(t, err.Error(), "state root")
+	})
+}
+
+func TestTrieDepthHistogram(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+	state := core.NewState(txn)
+
+	histogram, err := state.TrieDepthHistogram(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, histogram)
+
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+
+	want := make(map[int]uint64)
+	for _, deployed := range su0.StateDiff.DeployedContracts {
+		depth, _, err := state.ProofSize(deployed.Address, new(felt.Felt))
+		require.NoError(t, err)
+		want[depth]++
+	}
+
+	histogram, err = state.TrieDepthHistogram(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, want, histogram)
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := state.TrieDepthHistogram(ctx)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestApplyDiffWithCommitments(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+
+	newState := func(t *testing.T) (*core.State, db.Transaction) {
+		txn := pebble.NewMemTest().NewTransaction(true)
+		t.Cleanup(func() {
+			require.NoError(t, txn.Discard())
+		})
+		return core.NewState(txn), txn
+	}
+
+	// compute the commitments in a separate state, like a pipeline stage would
+	reference, referenceTxn := newState(t)
+	require.NoError(t, reference.Update(0, su0, nil))
+
+	precomputed := make(map[felt.Felt]*felt.Felt)
+	for _, deployed := range su0.StateDiff.DeployedContracts {
+		contract, err := core.NewContract(deployed.Address, referenceTxn)
+		require.NoError(t, err)
+		root, err := contract.Root()
+		require.NoError(t, err)
+		nonce, err := contract.Nonce()
+		require.NoError(t, err)
+		precomputed[*deployed.Address] = crypto.Pedersen(crypto.Pedersen(crypto.Pedersen(deployed.ClassHash, root), nonce),
+			&felt.Zero)
+	}
+
+	t.Run("precomputed commitments", func(t *testing.T) {
+		state, _ := newState(t)
+		root, err := state.ApplyDiffWithCommitments(0, su0.StateDiff, precomputed, nil)
+		require.NoError(t, err)
+		assert.Equal(t, su0.NewRoot, root)
+	})
+
+	wrong := make(map[felt.Felt]*felt.Felt, len(precomputed))
+	for addr, commitment := range precomputed {
+		wrong[addr] = commitment
+	}
+	wrongAddr := *su0.StateDiff.DeployedContracts[0].Address
+	wrong[wrongAddr] = new(felt.Felt).SetUint64(1)
+
+	t.Run("wrong commitments are trusted", func(t *testing.T) {
+		state, _ := newState(t)
+		root, err := state.ApplyDiffWithCommitments(0, su0.StateDiff, wrong, nil)
+		require.NoError(t, err)
+		assert.NotEqual(t, su0.NewRoot, root)
+	})
+
+	t.Run("verified commitments", func(t *testing.T) {
+		state, _ := newState(t)
+		state = state.WithCommitmentVerification()
+
+		root, err := state.ApplyDiffWithCommitments(0, su0.StateDiff, precomputed, nil)
+		require.NoError(t, err)
+		assert.Equal(t, su0.NewRoot, root)
+
+		state, _ = newState(t)
+		_, err = state.WithCommitmentVerification().ApplyDiffWithCommitments(0, su0.StateDiff, wrong, nil)
+		require.ErrorIs(t, err, core.ErrCommitmentMismatch)
+		assert.Contains(t, err.Error(), wrongAddr.String())
+	})
+}
+
+func TestNonceProof(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+	state := core.NewState(txn)
+
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+	_, classesRoot, _, err := state.Roots()
+	require.NoError(t, err)
+
+	addr := su0.StateDiff.DeployedContracts[0].Address
+	proof, nonce, classHash, storageRoot, err := state.NonceProof(addr)
+	require.NoError(t, err)
+
+	wantNonce, err := state.ContractNonce(addr)
+	require.NoError(t, err)
+	assert.Equal(t, wantNonce, nonce)
+	wantClassHash, err := state.ContractClassHash(addr)
+	require.NoError(t, err)
+	assert.Equal(t, wantClassHash, classHash)
+	wantStorageRoot, err := state.ContractStorageRootAt(addr, 0)
+	require.NoError(t, err)
+	assert.Equal(t, wantStorageRoot, storageRoot)
+
+	verified, err := core.VerifyNonceProof(su0.NewRoot, classesRoot, addr, nonce, classHash, storageRoot, proof)
+	require.NoError(t, err)
+	assert.True(t, verified)
+
+	t.Run("wrong nonce", func(t *testing.T) {
+		wrongNonce := new(felt.Felt).Add(nonce, new(felt.Felt).SetUint64(1))
+		verified, err := core.VerifyNonceProof(su0.NewRoot, classesRoot, addr, wrongNonce, classHash, storageRoot, proof)
+		require.NoError(t, err)
+		assert.False(t, verified)
+	})
+
+	t.Run("wrong class hash", func(t *testing.T) {
+		wrongClassHash := new(felt.Felt).Add(classHash, new(felt.Felt).SetUint64(1))
+		verified, err := core.VerifyNonceProof(su0.NewRoot, classesRoot, addr, nonce, wrongClassHash, storageRoot, proof)
+		require.NoError(t, err)
+		assert.False(t, verified)
+	})
+
+	t.Run("wrong state root", func(t *testing.T) {
+		verified, err := core.VerifyNonceProof(su0.OldRoot, classesRoot, addr, nonce, classHash, storageRoot, proof)
+		require.NoError(t, err)
+		assert.False(t, verified)
+	})
+
+	t.Run("contract not deployed", func(t *testing.T) {
+		_, _, _, _, err := state.NonceProof(utils.HexToFelt(t, "0xDEADBEEF"))
+		require.ErrorIs(t, err, core.ErrContractNotDeployed)
+	})
+}
+
+func TestSlotChurn(t *testing.T) {
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+
+	contractAddr := utils.HexToFelt(t, "0x20cfa74ee3564b4cd5435cdace0f9c4d43b939620e4a0bb5076105df0a626c6")
+	changedLoc := utils.HexToFelt(t, "0x5")
+	su := &core.StateUpdate{
+		NewRoot: utils.HexToFelt(t, "0xac747e0ea7497dad7407ecf2baf24b1598b0b40943207fc9af8ded09a64f1c"),
+		OldRoot: su0.NewRoot,
+		StateDiff: &core.StateDiff{
+			StorageDiffs: map[felt.Felt][]core.StorageDiff{
+				*contractAddr: {{Key: changedLoc, Value: utils.HexToFelt(t, "0x44")}},
+			},
+		},
+	}
+	require.NoError(t, state.Update(1, su, nil))
+
+	wantFull := make(map[felt.Felt]uint64)
+	for _, diff := range su0.StateDiff.StorageDiffs[*contractAddr] {
+		// setting an unset slot to zero changes nothing
+		if !diff.Value.IsZero() {
+			wantFull[*diff.Key]++
+		}
+	}
+	wantFull[*changedLoc]++
+	require.Equal(t, uint64(2), wantFull[*changedLoc])
+
+	wantGenesis := make(map[felt.Felt]uint64)
+	for key, count := range wantFull {
+		wantGenesis[key] = count
+	}
+	wantGenesis[*changedLoc]--
+
+	tests := map[string]struct {
+		from, to uint64
+		want     map[felt.Felt]uint64
+	}{
+		"full history":     {from: 0, to: 10, want: wantFull},
+		"single block":     {from: 1, to: 1, want: map[felt.Felt]uint64{*changedLoc: 1}},
+		"not set in range": {from: 2, to: 10, want: map[felt.Felt]uint64{}},
+		"genesis only":     {from: 0, to: 0, want: wantGenesis},
+	}
+	for desc, test := range tests {
+		test := test
+		t.Run(desc, func(t *testing.T) {
+			churn, err := state.SlotChurn(contractAddr, test.from, test.to)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, churn)
+		})
+	}
+
+	t.Run("invalid range", func(t *testing.T) {
+		_, err := state.SlotChurn(contractAddr, 2, 1)
+		require.Error(t, err)
+	})
+
+	t.Run("pruned history", func(t *testing.T) {
+		require.NoError(t, state.PruneHistory(1))
+
+		_, err := state.SlotChurn(contractAddr, 0, 1)
+		require.ErrorIs(t, err, core.ErrHistoryIncomplete)
+
+		churn, err := state.SlotChurn(contractAddr, 1, 1)
+		require.NoError(t, err)
+		assert.Equal(t, map[felt.Felt]uint64{*changedLoc: 1}, churn)
+	})
+}
+
+func TestClassLeafVersion(t *testing.T) {
+	defaultVersion := new(felt.Felt).SetBytes([]byte("CONTRACT_CLASS_LEAF_V0"))
+	otherVersion := new(felt.Felt).SetBytes([]byte("CONTRACT_CLASS_LEAF_V1"))
+	diff := &core.StateDiff{
+		DeclaredV1Classes: []core.DeclaredV1Class{{
+			ClassHash:         utils.HexToFelt(t, "0xDEADBEEF"),
+			CompiledClassHash: utils.HexToFelt(t, "0xBEEFDEAD"),
+		}},
+	}
+
+	newTxn := func(t *testing.T) db.Transaction {
+		txn := pebble.NewMemTest().NewTransaction(true)
+		t.Cleanup(func() {
+			require.NoError(t, txn.Discard())
+		})
+		return txn
+	}
+
+	txn := newTxn(t)
+	state := core.NewState(txn)
+	assert.Equal(t, defaultVersion, state.ClassLeafVersion())
+	require.NoError(t, state.VerifyClassLeafVersion())
+	require.NoError(t, core.NewState(txn, core.WithClassLeafVersion(otherVersion)).VerifyClassLeafVersion())
+	require.NoError(t, state.InitClassLeafVersion())
+
+	_, err := state.ApplyDiffWithCommitments(0, diff, nil, nil)
+	require.NoError(t, err)
+	_, classesRoot, _, err := state.Roots()
+	require.NoError(t, err)
+
+	t.Run("configured version", func(t *testing.T) {
+		other := core.NewState(newTxn(t), core.WithClassLeafVersion(otherVersion))
+		assert.Equal(t, otherVersion, other.ClassLeafVersion())
+		require.NoError(t, other.InitClassLeafVersion())
+
+		_, err := other.ApplyDiffWithCommitments(0, diff, nil, nil)
+		require.NoError(t, err)
+		_, otherClassesRoot, _, err := other.Roots()
+		require.NoError(t, err)
+		assert.NotEqual(t, classesRoot, otherClassesRoot)
+		require.NoError(t, other.VerifyClassLeafVersion())
+	})
+
+	t.Run("state built with another version", func(t *testing.T) {
+		other := core.NewState(txn, core.WithClassLeafVersion(otherVersion))
+		require.ErrorIs(t, other.VerifyClassLeafVersion(), core.ErrClassLeafVersionMismatch)
+		require.ErrorIs(t, other.InitClassLeafVersion(), core.ErrClassLeafVersionMismatch)
+	})
+
+	t.Run("version is stored once", func(t *testing.T) {
+		otherTxn := newTxn(t)
+		other := core.NewState(otherTxn, core.WithClassLeafVersion(otherVersion))
+		require.NoError(t, other.InitClassLeafVersion())
+		require.NoError(t, other.InitClassLeafVersion())
+		require.ErrorIs(t, core.NewState(otherTxn).InitClassLeafVersion(), core.ErrClassLeafVersionMismatch)
+	})
+
+	t.Run("state built before the version was stored", func(t *testing.T) {
+		require.NoError(t, txn.Delete(db.ClassLeafVersion.Key()))
+		require.NoError(t, state.VerifyClassLeafVersion())
+
+		other := core.NewState(txn, core.WithClassLeafVersion(otherVersion))
+		require.ErrorIs(t, other.VerifyClassLeafVersion(), core.ErrClassLeafVersionMismatch)
+	})
+}
+
+func TestDiffHashAt(t *testing.T) {
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+	state := core.NewState(txn)
+
+	_, err := state.DiffHashAt(0)
+	require.ErrorIs(t, err, db.ErrKeyNotFound)
+
+	var updates []*core.StateUpdate
+	for i := uint64(0); i < 2; i++ {
+		su, err := gw.StateUpdate(context.Background(), i)
+		require.NoError(t, err)
+		require.NoError(t, state.Update(i, su, nil))
+		updates = append(updates, su)
+	}
+
+	hashes := make([]*felt.Felt, len(updates))
+	for i, su := range updates {
+		hashes[i], err = state.DiffHashAt(uint64(i))
+		require.NoError(t, err)
+		assert.Equal(t, core.StateDiffHash(su.StateDiff), hashes[i], "block %d", i)
+	}
+	assert.NotEqual(t, hashes[0], hashes[1])
+
+	t.Run("order of the diff doesn't matter", func(t *testing.T) {
+		diff := *updates[0].StateDiff
+		deployed := append([]core.DeployedContract{}, diff.DeployedContracts...)
+		sort.Slice(deployed, func(i, j int) bool {
+			return deployed[i].Address.Cmp(deployed[j].Address) > 0
+		})
+		diff.DeployedContracts = deployed
+		assert.Equal(t, hashes[0], core.StateDiffHash(&diff))
+
+		diff.DeployedContracts = deployed[1:]
+		assert.NotEqual(t, hashes[0], core.StateDiffHash(&diff))
+	})
+
+	t.Run("revert removes the hash", func(t *testing.T) {
+		require.NoError(t, state.Revert(1, updates[1]))
+
+		_, err := state.DiffHashAt(1)
+		require.ErrorIs(t, err, db.ErrKeyNotFound)
+
+		hash, err := state.DiffHashAt(0)
+		require.NoError(t, err)
+		assert.Equal(t, hashes[0], hash)
+	})
+}
+
+func TestStorageChangesAt(t *testing.T) {
+	txn := pebble.NewMemTest().NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	client, closeFn := feeder.NewTestClient(utils.MAINNET)
+	t.Cleanup(closeFn)
+
+	gw := adaptfeeder.New(client)
+
+	state := core.NewState(txn)
+	su0, err := gw.StateUpdate(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, state.Update(0, su0, nil))
+
+	contractAddr := utils.HexToFelt(t, "0x20cfa74ee3564b4cd5435cdace0f9c4d43b939620e4a0bb5076105df0a626c6")
+	changedLoc := utils.HexToFelt(t, "0x5")
+	su := &core.StateUpdate{
+		NewRoot: utils.HexToFelt(t, "0xac747e0ea7497dad7407ecf2baf24b1598b0b40943207fc9af8ded09a64f1c"),
+		OldRoot: su0.NewRoot,
+		StateDiff: &core.StateDiff{
+			StorageDiffs: map[felt.Felt][]core.StorageDiff{
+				*contractAddr: {{Key: changedLoc, Value: utils.HexToFelt(t, "0x44")}},
+			},
+		},
+	}
+	require.NoError(t, state.Update(1, su, nil))
+
+	type change struct {
+		addr, key, value *felt.Felt
+	}
+	collect := func(blockNumber uint64) []change {
+		var changes []change
+		require.NoError(t, state.StorageChangesAt(blockNumber, func(addr, key, newValue *felt.Felt) error {
+			changes = append(changes, change{addr: addr, key: key, value: newValue})
+			return nil
+		}))
+		return changes
+	}
+
+	t.Run("values set by the block", func(t *testing.T) {
+		var want []change
+		for addr, diffs := range su0.StateDiff.StorageDiffs {
+			addr := addr
+			for _, diff := range diffs {
+				// setting an unset slot to zero changes nothing
+				if !diff.Value.IsZero() {
+					want = append(want, change{addr: &addr, key: diff.Key, value: diff.Value})
+				}
+			}
+		}
+		sort.Slice(want, func(i, j int) bool {
+			if cmp := want[i].addr.Cmp(want[j].addr); cmp != 0 {
+				return cmp < 0
+			}
+			return want[i].key.Cmp(want[j].key) < 0
+		})
+		assert.Equal(t, want, collect(0))
+	})
+
+	t.Run("later block", func(t *testing.T) {
+		assert.Equal(t, []change{{addr: contractAddr, key: changedLoc, value: utils.HexToFelt(t, "0x44")}}, collect(1))
+		assert.Empty(t, collect(2))
+	})
+
+	t.Run("stops at the first error", func(t *testing.T) {
+		stop := errors.New("stop")
+		calls := 0
+		err := state.StorageChangesAt(0, func(_, _, _ *felt.Felt) error {
+			calls++
+			return stop
+		})
+		require.ErrorIs(t, err, stop)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("reverted block", func(t *testing.T) {
+		require.NoError(t, state.Revert(1, su))
+		assert.Empty(t, collect(1))
+	})
+}
@@ -0,0 +1,184 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sort"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+)
+
+// StateUpdateForBlock reassembles the state update of the block with the given number from the
+// history logs, the deployment heights and the declared classes, with the roots computed by
+// [State.RootAt]. The values in the diff are the ones the block set, read like a [NewStateSnapshot]
+// at the block would. BlockHash is not set.
+//
+// Writes that didn't change anything, e.g. setting an unset storage location to zero, leave no log
+// and are missing from the diff. All the nonce and class hash logs are scanned, so this is expensive
+// on a large state.
+func (s *State) StateUpdateForBlock(blockNumber uint64) (*StateUpdate, error) {
+	update := new(StateUpdate)
+
+	var err error
+	if update.NewRoot, err = s.RootAt(blockNumber); err != nil {
+		return nil, err
+	}
+	if blockNumber == 0 {
+		update.OldRoot = new(felt.Felt)
+	} else if update.OldRoot, err = s.RootAt(blockNumber - 1); err != nil {
+		return nil, err
+	}
+
+	if update.StateDiff, err = s.stateDiffAt(blockNumber); err != nil {
+		return nil, err
+	}
+	return update, nil
+}
+
+// stateDiffAt reassembles the state diff of the block with the given number
+func (s *State) stateDiffAt(blockNumber uint64) (*StateDiff, error) {
+	snapshot := NewStateSnapshot(s, blockNumber)
+	diff := &StateDiff{
+		StorageDiffs: make(map[felt.Felt][]StorageDiff),
+		Nonces:       make(map[felt.Felt]*felt.Felt),
+	}
+
+	var deployedAddrs []*felt.Felt
+	if err := s.scanDeployments(context.Background(), func(height uint64) bool {
+		return height == blockNumber
+	}, func(addr []byte) {
+		deployedAddrs = append(deployedAddrs, new(felt.Felt).SetBytes(addr))
+	}); err != nil {
+		return nil, err
+	}
+
+	deployed := make(map[felt.Felt]struct{})
+	for _, addr := range deployedAddrs {
+		classHash, err := snapshot.ContractClassHash(addr)
+		if err != nil {
+			return nil, err
+		}
+		deployed[*addr] = struct{}{}
+		diff.DeployedContracts = append(diff.DeployedContracts, DeployedContract{Address: addr, ClassHash: classHash})
+	}
+
+	if err := s.StorageChangesAt(blockNumber, func(addr, key, value *felt.Felt) error {
+		diff.StorageDiffs[*addr] = append(diff.StorageDiffs[*addr], StorageDiff{Key: key, Value: value})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := s.scanLogsAt(db.ContractNonceHistory.Key(), blockNumber, func(subKey []byte) error {
+		addr := new(felt.Felt).SetBytes(subKey)
+		nonce, err := snapshot.ContractNonce(addr)
+		if err != nil {
+			return err
+		}
+		diff.Nonces[*addr] = nonce
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := s.scanLogsAt(db.ContractClassHashHistory.Key(), blockNumber, func(subKey []byte) error {
+		addr := new(felt.Felt).SetBytes(subKey)
+		if _, found := deployed[*addr]; found {
+			return nil
+		}
+
+		classHash, err := snapshot.ContractClassHash(addr)
+		if err != nil {
+			return err
+		}
+		diff.ReplacedClasses = append(diff.ReplacedClasses, ReplacedClass{Address: addr, ClassHash: classHash})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := s.declaredClassesAt(blockNumber, diff); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(diff.DeployedContracts, func(i, j int) bool {
+		return diff.DeployedContracts[i].Address.Cmp(diff.DeployedContracts[j].Address) < 0
+	})
+	sort.Slice(diff.ReplacedClasses, func(i, j int) bool {
+		return diff.ReplacedClasses[i].Address.Cmp(diff.ReplacedClasses[j].Address) < 0
+	})
+	return diff, nil
+}
+
+// StorageChangesAt calls fn with every storage location that the block with the given number
+// changed, across all contracts, and the value the block set it to, ordered by contract address and
+// then by location. Iteration stops at the first error returned by fn, which is then returned.
+//
+// The changes are found in the index of the storage history logs by block number, so writes that
+// didn't change anything are missing.
+func (s *State) StorageChangesAt(blockNumber uint64, fn func(addr, key, newValue *felt.Felt) error) error {
+	it, err := s.txn.NewIterator()
+	if err != nil {
+		return err
+	}
+
+	snapshot := NewStateSnapshot(s, blockNumber)
+	prefix := db.StorageChangesByBlockNumber.Key(MarshalBlockNumber(blockNumber))
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+
+		addr := new(felt.Felt).SetBytes(key[len(prefix) : len(prefix)+felt.Bytes])
+		location := new(felt.Felt).SetBytes(key[len(prefix)+felt.Bytes:])
+		value, valueErr := snapshot.ContractStorage(addr, location)
+		if valueErr != nil {
+			return db.CloseAndWrapOnError(it.Close, valueErr)
+		}
+		if err = fn(addr, location, value); err != nil {
+			return db.CloseAndWrapOnError(it.Close, err)
+		}
+	}
+	return it.Close()
+}
+
+// scanLogsAt calls fn with the sub key of every log under prefix at the given height, in key order
+func (s *State) scanLogsAt(prefix []byte, height uint64, fn func(subKey []byte) error) error {
+	it, err := s.txn.NewIterator()
+	if err != nil {
+		return err
+	}
+
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key()
+		if len(key) < len(prefix)+8 || !bytes.HasPrefix(key, prefix) {
+			break
+		}
+
+		if binary.BigEndian.Uint64(key[len(key)-8:]) == height {
+			if err = fn(bytes.Clone(key[len(prefix) : len(key)-8])); err != nil {
+				return db.CloseAndWrapOnError(it.Close, err)
+			}
+		}
+	}
+	return it.Close()
+}
+
+// declaredClassesAt adds the classes declared at the given height to diff, ordered by class hash
+func (s *State) declaredClassesAt(height uint64, diff *StateDiff) error {
+	prefix := db.ClassesByDeclarationHeight.Key(MarshalBlockNumber(height))
+	return s.scanClassDeclarations(prefix, func(classHash, compiledClassHash *felt.Felt, _ uint64) error {
+		if compiledClassHash == nil {
+			diff.DeclaredV0Classes = append(diff.DeclaredV0Classes, classHash)
+		} else {
+			diff.DeclaredV1Classes = append(diff.DeclaredV1Classes, DeclaredV1Class{
+				ClassHash:         classHash,
+				CompiledClassHash: compiledClassHash,
+			})
+		}
+		return nil
+	})
+}
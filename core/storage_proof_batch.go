@@ -0,0 +1,144 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/core/trie"
+	"github.com/NethermindEth/juno/db"
+)
+
+// ErrNoStateTrieRoot is returned by [VerifyStorageProofsBatch] when no claim binds the root of the
+// global state trie to the state commitment, so none of them can be checked.
+var ErrNoStateTrieRoot = errors.New("no contract proof binds to the state root")
+
+// StorageClaim claims that a storage location of a contract holds a value, together with the proofs
+// that bind it to the state commitment: the path of the contract in the global state trie, the fields
+// that make up the contract commitment, the path of the location in the contract storage trie and the
+// root of the classes trie that makes up the state commitment together with the global state trie.
+type StorageClaim struct {
+	ContractAddress *felt.Felt
+	Key             *felt.Felt
+	Value           *felt.Felt
+
+	ClassesRoot   *felt.Felt
+	ClassHash     *felt.Felt
+	Nonce         *felt.Felt
+	StorageRoot   *felt.Felt
+	ContractProof []trie.ProofNode
+	StorageProof  []trie.ProofNode
+}
+
+// StorageClaim returns the claim of the current value of a storage location of the contract at the
+// given address, see [VerifyStorageProofsBatch].
+func (s *State) StorageClaim(addr, key *felt.Felt) (*StorageClaim, error) {
+	contract, err := NewContract(addr, s.txn)
+	if err != nil {
+		return nil, err
+	}
+
+	claim := &StorageClaim{ContractAddress: addr, Key: key}
+	if claim.Value, err = contract.Storage(key); err != nil {
+		return nil, err
+	}
+	if claim.ClassHash, err = contract.ClassHash(); err != nil {
+		return nil, err
+	}
+	if claim.Nonce, err = contract.Nonce(); err != nil {
+		return nil, err
+	}
+	if claim.StorageRoot, err = contract.Root(); err != nil {
+		return nil, err
+	}
+	if claim.StorageProof, err = contract.StorageProof(key); err != nil {
+		return nil, err
+	}
+
+	stateTrie, storageCloser, err := s.storage()
+	if err != nil {
+		return nil, err
+	}
+	claim.ContractProof, err = stateTrie.Prove(addr)
+	if err = db.CloseAndWrapOnError(storageCloser, err); err != nil {
+		return nil, err
+	}
+
+	classesTrie, classesCloser, err := s.classesTrie()
+	if err != nil {
+		return nil, err
+	}
+	claim.ClassesRoot, err = classesTrie.Root()
+	if err = db.CloseAndWrapOnError(classesCloser, err); err != nil {
+		return nil, err
+	}
+	return claim, nil
+}
+
+// contractLeaf identifies a contract proof that was checked against the global state trie
+type contractLeaf struct {
+	address    felt.Felt
+	commitment felt.Felt
+}
+
+// VerifyStorageProofsBatch checks every claim against the state commitment and reports which ones
+// hold. The root of the global state trie is taken from the first contract proof that makes up the
+// state commitment together with the classes root of its claim, and [ErrNoStateTrieRoot] is returned
+// if there is none. The contract proof is verified once per contract and contract commitment, so
+// claims about the same contract only verify their storage proofs.
+//
+// Claims with malformed proofs are reported as invalid and their errors are returned together.
+func VerifyStorageProofsBatch(stateRoot *felt.Felt, claims []StorageClaim) ([]bool, error) {
+	valid := make([]bool, len(claims))
+
+	// a tampered proof must not make the others fail, so use the first root that matches
+	var storageRoot *felt.Felt
+	for i := range claims {
+		if len(claims[i].ContractProof) == 0 || claims[i].ClassesRoot == nil {
+			continue
+		}
+
+		candidate := claims[i].ContractProof[0].Hash(crypto.Pedersen)
+		if StateCommitment(candidate, claims[i].ClassesRoot).Equal(stateRoot) {
+			storageRoot = candidate
+			break
+		}
+	}
+	if storageRoot == nil {
+		return valid, ErrNoStateTrieRoot
+	}
+
+	var errs []error
+	verifiedContracts := make(map[contractLeaf]bool)
+	for i := range claims {
+		claim := &claims[i]
+		if claim.ClassesRoot == nil || !StateCommitment(storageRoot, claim.ClassesRoot).Equal(stateRoot) {
+			continue
+		}
+
+		commitment := calculateContractCommitment(claim.StorageRoot, claim.ClassHash, claim.Nonce)
+
+		leaf := contractLeaf{address: *claim.ContractAddress, commitment: *commitment}
+		contractValid, found := verifiedContracts[leaf]
+		if !found {
+			var err error
+			contractValid, err = trie.VerifyProofPedersen(storageRoot, claim.ContractAddress, globalTrieHeight,
+				commitment, claim.ContractProof)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("claim %d: contract proof: %w", i, err))
+			}
+			verifiedContracts[leaf] = contractValid
+		}
+		if !contractValid {
+			continue
+		}
+
+		storageValid, err := VerifyContractStorage(claim.StorageRoot, claim.Key, claim.Value, claim.StorageProof)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("claim %d: storage proof: %w", i, err))
+		}
+		valid[i] = storageValid
+	}
+	return valid, errors.Join(errs...)
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+)
+
+// ContractStorageRootAt returns the storage root of the contract at the given address right after
+// the block with the given number was applied. Historical storage roots are not stored, so the
+// storage trie of the contract is rebuilt as of that block: every location changed since is set back
+// to its value at the block, taken from the contract's storage history logs, on an in-memory overlay
+// that is discarded afterwards.
+//
+// The cost grows with the number of storage logs of the contract and of locations changed after the
+// block, so it is expensive for busy contracts and old blocks. [ErrContractNotDeployed] is returned if
+// the contract was not deployed at the block, and [ErrHistoryIncomplete] if the logs don't go back
+// far enough.
+func (s *State) ContractStorageRootAt(addr *felt.Felt, blockNumber uint64) (*felt.Felt, error) {
+	deployed, err := s.ContractIsAlreadyDeployedAt(addr, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if !deployed {
+		return nil, ErrContractNotDeployed
+	}
+
+	if err = s.checkHistorySince(blockNumber + 1); err != nil {
+		return nil, err
+	}
+
+	overlayTxn := db.NewOverlayTransaction(s.txn)
+	root, err := s.withTxn(overlayTxn).rollBackStorage(addr, blockNumber)
+	return root, db.CloseAndWrapOnError(overlayTxn.Discard, err)
+}
+
+// rollBackStorage undoes the storage changes made to the contract after the given block and returns
+// the resulting storage root
+func (s *State) rollBackStorage(addr *felt.Felt, blockNumber uint64) (*felt.Felt, error) {
+	var diff []StorageDiff
+	if err := s.earliestLogsAfter(db.ContractStorageHistory.Key(addr.Marshal()), blockNumber,
+		func(location, oldValue []byte) {
+			diff = append(diff, StorageDiff{
+				Key:   new(felt.Felt).SetBytes(location),
+				Value: new(felt.Felt).SetBytes(oldValue),
+			})
+		}); err != nil {
+		return nil, err
+	}
+
+	contract, err := NewContract(addr, s.txn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = contract.UpdateStorage(diff, func(*felt.Felt, *felt.Felt) error {
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return contract.Root()
+}
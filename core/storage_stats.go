@@ -0,0 +1,84 @@
+package core
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+)
+
+// ContractStorageUsage is the number of storage slots that a contract occupies.
+type ContractStorageUsage struct {
+	Address *felt.Felt
+	Slots   uint64
+}
+
+// ContractStorageSize returns the number of non-zero storage slots of the contract at the given
+// address. The whole storage trie of the contract is walked.
+func (s *State) ContractStorageSize(addr *felt.Felt) (uint64, error) {
+	contract, err := NewContract(addr, s.txn)
+	if err != nil {
+		return 0, err
+	}
+
+	cStorage, err := storage(contract.Address, s.txn)
+	if err != nil {
+		return 0, err
+	}
+	return cStorage.NumLeaves()
+}
+
+// ForEachContract calls fn with the address of every deployed contract, in ascending order, and
+// stops at the first error. fn may read the state but must not modify it.
+func (s *State) ForEachContract(fn func(addr *felt.Felt) error) error {
+	it, err := s.txn.NewIterator()
+	if err != nil {
+		return err
+	}
+
+	prefix := db.ContractClassHash.Key()
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+
+		if err = fn(new(felt.Felt).SetBytes(key[len(prefix):])); err != nil {
+			return db.CloseAndWrapOnError(it.Close, err)
+		}
+	}
+	return it.Close()
+}
+
+// TopContractsByStorage returns the n contracts that occupy the most storage slots, sorted by the
+// number of slots in descending order, with ties broken by address. The storage trie of every
+// contract is walked, so this is expensive on large states.
+func (s *State) TopContractsByStorage(n int) ([]ContractStorageUsage, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	var usages []ContractStorageUsage
+	if err := s.ForEachContract(func(addr *felt.Felt) error {
+		slots, err := s.ContractStorageSize(addr)
+		if err != nil {
+			return err
+		}
+		usages = append(usages, ContractStorageUsage{Address: addr, Slots: slots})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Slots != usages[j].Slots {
+			return usages[i].Slots > usages[j].Slots
+		}
+		return usages[i].Address.Cmp(usages[j].Address) < 0
+	})
+	if len(usages) > n {
+		usages = usages[:n]
+	}
+	return usages, nil
+}
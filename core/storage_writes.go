@@ -0,0 +1,37 @@
+package core
+
+import (
+	"encoding/binary"
+
+	"github.com/NethermindEth/juno/db"
+)
+
+// StorageWriteCount returns the number of storage writes in the diff of the update, i.e. the number
+// of storage diffs summed over all contracts.
+func (s *State) StorageWriteCount(update *StateUpdate) int {
+	count := 0
+	for _, storageDiffs := range update.StateDiff.StorageDiffs {
+		count += len(storageDiffs)
+	}
+	return count
+}
+
+// StorageWritesAtBlock returns the number of storage writes of the block with the given number, as
+// counted by [State.StorageWriteCount] when the block was applied. [db.ErrKeyNotFound] is returned for
+// blocks that are not applied. The counts of blocks applied before they were kept are filled in by a
+// migration.
+func (s *State) StorageWritesAtBlock(blockNumber uint64) (uint64, error) {
+	var count uint64
+	err := s.txn.Get(db.StorageWritesByBlockNumber.Key(MarshalBlockNumber(blockNumber)), func(val []byte) error {
+		count = binary.BigEndian.Uint64(val)
+		return nil
+	})
+	return count, err
+}
+
+// putStorageWriteCount stores the number of storage writes of the diff applied at blockNumber
+func (s *State) putStorageWriteCount(blockNumber uint64, diff *StateDiff) error {
+	count := uint64(s.StorageWriteCount(&StateUpdate{StateDiff: diff}))
+	key := db.StorageWritesByBlockNumber.Key(MarshalBlockNumber(blockNumber))
+	return s.txn.Set(key, binary.BigEndian.AppendUint64(nil, count))
+}
@@ -0,0 +1,128 @@
+package trie
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/bits-and-blooms/bitset"
+)
+
+// Diff returns the keys whose values differ between the two tries, sorted. Keys that only exist in
+// one of the tries are included. The tries are walked in lockstep and subtrees that are identical in
+// both are skipped, so the cost is proportional to the size of the difference rather than of the tries.
+//
+// Both tries must be committed.
+func Diff(a, b *Trie) ([]*felt.Felt, error) {
+	if a.height != b.height {
+		return nil, fmt.Errorf("cannot diff tries of heights %d and %d", a.height, b.height)
+	}
+
+	d := &trieDiff{a: a, b: b}
+	if err := d.diff(a.rootKey, b.rootKey); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(d.keys, func(i, j int) bool {
+		return d.keys[i].Cmp(d.keys[j]) < 0
+	})
+	return d.keys, nil
+}
+
+type trieDiff struct {
+	a, b *Trie
+	keys []*felt.Felt
+}
+
+// diff compares the subtree at aKey in a with the subtree at bKey in b
+func (d *trieDiff) diff(aKey, bKey *bitset.BitSet) error {
+	switch {
+	case aKey == nil && bKey == nil:
+		return nil
+	case aKey == nil:
+		return d.collect(d.b, bKey)
+	case bKey == nil:
+		return d.collect(d.a, aKey)
+	}
+
+	aNode, err := d.a.storage.Get(aKey)
+	if err != nil {
+		return err
+	}
+
+	bNode, err := d.b.storage.Get(bKey)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case aKey.Equal(bKey):
+		// a node's value commits to its whole subtree
+		if aNode.Value.Equal(bNode.Value) {
+			return nil
+		}
+
+		if aKey.Len() == d.a.height {
+			d.keys = append(d.keys, bitSetToFelt(aKey))
+			return nil
+		}
+
+		if err = d.diff(aNode.Left, bNode.Left); err != nil {
+			return err
+		}
+		return d.diff(aNode.Right, bNode.Right)
+	case aKey.Len() < bKey.Len() && isSubset(bKey, aKey):
+		// the subtree at bKey lies under one of the children of aKey
+		if bKey.Test(bKey.Len() - aKey.Len() - 1) {
+			if err = d.collect(d.a, aNode.Left); err != nil {
+				return err
+			}
+			return d.diff(aNode.Right, bKey)
+		}
+
+		if err = d.collect(d.a, aNode.Right); err != nil {
+			return err
+		}
+		return d.diff(aNode.Left, bKey)
+	case bKey.Len() < aKey.Len() && isSubset(aKey, bKey):
+		if aKey.Test(aKey.Len() - bKey.Len() - 1) {
+			if err = d.collect(d.b, bNode.Left); err != nil {
+				return err
+			}
+			return d.diff(aKey, bNode.Right)
+		}
+
+		if err = d.collect(d.b, bNode.Right); err != nil {
+			return err
+		}
+		return d.diff(aKey, bNode.Left)
+	default:
+		// the subtrees don't share any keys
+		if err = d.collect(d.a, aKey); err != nil {
+			return err
+		}
+		return d.collect(d.b, bKey)
+	}
+}
+
+// collect adds the keys of all the leaves under key in t
+func (d *trieDiff) collect(t *Trie, key *bitset.BitSet) error {
+	if key == nil {
+		return nil
+	}
+
+	if key.Len() == t.height {
+		d.keys = append(d.keys, bitSetToFelt(key))
+		return nil
+	}
+
+	node, err := t.storage.Get(key)
+	if err != nil {
+		return err
+	}
+
+	if err = d.collect(t, node.Left); err != nil {
+		return err
+	}
+	return d.collect(t, node.Right)
+}
@@ -0,0 +1,84 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/core/trie"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	put := func(t *testing.T, tempTrie *trie.Trie, values map[uint64]uint64) {
+		for k, v := range values {
+			_, err := tempTrie.Put(new(felt.Felt).SetUint64(k), new(felt.Felt).SetUint64(v))
+			require.NoError(t, err)
+		}
+		require.NoError(t, tempTrie.Commit())
+	}
+
+	keys := func(ks ...uint64) []*felt.Felt {
+		var fs []*felt.Felt
+		for _, k := range ks {
+			fs = append(fs, new(felt.Felt).SetUint64(k))
+		}
+		return fs
+	}
+
+	tests := map[string]struct {
+		a, b     map[uint64]uint64
+		expected []*felt.Felt
+	}{
+		"empty tries": {},
+		"identical tries": {
+			a: map[uint64]uint64{1: 1, 5: 5, 1 << 40: 9},
+			b: map[uint64]uint64{1: 1, 5: 5, 1 << 40: 9},
+		},
+		"one empty trie": {
+			a:        map[uint64]uint64{1: 1, 5: 5},
+			expected: keys(1, 5),
+		},
+		"changed, added and removed keys": {
+			a:        map[uint64]uint64{1: 1, 2: 2, 5: 5, 100: 100, 1 << 40: 9},
+			b:        map[uint64]uint64{1: 1, 2: 3, 6: 6, 100: 100, 1 << 40: 9, 1 << 41: 10},
+			expected: keys(2, 5, 6, 1<<41),
+		},
+		"disjoint subtrees": {
+			a:        map[uint64]uint64{0b1000: 1, 0b1001: 2},
+			b:        map[uint64]uint64{0b0100: 1, 0b0101: 2},
+			expected: keys(0b0100, 0b0101, 0b1000, 0b1001),
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, trie.RunOnTempTrie(251, func(a *trie.Trie) error {
+				return trie.RunOnTempTrie(251, func(b *trie.Trie) error {
+					put(t, a, test.a)
+					put(t, b, test.b)
+
+					diff, err := trie.Diff(a, b)
+					require.NoError(t, err)
+					assert.Equal(t, test.expected, diff)
+
+					diff, err = trie.Diff(b, a)
+					require.NoError(t, err)
+					assert.Equal(t, test.expected, diff)
+					return nil
+				})
+			}))
+		})
+	}
+
+	t.Run("different heights", func(t *testing.T) {
+		require.NoError(t, trie.RunOnTempTrie(251, func(a *trie.Trie) error {
+			return trie.RunOnTempTrie(8, func(b *trie.Trie) error {
+				_, err := trie.Diff(a, b)
+				assert.Error(t, err)
+				return nil
+			})
+		}))
+	})
+}
@@ -20,18 +20,7 @@ func (n *Node) Hash(path *bitset.BitSet, hashFunc hashFunc) *felt.Felt {
 		return n.Value
 	}
 
-	pathWords := path.Bytes()
-	if len(pathWords) > felt.Limbs {
-		panic("key too long to fit in Felt")
-	}
-
-	var pathBytes [felt.Bytes]byte
-	for idx, word := range pathWords {
-		startBytes := 24 - (idx * 8)
-		binary.BigEndian.PutUint64(pathBytes[startBytes:startBytes+8], word)
-	}
-
-	pathFelt := new(felt.Felt).SetBytes(pathBytes[:])
+	pathFelt := bitSetToFelt(path)
 
 	// https://docs.starknet.io/documentation/develop/State/starknet-state/
 	hash := hashFunc(n.Value, pathFelt)
@@ -39,3 +28,18 @@ func (n *Node) Hash(path *bitset.BitSet, hashFunc hashFunc) *felt.Felt {
 	pathFelt.SetUint64(uint64(path.Len()))
 	return hash.Add(hash, pathFelt)
 }
+
+// bitSetToFelt converts the bits of a key or a path to a felt
+func bitSetToFelt(bs *bitset.BitSet) *felt.Felt {
+	words := bs.Bytes()
+	if len(words) > felt.Limbs {
+		panic("key too long to fit in Felt")
+	}
+
+	var feltBytes [felt.Bytes]byte
+	for idx, word := range words {
+		startBytes := 24 - (idx * 8)
+		binary.BigEndian.PutUint64(feltBytes[startBytes:startBytes+8], word)
+	}
+	return new(felt.Felt).SetBytes(feltBytes[:])
+}
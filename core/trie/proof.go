@@ -0,0 +1,205 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/bits-and-blooms/bitset"
+)
+
+var ErrIncompleteProof = errors.New("proof does not reach the bottom of the trie")
+
+// ProofNode is a node on the path from the root of a [Trie] to a key, as described in the
+// [specification]. Exactly one of Binary and Edge is set.
+//
+// [specification]: https://docs.starknet.io/documentation/develop/State/starknet-state/
+type ProofNode struct {
+	Binary *Binary
+	Edge   *Edge
+}
+
+// Binary is a node with two non-empty children, represented by their hashes.
+type Binary struct {
+	LeftHash  *felt.Felt
+	RightHash *felt.Felt
+}
+
+// Edge is a node with a single child, reached by following Path.
+type Edge struct {
+	Child *felt.Felt
+	Path  *bitset.BitSet
+}
+
+// Hash calculates the hash of a [ProofNode]
+func (pn *ProofNode) Hash(hash hashFunc) *felt.Felt {
+	if pn.Binary != nil {
+		return hash(pn.Binary.LeftHash, pn.Binary.RightHash)
+	}
+	return (&Node{Value: pn.Edge.Child}).Hash(pn.Edge.Path, hash)
+}
+
+// Prove returns the nodes on the path from the root of the [Trie] to the given key. If the key
+// does not exist, the path ends at the node where it diverges from the key, which proves the
+// non-inclusion of the key.
+func (t *Trie) Prove(key *felt.Felt) ([]ProofNode, error) {
+	if key.Cmp(t.maxKey) > 0 {
+		return nil, fmt.Errorf("key %s exceeds trie height %d", key, t.height)
+	}
+
+	// make sure the values of the nodes on the path are up-to-date
+	if err := t.Commit(); err != nil {
+		return nil, err
+	}
+
+	nodeKey := t.feltToBitSet(key)
+	nodes, err := t.nodesFromRoot(nodeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var proof []ProofNode
+	var parentKey *bitset.BitSet
+	for _, sNode := range nodes {
+		if edgePath := path(sNode.key, parentKey); edgePath.Len() > 0 {
+			proof = append(proof, ProofNode{
+				Edge: &Edge{
+					Child: sNode.node.Value,
+					Path:  edgePath,
+				},
+			})
+		}
+
+		// reached a leaf or a node that diverges from the key
+		if sNode.key.Len() == t.height || !isSubset(nodeKey, sNode.key) {
+			break
+		}
+
+		binary, err := t.binaryProofNode(sNode)
+		if err != nil {
+			return nil, err
+		}
+		proof = append(proof, ProofNode{Binary: binary})
+		parentKey = sNode.key
+	}
+
+	return proof, nil
+}
+
+// ProofLen returns the number of nodes that [Trie.Prove] would return for the given key, without
+// building the proof.
+func (t *Trie) ProofLen(key *felt.Felt) (int, error) {
+	if key.Cmp(t.maxKey) > 0 {
+		return 0, fmt.Errorf("key %s exceeds trie height %d", key, t.height)
+	}
+
+	nodeKey := t.feltToBitSet(key)
+	nodes, err := t.nodesFromRoot(nodeKey)
+	if err != nil {
+		return 0, err
+	}
+
+	proofLen := 0
+	var parentKey *bitset.BitSet
+	for _, sNode := range nodes {
+		if path(sNode.key, parentKey).Len() > 0 {
+			proofLen++
+		}
+
+		if sNode.key.Len() == t.height || !isSubset(nodeKey, sNode.key) {
+			break
+		}
+		proofLen++
+		parentKey = sNode.key
+	}
+	return proofLen, nil
+}
+
+func (t *Trie) binaryProofNode(sNode storageNode) (*Binary, error) {
+	left, err := t.storage.Get(sNode.node.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := t.storage.Get(sNode.node.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Binary{
+		LeftHash:  left.Hash(path(sNode.node.Left, sNode.key), t.hash),
+		RightHash: right.Hash(path(sNode.node.Right, sNode.key), t.hash),
+	}, nil
+}
+
+// VerifyProofPedersen checks the given proof against the root of a Pedersen [Trie] of height `height`.
+// See [verifyProof] for details.
+func VerifyProofPedersen(root, key *felt.Felt, height uint, value *felt.Felt, proof []ProofNode) (bool, error) {
+	return verifyProof(root, key, height, value, proof, crypto.Pedersen)
+}
+
+// VerifyProofPoseidon checks the given proof against the root of a Poseidon [Trie] of height `height`.
+// See [verifyProof] for details.
+func VerifyProofPoseidon(root, key *felt.Felt, height uint, value *felt.Felt, proof []ProofNode) (bool, error) {
+	return verifyProof(root, key, height, value, proof, crypto.Poseidon)
+}
+
+// verifyProof walks the proof from the root towards the key and checks that each node hashes
+// to the value expected by its parent. A proof that diverges from the key proves that the key
+// does not exist, which is only valid if `value` is zero.
+func verifyProof(root, key *felt.Felt, height uint, value *felt.Felt, proof []ProofNode, hash hashFunc) (bool, error) {
+	if height > felt.Bits {
+		return false, fmt.Errorf("max trie height is %d, got: %d", felt.Bits, height)
+	}
+
+	keyBits := key.Bits()
+	keyBitSet := bitset.FromWithLength(height, keyBits[:])
+
+	// empty trie
+	if len(proof) == 0 && root.IsZero() {
+		return value.IsZero(), nil
+	}
+
+	expected := root
+	depth := uint(0)
+	for idx := range proof {
+		node := &proof[idx]
+		if depth >= height {
+			return false, errors.New("proof is longer than the trie height")
+		}
+
+		if !node.Hash(hash).Equal(expected) {
+			return false, nil
+		}
+
+		if node.Binary != nil {
+			if keyBitSet.Test(height - depth - 1) {
+				expected = node.Binary.RightHash
+			} else {
+				expected = node.Binary.LeftHash
+			}
+			depth++
+			continue
+		}
+
+		edgePath := node.Edge.Path
+		if depth+edgePath.Len() > height {
+			return false, errors.New("edge path exceeds the trie height")
+		}
+
+		for i := uint(0); i < edgePath.Len(); i++ {
+			if edgePath.Test(i) != keyBitSet.Test(height-depth-edgePath.Len()+i) {
+				// path diverges from the key, so the key is not in the trie
+				return value.IsZero() && idx == len(proof)-1, nil
+			}
+		}
+		expected = node.Edge.Child
+		depth += edgePath.Len()
+	}
+
+	if depth != height {
+		return false, ErrIncompleteProof
+	}
+	return expected.Equal(value), nil
+}
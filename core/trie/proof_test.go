@@ -0,0 +1,117 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/core/trie"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProve(t *testing.T) {
+	t.Run("empty trie", func(t *testing.T) {
+		require.NoError(t, trie.RunOnTempTrie(251, func(tempTrie *trie.Trie) error {
+			key := new(felt.Felt).SetUint64(1)
+			proof, err := tempTrie.Prove(key)
+			require.NoError(t, err)
+			assert.Empty(t, proof)
+
+			valid, err := trie.VerifyProofPedersen(&felt.Zero, key, 251, &felt.Zero, proof)
+			require.NoError(t, err)
+			assert.True(t, valid)
+			return nil
+		}))
+	})
+
+	t.Run("single leaf", func(t *testing.T) {
+		require.NoError(t, trie.RunOnTempTrie(251, func(tempTrie *trie.Trie) error {
+			key := new(felt.Felt).SetUint64(1)
+			value := new(felt.Felt).SetUint64(11)
+			_, err := tempTrie.Put(key, value)
+			require.NoError(t, err)
+
+			root, err := tempTrie.Root()
+			require.NoError(t, err)
+
+			proof, err := tempTrie.Prove(key)
+			require.NoError(t, err)
+			require.Len(t, proof, 1)
+
+			valid, err := trie.VerifyProofPedersen(root, key, 251, value, proof)
+			require.NoError(t, err)
+			assert.True(t, valid)
+			return nil
+		}))
+	})
+
+	t.Run("multiple leaves", func(t *testing.T) {
+		require.NoError(t, trie.RunOnTempTrie(251, func(tempTrie *trie.Trie) error {
+			values := map[uint64]uint64{0: 5, 1: 6, 2: 7, 8: 8, 1024: 9}
+			for k, v := range values {
+				_, err := tempTrie.Put(new(felt.Felt).SetUint64(k), new(felt.Felt).SetUint64(v))
+				require.NoError(t, err)
+			}
+
+			root, err := tempTrie.Root()
+			require.NoError(t, err)
+
+			for k, v := range values {
+				key := new(felt.Felt).SetUint64(k)
+				proof, err := tempTrie.Prove(key)
+				require.NoError(t, err)
+
+				proofLen, err := tempTrie.ProofLen(key)
+				require.NoError(t, err)
+				assert.Equal(t, len(proof), proofLen)
+
+				valid, err := trie.VerifyProofPedersen(root, key, 251, new(felt.Felt).SetUint64(v), proof)
+				require.NoError(t, err)
+				assert.True(t, valid)
+
+				valid, err = trie.VerifyProofPedersen(root, key, 251, new(felt.Felt).SetUint64(v+1), proof)
+				require.NoError(t, err)
+				assert.False(t, valid)
+			}
+
+			for _, k := range []uint64{3, 9, 1023, 1 << 40} {
+				key := new(felt.Felt).SetUint64(k)
+				proof, err := tempTrie.Prove(key)
+				require.NoError(t, err)
+
+				proofLen, err := tempTrie.ProofLen(key)
+				require.NoError(t, err)
+				assert.Equal(t, len(proof), proofLen)
+
+				valid, err := trie.VerifyProofPedersen(root, key, 251, &felt.Zero, proof)
+				require.NoError(t, err)
+				assert.True(t, valid)
+
+				valid, err = trie.VerifyProofPedersen(root, key, 251, new(felt.Felt).SetUint64(5), proof)
+				require.NoError(t, err)
+				assert.False(t, valid)
+			}
+			return nil
+		}))
+	})
+
+	t.Run("truncated proof", func(t *testing.T) {
+		require.NoError(t, trie.RunOnTempTrie(251, func(tempTrie *trie.Trie) error {
+			for k := uint64(0); k < 4; k++ {
+				_, err := tempTrie.Put(new(felt.Felt).SetUint64(k), new(felt.Felt).SetUint64(k+1))
+				require.NoError(t, err)
+			}
+
+			root, err := tempTrie.Root()
+			require.NoError(t, err)
+
+			key := new(felt.Felt).SetUint64(2)
+			proof, err := tempTrie.Prove(key)
+			require.NoError(t, err)
+
+			_, err = trie.VerifyProofPedersen(root, key, 251, new(felt.Felt).SetUint64(3), proof[:len(proof)-1])
+			assert.ErrorIs(t, err, trie.ErrIncompleteProof)
+			return nil
+		}))
+	})
+}
@@ -396,6 +396,97 @@ func (t *Trie) Commit() error {
 	return err
 }
 
+// NumLeaves returns the number of leaves in the [Trie]. Zero values are not stored in the trie,
+// so this is the number of keys with a non-zero value. Every node of the trie is visited.
+func (t *Trie) NumLeaves() (uint64, error) {
+	return t.numLeaves(t.rootKey)
+}
+
+func (t *Trie) numLeaves(key *bitset.BitSet) (uint64, error) {
+	if key == nil {
+		return 0, nil
+	}
+	if key.Len() == t.height {
+		return 1, nil
+	}
+
+	node, err := t.storage.Get(key)
+	if err != nil {
+		return 0, err
+	}
+
+	left, err := t.numLeaves(node.Left)
+	if err != nil {
+		return 0, err
+	}
+	right, err := t.numLeaves(node.Right)
+	if err != nil {
+		return 0, err
+	}
+	return left + right, nil
+}
+
+// ForEachLeaf calls fn with the key and value of every leaf in the [Trie], in ascending key order,
+// and stops at the first error. The values of dirty leaves are the ones that were put.
+func (t *Trie) ForEachLeaf(fn func(key, value *felt.Felt) error) error {
+	return t.forEachLeaf(t.rootKey, fn)
+}
+
+func (t *Trie) forEachLeaf(key *bitset.BitSet, fn func(key, value *felt.Felt) error) error {
+	if key == nil {
+		return nil
+	}
+
+	node, err := t.storage.Get(key)
+	if err != nil {
+		return err
+	}
+
+	if key.Len() == t.height {
+		return fn(bitSetToFelt(key), node.Value)
+	}
+
+	if err = t.forEachLeaf(node.Left, fn); err != nil {
+		return err
+	}
+	return t.forEachLeaf(node.Right, fn)
+}
+
+// ForEachLeafProofLen calls fn with the key of every leaf in the [Trie] and the number of nodes that
+// [Trie.Prove] returns for it, in ascending key order, and stops at the first error. Every node of
+// the trie is visited once, unlike calling [Trie.ProofLen] for every key.
+func (t *Trie) ForEachLeafProofLen(fn func(key *felt.Felt, proofLen int) error) error {
+	return t.forEachLeafProofLen(t.rootKey, nil, 0, fn)
+}
+
+func (t *Trie) forEachLeafProofLen(key, parentKey *bitset.BitSet, proofLen int,
+	fn func(key *felt.Felt, proofLen int) error,
+) error {
+	if key == nil {
+		return nil
+	}
+
+	// an edge node leads to the node unless it is right below its parent
+	if path(key, parentKey).Len() > 0 {
+		proofLen++
+	}
+	if key.Len() == t.height {
+		return fn(bitSetToFelt(key), proofLen)
+	}
+
+	node, err := t.storage.Get(key)
+	if err != nil {
+		return err
+	}
+
+	// the binary node itself
+	proofLen++
+	if err = t.forEachLeafProofLen(node.Left, key, proofLen, fn); err != nil {
+		return err
+	}
+	return t.forEachLeafProofLen(node.Right, key, proofLen, fn)
+}
+
 // RootKey returns db key of the [Trie] root node
 func (t *Trie) RootKey() *bitset.BitSet {
 	return t.rootKey
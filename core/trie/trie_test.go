@@ -1,6 +1,7 @@
 package trie_test
 
 import (
+	"errors"
 	"strconv"
 	"testing"
 
@@ -318,3 +319,60 @@ func BenchmarkTriePut(b *testing.B) {
 		return t.Commit()
 	}))
 }
+
+func TestNumLeaves(t *testing.T) {
+	require.NoError(t, trie.RunOnTempTrie(251, func(tempTrie *trie.Trie) error {
+		numLeaves, err := tempTrie.NumLeaves()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), numLeaves)
+
+		for i := uint64(1); i <= 10; i++ {
+			_, err = tempTrie.Put(new(felt.Felt).SetUint64(i), new(felt.Felt).SetUint64(i))
+			require.NoError(t, err)
+		}
+		// overwriting a key doesn't add a leaf
+		_, err = tempTrie.Put(new(felt.Felt).SetUint64(1), new(felt.Felt).SetUint64(100))
+		require.NoError(t, err)
+
+		numLeaves, err = tempTrie.NumLeaves()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(10), numLeaves)
+
+		// zero values are removed from the trie
+		_, err = tempTrie.Put(new(felt.Felt).SetUint64(5), new(felt.Felt))
+		require.NoError(t, err)
+
+		numLeaves, err = tempTrie.NumLeaves()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(9), numLeaves)
+		return nil
+	}))
+}
+
+func TestForEachLeaf(t *testing.T) {
+	require.NoError(t, trie.RunOnTempTrie(251, func(tempTrie *trie.Trie) error {
+		expected := make(map[uint64]uint64)
+		for _, key := range []uint64{42, 7, 1 << 40, 8, 1} {
+			expected[key] = key + 100
+			_, err := tempTrie.Put(new(felt.Felt).SetUint64(key), new(felt.Felt).SetUint64(key+100))
+			require.NoError(t, err)
+		}
+
+		var keys []uint64
+		require.NoError(t, tempTrie.ForEachLeaf(func(key, value *felt.Felt) error {
+			assert.Equal(t, new(felt.Felt).SetUint64(expected[key.Uint64()]), value)
+			keys = append(keys, key.Uint64())
+			return nil
+		}))
+		assert.Equal(t, []uint64{1, 7, 8, 42, 1 << 40}, keys)
+
+		stopErr := errors.New("stop")
+		visited := 0
+		require.ErrorIs(t, tempTrie.ForEachLeaf(func(_, _ *felt.Felt) error {
+			visited++
+			return stopErr
+		}), stopErr)
+		assert.Equal(t, 1, visited)
+		return nil
+	}))
+}
@@ -0,0 +1,30 @@
+package core
+
+import (
+	"context"
+
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// TrieDepthHistogram returns the number of contracts in the global state trie by the depth of their
+// leaf, i.e. the number of nodes in their proof, see [trie.Trie.ProofLen]. Every node of the trie is
+// read, so this is expensive on a large state.
+func (s *State) TrieDepthHistogram(ctx context.Context) (map[int]uint64, error) {
+	stateTrie, _, err := s.storage()
+	if err != nil {
+		return nil, err
+	}
+
+	histogram := make(map[int]uint64)
+	err = stateTrie.ForEachLeafProofLen(func(_ *felt.Felt, depth int) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		histogram[depth]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return histogram, nil
+}
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/core/trie"
+	"github.com/NethermindEth/juno/db"
+)
+
+// DiffTries returns the addresses of the contracts whose commitments differ between the states in
+// aTxn and bTxn, sorted. aRoot and bRoot are the expected state commitments of the two states.
+// The global state tries are compared with [trie.Diff], which skips the subtrees they share.
+func DiffTries(aRoot, bRoot *felt.Felt, aTxn, bTxn db.Transaction) ([]felt.Felt, error) {
+	aTrie, err := stateTrieWithRoot(aRoot, aTxn)
+	if err != nil {
+		return nil, err
+	}
+
+	bTrie, err := stateTrieWithRoot(bRoot, bTxn)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := trie.Diff(aTrie, bTrie)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]felt.Felt, 0, len(keys))
+	for _, key := range keys {
+		addrs = append(addrs, *key)
+	}
+	return addrs, nil
+}
+
+// stateTrieWithRoot returns the global state trie in txn after checking that the state commitment is root
+func stateTrieWithRoot(root *felt.Felt, txn db.Transaction) (*trie.Trie, error) {
+	state := NewState(txn)
+	stateRoot, err := state.Root()
+	if err != nil {
+		return nil, err
+	}
+
+	if !stateRoot.Equal(root) {
+		return nil, fmt.Errorf("state commitment mismatch: expected %s, got %s", root, stateRoot)
+	}
+
+	stateTrie, _, err := state.storage()
+	return stateTrie, err
+}
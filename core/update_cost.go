@@ -0,0 +1,32 @@
+package core
+
+// UpdateCost is the size of the changes that a state update makes. All counts but TriePuts are exact.
+type UpdateCost struct {
+	DeployedContracts int
+	DeclaredClasses   int
+	NonceUpdates      int
+	StorageWrites     int
+	ReplacedClasses   int
+	// TriePuts estimates the number of trie Put operations applying the update takes: one per storage
+	// write in the contract storage tries, one per touched contract in the global state trie and one
+	// per declared Cairo 1 class in the classes trie.
+	TriePuts int
+}
+
+// EstimateUpdateCost returns the cost of applying the update, from its diff alone, e.g. to order and
+// batch updates. Storage writes of the same location count once per diff entry, even if repeated.
+func EstimateUpdateCost(update *StateUpdate) UpdateCost {
+	diff := update.StateDiff
+	cost := UpdateCost{
+		DeployedContracts: len(diff.DeployedContracts),
+		DeclaredClasses:   len(diff.DeclaredV0Classes) + len(diff.DeclaredV1Classes),
+		NonceUpdates:      len(diff.Nonces),
+		ReplacedClasses:   len(diff.ReplacedClasses),
+	}
+	for _, storageDiffs := range diff.StorageDiffs {
+		cost.StorageWrites += len(storageDiffs)
+	}
+
+	cost.TriePuts = cost.StorageWrites + len(touchedContracts(diff)) + len(diff.DeclaredV1Classes)
+	return cost
+}
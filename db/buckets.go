@@ -29,6 +29,13 @@ const (
 	L1Height
 	SchemaVersion
 	Pending
+	ContractAddressesByClassHash // maps class hashes and contract addresses to nothing, the reverse of ContractClassHash
+	StorageWritesByBlockNumber   // maps block numbers to the number of storage writes in their state diffs
+	ClassLeafVersion             // the version of the classes trie leaves that the state was built with
+	StateDiffHashesByBlockNumber // maps block numbers to the hashes of their state diffs
+	ClassesByDeclarationHeight   // maps block numbers and the classes declared at them to compiled class hashes, empty for Cairo 0
+	StorageChangesByBlockNumber  // maps block numbers, contract addresses and storage locations to nothing, indexes the storage logs
+	HistoryLowWaterMark          // the oldest block whose history logs are kept, absent if the history goes back to genesis
 )
 
 // Key flattens a prefix and series of byte arrays into a single []byte.
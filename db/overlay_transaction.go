@@ -0,0 +1,216 @@
+package db
+
+import (
+	"bytes"
+	"sort"
+)
+
+var _ Transaction = (*overlayTransaction)(nil)
+
+type overlayEntry struct {
+	value   []byte
+	deleted bool
+}
+
+// overlayTransaction buffers all writes in memory on top of a parent [Transaction].
+// Reads are served from the buffer first and fall through to the parent.
+// The parent is never modified unless Commit is called.
+type overlayTransaction struct {
+	parent  Transaction
+	entries map[string]overlayEntry
+}
+
+// NewOverlayTransaction returns a [Transaction] that reads through to parent and keeps
+// all changes in memory. Commit writes the buffered changes to parent without committing
+// parent itself, Discard drops them.
+func NewOverlayTransaction(parent Transaction) Transaction {
+	return &overlayTransaction{
+		parent:  parent,
+		entries: make(map[string]overlayEntry),
+	}
+}
+
+// NewIterator : see db.Transaction.NewIterator
+func (t *overlayTransaction) NewIterator() (Iterator, error) {
+	parentIt, err := t.parent.NewIterator()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(t.entries))
+	entries := make(map[string]overlayEntry, len(t.entries))
+	for key, entry := range t.entries {
+		keys = append(keys, key)
+		entries[key] = entry
+	}
+	sort.Strings(keys)
+
+	return &overlayIterator{
+		parent:  parentIt,
+		keys:    keys,
+		entries: entries,
+	}, nil
+}
+
+// Discard : see db.Transaction.Discard
+func (t *overlayTransaction) Discard() error {
+	t.entries = make(map[string]overlayEntry)
+	return nil
+}
+
+// Commit : see db.Transaction.Commit
+func (t *overlayTransaction) Commit() error {
+	for key, entry := range t.entries {
+		var err error
+		if entry.deleted {
+			err = t.parent.Delete([]byte(key))
+		} else {
+			err = t.parent.Set([]byte(key), entry.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return t.Discard()
+}
+
+// Set : see db.Transaction.Set
+func (t *overlayTransaction) Set(key, val []byte) error {
+	t.entries[string(key)] = overlayEntry{value: append([]byte{}, val...)}
+	return nil
+}
+
+// Delete : see db.Transaction.Delete
+func (t *overlayTransaction) Delete(key []byte) error {
+	t.entries[string(key)] = overlayEntry{deleted: true}
+	return nil
+}
+
+// Get : see db.Transaction.Get
+func (t *overlayTransaction) Get(key []byte, cb func([]byte) error) error {
+	if entry, found := t.entries[string(key)]; found {
+		if entry.deleted {
+			return ErrKeyNotFound
+		}
+		return cb(entry.value)
+	}
+	return t.parent.Get(key, cb)
+}
+
+// Impl : see db.Transaction.Impl
+func (t *overlayTransaction) Impl() any {
+	return t.parent.Impl()
+}
+
+var _ Iterator = (*overlayIterator)(nil)
+
+// overlayIterator merges the buffered entries of an [overlayTransaction] with an iterator
+// over its parent. Buffered entries shadow the parent's keys and deleted entries are skipped.
+type overlayIterator struct {
+	parent     Iterator
+	keys       []string
+	entries    map[string]overlayEntry
+	idx        int
+	positioned bool
+
+	fromOverlay bool
+	valid       bool
+}
+
+// Valid : see db.Iterator.Valid
+func (i *overlayIterator) Valid() bool {
+	return i.valid
+}
+
+// Key : see db.Iterator.Key
+func (i *overlayIterator) Key() []byte {
+	if !i.valid {
+		return nil
+	}
+	if i.fromOverlay {
+		return []byte(i.keys[i.idx])
+	}
+	return i.parent.Key()
+}
+
+// Value : see db.Iterator.Value
+func (i *overlayIterator) Value() ([]byte, error) {
+	if !i.valid {
+		return nil, nil
+	}
+	if i.fromOverlay {
+		return append([]byte{}, i.entries[i.keys[i.idx]].value...), nil
+	}
+	return i.parent.Value()
+}
+
+// Next : see db.Iterator.Next
+func (i *overlayIterator) Next() bool {
+	if !i.positioned {
+		i.positioned = true
+		i.parent.Next()
+		i.idx = 0
+		return i.settle()
+	}
+
+	if !i.valid {
+		return false
+	}
+
+	if i.fromOverlay {
+		i.idx++
+	} else {
+		i.parent.Next()
+	}
+	return i.settle()
+}
+
+// Seek : see db.Iterator.Seek
+func (i *overlayIterator) Seek(key []byte) bool {
+	i.positioned = true
+	i.parent.Seek(key)
+	i.idx = sort.SearchStrings(i.keys, string(key))
+	return i.settle()
+}
+
+// Close : see db.Iterator.Close
+func (i *overlayIterator) Close() error {
+	return i.parent.Close()
+}
+
+// settle positions the iterator on the smallest key among the buffered entries and the
+// parent iterator, skipping parent keys that are shadowed by the buffer and deleted entries.
+func (i *overlayIterator) settle() bool {
+	for {
+		parentValid := i.parent.Valid()
+		overlayValid := i.idx < len(i.keys)
+
+		if !overlayValid {
+			i.fromOverlay = false
+			i.valid = parentValid
+			return i.valid
+		}
+
+		overlayKey := []byte(i.keys[i.idx])
+		if parentValid {
+			cmp := bytes.Compare(overlayKey, i.parent.Key())
+			if cmp > 0 {
+				i.fromOverlay = false
+				i.valid = true
+				return true
+			} else if cmp == 0 {
+				// buffered entry shadows the parent's value
+				i.parent.Next()
+			}
+		}
+
+		if i.entries[i.keys[i.idx]].deleted {
+			i.idx++
+			continue
+		}
+
+		i.fromOverlay = true
+		i.valid = true
+		return true
+	}
+}
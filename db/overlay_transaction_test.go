@@ -0,0 +1,96 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/NethermindEth/juno/db"
+	"github.com/NethermindEth/juno/db/pebble"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverlayTransaction(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	require.NoError(t, txn.Set([]byte{1}, []byte{1}))
+	require.NoError(t, txn.Set([]byte{2}, []byte{2}))
+	require.NoError(t, txn.Set([]byte{3}, []byte{3}))
+
+	overlay := db.NewOverlayTransaction(txn)
+	require.NoError(t, overlay.Set([]byte{2}, []byte{22}))
+	require.NoError(t, overlay.Delete([]byte{3}))
+	require.NoError(t, overlay.Set([]byte{4}, []byte{4}))
+
+	get := func(txn db.Transaction, key []byte) ([]byte, error) {
+		var val []byte
+		err := txn.Get(key, func(b []byte) error {
+			val = append([]byte{}, b...)
+			return nil
+		})
+		return val, err
+	}
+
+	t.Run("reads are served from overlay first", func(t *testing.T) {
+		val, err := get(overlay, []byte{1})
+		require.NoError(t, err)
+		assert.Equal(t, []byte{1}, val)
+
+		val, err = get(overlay, []byte{2})
+		require.NoError(t, err)
+		assert.Equal(t, []byte{22}, val)
+
+		_, err = get(overlay, []byte{3})
+		assert.ErrorIs(t, err, db.ErrKeyNotFound)
+	})
+
+	t.Run("parent is untouched", func(t *testing.T) {
+		val, err := get(txn, []byte{2})
+		require.NoError(t, err)
+		assert.Equal(t, []byte{2}, val)
+
+		_, err = get(txn, []byte{4})
+		assert.ErrorIs(t, err, db.ErrKeyNotFound)
+	})
+
+	t.Run("iterator merges overlay and parent", func(t *testing.T) {
+		it, err := overlay.NewIterator()
+		require.NoError(t, err)
+
+		var keys, values [][]byte
+		for it.Next() {
+			keys = append(keys, it.Key())
+			val, err := it.Value()
+			require.NoError(t, err)
+			values = append(values, val)
+		}
+		require.NoError(t, it.Close())
+
+		assert.Equal(t, [][]byte{{1}, {2}, {4}}, keys)
+		assert.Equal(t, [][]byte{{1}, {22}, {4}}, values)
+
+		it, err = overlay.NewIterator()
+		require.NoError(t, err)
+		require.True(t, it.Seek([]byte{3}))
+		assert.Equal(t, []byte{4}, it.Key())
+		require.NoError(t, it.Close())
+	})
+
+	t.Run("commit writes changes to parent", func(t *testing.T) {
+		require.NoError(t, overlay.Commit())
+
+		val, err := get(txn, []byte{2})
+		require.NoError(t, err)
+		assert.Equal(t, []byte{22}, val)
+
+		_, err = get(txn, []byte{3})
+		assert.ErrorIs(t, err, db.ErrKeyNotFound)
+
+		val, err = get(txn, []byte{4})
+		require.NoError(t, err)
+		assert.Equal(t, []byte{4}, val)
+	})
+}
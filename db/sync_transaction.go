@@ -0,0 +1,120 @@
+package db
+
+import "sync"
+
+var _ Transaction = (*syncTransaction)(nil)
+
+// syncTransaction serialises all access to a [Transaction] so that it can be shared between goroutines.
+type syncTransaction struct {
+	mu  sync.Mutex
+	txn Transaction
+}
+
+// NewSyncTransaction returns a [Transaction] that can be used concurrently. Every call, including calls
+// on the iterators it creates, is forwarded to txn while holding a lock. The callback passed to Get is
+// called with the lock held, so it must not use the transaction.
+func NewSyncTransaction(txn Transaction) Transaction {
+	return &syncTransaction{txn: txn}
+}
+
+// NewIterator : see db.Transaction.NewIterator
+func (t *syncTransaction) NewIterator() (Iterator, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	it, err := t.txn.NewIterator()
+	if err != nil {
+		return nil, err
+	}
+	return &syncIterator{mu: &t.mu, it: it}, nil
+}
+
+// Discard : see db.Transaction.Discard
+func (t *syncTransaction) Discard() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.txn.Discard()
+}
+
+// Commit : see db.Transaction.Commit
+func (t *syncTransaction) Commit() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.txn.Commit()
+}
+
+// Set : see db.Transaction.Set
+func (t *syncTransaction) Set(key, val []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.txn.Set(key, val)
+}
+
+// Delete : see db.Transaction.Delete
+func (t *syncTransaction) Delete(key []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.txn.Delete(key)
+}
+
+// Get : see db.Transaction.Get
+func (t *syncTransaction) Get(key []byte, cb func([]byte) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.txn.Get(key, cb)
+}
+
+// Impl : see db.Transaction.Impl
+func (t *syncTransaction) Impl() any {
+	return t.txn.Impl()
+}
+
+var _ Iterator = (*syncIterator)(nil)
+
+// syncIterator guards an [Iterator] with the lock of the [syncTransaction] that created it.
+type syncIterator struct {
+	mu *sync.Mutex
+	it Iterator
+}
+
+// Valid : see db.Iterator.Valid
+func (i *syncIterator) Valid() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.it.Valid()
+}
+
+// Next : see db.Iterator.Next
+func (i *syncIterator) Next() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.it.Next()
+}
+
+// Key : see db.Iterator.Key
+func (i *syncIterator) Key() []byte {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.it.Key()
+}
+
+// Value : see db.Iterator.Value
+func (i *syncIterator) Value() ([]byte, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.it.Value()
+}
+
+// Seek : see db.Iterator.Seek
+func (i *syncIterator) Seek(key []byte) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.it.Seek(key)
+}
+
+// Close : see db.Iterator.Close
+func (i *syncIterator) Close() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.it.Close()
+}
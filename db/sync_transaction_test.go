@@ -0,0 +1,50 @@
+package db_test
+
+import (
+	"encoding/binary"
+	"sync"
+	"testing"
+
+	"github.com/NethermindEth/juno/db"
+	"github.com/NethermindEth/juno/db/pebble"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncTransaction(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	txn := db.NewSyncTransaction(testDB.NewTransaction(true))
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	const workers, keysPerWorker = 8, 100
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		w := w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < keysPerWorker; i++ {
+				key := binary.BigEndian.AppendUint64(nil, uint64(w*keysPerWorker+i))
+				assert.NoError(t, txn.Set(key, key))
+				assert.NoError(t, txn.Get(key, func(val []byte) error {
+					assert.Equal(t, key, val)
+					return nil
+				}))
+			}
+		}()
+	}
+	wg.Wait()
+
+	it, err := txn.NewIterator()
+	require.NoError(t, err)
+
+	count := 0
+	for it.Next(); it.Valid(); it.Next() {
+		count++
+	}
+	require.NoError(t, it.Close())
+	assert.Equal(t, workers*keysPerWorker, count)
+}
@@ -4,8 +4,12 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
 	"github.com/NethermindEth/juno/db"
+	"github.com/NethermindEth/juno/encoder"
 )
 
 type revision func(transaction db.Transaction) error
@@ -15,6 +19,11 @@ type revision func(transaction db.Transaction) error
 var revisions = []revision{
 	revision0000,
 	relocateContractStorageRootKeys,
+	indexContractsByClassHash,
+	indexClassesByDeclarationHeight,
+	indexStorageChangesByBlockNumber,
+	countStorageWritesByBlockNumber,
+	hashStateDiffsByBlockNumber,
 }
 
 func MigrateIfNeeded(targetDB db.DB) error {
@@ -142,3 +151,251 @@ func relocateContractStorageRootKeys(txn db.Transaction) error {
 
 	return nil
 }
+
+// indexContractsByClassHash builds the reverse index of contract class hashes for existing contracts.
+//
+// Before: contracts could only be looked up by address at 2+<contractAddress>.
+// After: every contract is also recorded at 21+<classHash>+<contractAddress>.
+//
+// This enables listing the contracts that instantiate a class without scanning all contracts.
+func indexContractsByClassHash(txn db.Transaction) error {
+	it, err := txn.NewIterator()
+	if err != nil {
+		return err
+	}
+
+	// As in relocateContractStorageRootKeys, collect the entries before modifying the db.
+	var indexKeys [][]byte
+	prefix := db.ContractClassHash.Key()
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		if !bytes.HasPrefix(it.Key(), prefix) {
+			break
+		}
+
+		classHash, itErr := it.Value()
+		if itErr != nil {
+			return db.CloseAndWrapOnError(it.Close, itErr)
+		}
+
+		contractAddress := it.Key()[len(prefix):]
+		indexKeys = append(indexKeys, db.ContractAddressesByClassHash.Key(classHash, contractAddress))
+	}
+
+	if err = it.Close(); err != nil {
+		return err
+	}
+
+	for _, key := range indexKeys {
+		if err = txn.Set(key, []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexClassesByDeclarationHeight records the declaration of every stored class, together with the
+// compiled class hash of Cairo 1 classes.
+//
+// Before: declarations could only be found by decoding every class at 4+<classHash>, and compiled
+// class hashes were only kept in the state updates at 12+<blockNumber>.
+// After: every class is also recorded at 25+<declarationHeight>+<classHash>, with the compiled class
+// hash of Cairo 1 classes as the value.
+//
+// This enables listing the classes declared at a block without decoding all the classes.
+func indexClassesByDeclarationHeight(txn db.Transaction) error {
+	it, err := txn.NewIterator()
+	if err != nil {
+		return err
+	}
+
+	// As in relocateContractStorageRootKeys, collect the entries before modifying the db.
+	type declaration struct {
+		classHash *felt.Felt
+		at        uint64
+	}
+	var declarations []declaration
+	prefix := db.Class.Key()
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		if !bytes.HasPrefix(it.Key(), prefix) {
+			break
+		}
+
+		val, itErr := it.Value()
+		if itErr != nil {
+			return db.CloseAndWrapOnError(it.Close, itErr)
+		}
+
+		// the class types are not registered to the encoder yet, so only the height is decoded
+		var declaredClass struct {
+			At uint64
+		}
+		if err = encoder.Unmarshal(val, &declaredClass); err != nil {
+			return db.CloseAndWrapOnError(it.Close, err)
+		}
+
+		declarations = append(declarations, declaration{
+			classHash: new(felt.Felt).SetBytes(it.Key()[len(prefix):]),
+			at:        declaredClass.At,
+		})
+	}
+
+	if err = it.Close(); err != nil {
+		return err
+	}
+
+	stateUpdates := make(map[uint64]*core.StateUpdate)
+	for _, d := range declarations {
+		compiledClassHash, cErr := compiledClassHash(txn, d.classHash, d.at, stateUpdates)
+		if cErr != nil {
+			return cErr
+		}
+
+		// Cairo 0 classes have no compiled class hash
+		var value []byte
+		if compiledClassHash != nil {
+			value = compiledClassHash.Marshal()
+		}
+
+		key := db.ClassesByDeclarationHeight.Key(core.MarshalBlockNumber(d.at), d.classHash.Marshal())
+		if err = txn.Set(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compiledClassHash finds the compiled class hash of a class in the state update of the block that
+// declared it, or returns nil if the class is not declared as a Cairo 1 class there. Fetched state
+// updates are cached in stateUpdates.
+func compiledClassHash(txn db.Transaction, classHash *felt.Felt, declaredAt uint64,
+	stateUpdates map[uint64]*core.StateUpdate,
+) (*felt.Felt, error) {
+	update, found := stateUpdates[declaredAt]
+	if !found {
+		if err := txn.Get(db.StateUpdatesByBlockNumber.Key(core.MarshalBlockNumber(declaredAt)), func(val []byte) error {
+			update = new(core.StateUpdate)
+			return encoder.Unmarshal(val, update)
+		}); err != nil {
+			return nil, fmt.Errorf("get state update of block %d: %w", declaredAt, err)
+		}
+		stateUpdates[declaredAt] = update
+	}
+
+	for _, declaredClass := range update.StateDiff.DeclaredV1Classes {
+		if declaredClass.ClassHash.Equal(classHash) {
+			return declaredClass.CompiledClassHash, nil
+		}
+	}
+	return nil, nil
+}
+
+// indexStorageChangesByBlockNumber builds the index of the storage history logs by block number.
+//
+// Before: the storage changes of a block could only be found by scanning every storage log at
+// 14+<contractAddress>+<storageLocation>+<blockNumber>.
+// After: every storage log is also recorded at 26+<blockNumber>+<contractAddress>+<storageLocation>.
+func indexStorageChangesByBlockNumber(txn db.Transaction) error {
+	it, err := txn.NewIterator()
+	if err != nil {
+		return err
+	}
+
+	// As in relocateContractStorageRootKeys, collect the entries before modifying the db.
+	var indexKeys [][]byte
+	prefix := db.ContractStorageHistory.Key()
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+
+		// the log key is the contract address, the storage location and the block number
+		subKey := key[len(prefix) : len(key)-8]
+		indexKeys = append(indexKeys, db.StorageChangesByBlockNumber.Key(key[len(key)-8:], subKey))
+	}
+
+	if err = it.Close(); err != nil {
+		return err
+	}
+
+	for _, key := range indexKeys {
+		if err = txn.Set(key, []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countStorageWritesByBlockNumber stores the number of storage writes of every block that was applied
+// before the counts were kept.
+//
+// Before: the number of storage writes of a block was only kept for the blocks applied since
+// [core.State.StorageWritesAtBlock] was added.
+// After: the number of storage writes of every stored state update at 12+<blockNumber> is recorded at
+// 22+<blockNumber>.
+func countStorageWritesByBlockNumber(txn db.Transaction) error {
+	return forEachStateUpdate(txn, func(blockNumber []byte, update *core.StateUpdate) error {
+		count := uint64(core.NewState(txn).StorageWriteCount(update))
+		return txn.Set(db.StorageWritesByBlockNumber.Key(blockNumber), binary.BigEndian.AppendUint64(nil, count))
+	})
+}
+
+// hashStateDiffsByBlockNumber stores the hash of the state diff of every block that was applied before
+// the hashes were kept.
+//
+// Before: the hash of the state diff of a block was only kept for the blocks applied since
+// [core.State.DiffHashAt] was added.
+// After: the [core.StateDiffHash] of every stored state update at 12+<blockNumber> is recorded at
+// 24+<blockNumber>.
+func hashStateDiffsByBlockNumber(txn db.Transaction) error {
+	return forEachStateUpdate(txn, func(blockNumber []byte, update *core.StateUpdate) error {
+		return txn.Set(db.StateDiffHashesByBlockNumber.Key(blockNumber), core.StateDiffHash(update.StateDiff).Marshal())
+	})
+}
+
+// forEachStateUpdate calls fn with every stored state update and the marshalled number of its block.
+func forEachStateUpdate(txn db.Transaction, fn func(blockNumber []byte, update *core.StateUpdate) error) error {
+	it, err := txn.NewIterator()
+	if err != nil {
+		return err
+	}
+
+	// As in relocateContractStorageRootKeys, collect the entries before modifying the db.
+	type entry struct {
+		blockNumber []byte
+		update      *core.StateUpdate
+	}
+	var entries []entry
+	prefix := db.StateUpdatesByBlockNumber.Key()
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+
+		val, itErr := it.Value()
+		if itErr != nil {
+			return db.CloseAndWrapOnError(it.Close, itErr)
+		}
+
+		update := new(core.StateUpdate)
+		if err = encoder.Unmarshal(val, update); err != nil {
+			return db.CloseAndWrapOnError(it.Close, err)
+		}
+		entries = append(entries, entry{
+			blockNumber: bytes.Clone(key[len(prefix):]),
+			update:      update,
+		})
+	}
+
+	if err = it.Close(); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err = fn(e.blockNumber, e.update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
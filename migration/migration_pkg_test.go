@@ -3,9 +3,11 @@ package migration
 import (
 	"testing"
 
+	"github.com/NethermindEth/juno/core"
 	"github.com/NethermindEth/juno/core/felt"
 	"github.com/NethermindEth/juno/db"
 	"github.com/NethermindEth/juno/db/pebble"
+	"github.com/NethermindEth/juno/encoder"
 	"github.com/stretchr/testify/require"
 )
 
@@ -64,3 +66,182 @@ func TestRelocateContractStorageRootKeys(t *testing.T) {
 		require.ErrorIs(t, db.ErrKeyNotFound, err)
 	}
 }
+
+func TestIndexContractsByClassHash(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	t.Cleanup(func() {
+		require.NoError(t, testDB.Close())
+	})
+
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	numberOfContracts := 5
+	classHash := new(felt.Felt).SetUint64(42).Bytes()
+	for i := 0; i < numberOfContracts; i++ {
+		addrBytes := new(felt.Felt).SetUint64(uint64(i)).Bytes()
+		require.NoError(t, txn.Set(db.ContractClassHash.Key(addrBytes[:]), classHash[:]))
+	}
+
+	require.NoError(t, indexContractsByClassHash(txn))
+
+	for i := 0; i < numberOfContracts; i++ {
+		addrBytes := new(felt.Felt).SetUint64(uint64(i)).Bytes()
+		require.NoError(t, txn.Get(db.ContractAddressesByClassHash.Key(classHash[:], addrBytes[:]), func(val []byte) error {
+			return nil
+		}))
+	}
+}
+
+func TestIndexClassesByDeclarationHeight(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	t.Cleanup(func() {
+		require.NoError(t, testDB.Close())
+	})
+
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	cairo0Hash := new(felt.Felt).SetUint64(1)
+	cairo1Hash := new(felt.Felt).SetUint64(2)
+	compiledClassHash := new(felt.Felt).SetUint64(3)
+	for classHash, declaredClass := range map[*felt.Felt]core.DeclaredClass{
+		cairo0Hash: {At: 5, Class: &core.Cairo0Class{}},
+		cairo1Hash: {At: 7, Class: &core.Cairo1Class{}},
+	} {
+		classBytes, err := encoder.Marshal(declaredClass)
+		require.NoError(t, err)
+		require.NoError(t, txn.Set(db.Class.Key(classHash.Marshal()), classBytes))
+	}
+
+	for blockNumber, stateUpdate := range map[uint64]*core.StateUpdate{
+		5: {StateDiff: &core.StateDiff{DeclaredV0Classes: []*felt.Felt{cairo0Hash}}},
+		7: {StateDiff: &core.StateDiff{
+			DeclaredV1Classes: []core.DeclaredV1Class{{ClassHash: cairo1Hash, CompiledClassHash: compiledClassHash}},
+		}},
+	} {
+		suBytes, err := encoder.Marshal(stateUpdate)
+		require.NoError(t, err)
+		require.NoError(t, txn.Set(db.StateUpdatesByBlockNumber.Key(core.MarshalBlockNumber(blockNumber)), suBytes))
+	}
+
+	require.NoError(t, indexClassesByDeclarationHeight(txn))
+
+	require.NoError(t, txn.Get(db.ClassesByDeclarationHeight.Key(core.MarshalBlockNumber(5), cairo0Hash.Marshal()),
+		func(val []byte) error {
+			require.Empty(t, val)
+			return nil
+		}))
+	require.NoError(t, txn.Get(db.ClassesByDeclarationHeight.Key(core.MarshalBlockNumber(7), cairo1Hash.Marshal()),
+		func(val []byte) error {
+			require.Equal(t, compiledClassHash.Marshal(), val)
+			return nil
+		}))
+}
+
+func TestIndexStorageChangesByBlockNumber(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	t.Cleanup(func() {
+		require.NoError(t, testDB.Close())
+	})
+
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	addr := new(felt.Felt).SetUint64(1)
+	locations := []*felt.Felt{new(felt.Felt).SetUint64(2), new(felt.Felt).SetUint64(3)}
+	heights := []uint64{4, 5}
+	for i, location := range locations {
+		logKey := db.ContractStorageHistory.Key(addr.Marshal(), location.Marshal(), core.MarshalBlockNumber(heights[i]))
+		require.NoError(t, txn.Set(logKey, new(felt.Felt).Marshal()))
+	}
+
+	require.NoError(t, indexStorageChangesByBlockNumber(txn))
+
+	for i, location := range locations {
+		require.NoError(t, txn.Get(db.StorageChangesByBlockNumber.Key(core.MarshalBlockNumber(heights[i]), addr.Marshal(),
+			location.Marshal()), func(val []byte) error {
+			require.Empty(t, val)
+			return nil
+		}))
+	}
+	err := txn.Get(db.StorageChangesByBlockNumber.Key(core.MarshalBlockNumber(heights[1]), addr.Marshal(),
+		locations[0].Marshal()), func([]byte) error {
+		return nil
+	})
+	require.ErrorIs(t, err, db.ErrKeyNotFound)
+}
+
+func TestCountStorageWritesByBlockNumber(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	t.Cleanup(func() {
+		require.NoError(t, testDB.Close())
+	})
+
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	addr := new(felt.Felt).SetUint64(1)
+	value := new(felt.Felt).SetUint64(2)
+	stateUpdates := map[uint64]*core.StateUpdate{
+		0: {StateDiff: &core.StateDiff{}},
+		1: {StateDiff: &core.StateDiff{StorageDiffs: map[felt.Felt][]core.StorageDiff{
+			*addr: {{Key: new(felt.Felt).SetUint64(3), Value: value}, {Key: new(felt.Felt).SetUint64(4), Value: value}},
+		}}},
+	}
+	for blockNumber, stateUpdate := range stateUpdates {
+		suBytes, err := encoder.Marshal(stateUpdate)
+		require.NoError(t, err)
+		require.NoError(t, txn.Set(db.StateUpdatesByBlockNumber.Key(core.MarshalBlockNumber(blockNumber)), suBytes))
+	}
+
+	require.NoError(t, countStorageWritesByBlockNumber(txn))
+
+	state := core.NewState(txn)
+	for blockNumber, want := range map[uint64]uint64{0: 0, 1: 2} {
+		count, err := state.StorageWritesAtBlock(blockNumber)
+		require.NoError(t, err)
+		require.Equal(t, want, count)
+	}
+}
+
+func TestHashStateDiffsByBlockNumber(t *testing.T) {
+	testDB := pebble.NewMemTest()
+	t.Cleanup(func() {
+		require.NoError(t, testDB.Close())
+	})
+
+	txn := testDB.NewTransaction(true)
+	t.Cleanup(func() {
+		require.NoError(t, txn.Discard())
+	})
+
+	stateUpdates := map[uint64]*core.StateUpdate{
+		0: {StateDiff: &core.StateDiff{DeclaredV0Classes: []*felt.Felt{new(felt.Felt).SetUint64(1)}}},
+		1: {StateDiff: &core.StateDiff{Nonces: map[felt.Felt]*felt.Felt{
+			*new(felt.Felt).SetUint64(2): new(felt.Felt).SetUint64(3),
+		}}},
+	}
+	for blockNumber, stateUpdate := range stateUpdates {
+		suBytes, err := encoder.Marshal(stateUpdate)
+		require.NoError(t, err)
+		require.NoError(t, txn.Set(db.StateUpdatesByBlockNumber.Key(core.MarshalBlockNumber(blockNumber)), suBytes))
+	}
+
+	require.NoError(t, hashStateDiffsByBlockNumber(txn))
+
+	state := core.NewState(txn)
+	for blockNumber, stateUpdate := range stateUpdates {
+		hash, err := state.DiffHashAt(blockNumber)
+		require.NoError(t, err)
+		require.Equal(t, core.StateDiffHash(stateUpdate.StateDiff), hash)
+	}
+}
@@ -211,6 +211,10 @@ func (n *Node) Run(ctx context.Context) {
 	}
 
 	n.blockchain = blockchain.New(n.db, n.cfg.Network, n.log)
+	if err = n.blockchain.VerifyClassLeafVersion(); err != nil {
+		n.log.Errorw("Error while opening the DB", "err", err)
+		return
+	}
 
 	client := feeder.NewClient(n.cfg.Network.FeederURL())
 	synchronizer := sync.New(n.blockchain, adaptfeeder.New(client), n.log, n.cfg.PendingPollInterval)
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/NethermindEth/juno/blockchain"
+	"github.com/NethermindEth/juno/clients/feeder"
 	"github.com/NethermindEth/juno/core"
 	"github.com/NethermindEth/juno/core/felt"
 	"github.com/NethermindEth/juno/db"
@@ -18,6 +19,9 @@ import (
 
 var _ service.Service = (*Synchronizer)(nil)
 
+// headPollInterval is how long a fetcher waits before asking again for a block past the head of the chain
+const headPollInterval = 5 * time.Second
+
 // Synchronizer manages a list of StarknetData to fetch the latest blockchain updates
 type Synchronizer struct {
 	Blockchain          *blockchain.Blockchain
@@ -28,6 +32,7 @@ type Synchronizer struct {
 	log utils.SimpleLogger
 
 	pendingPollInterval time.Duration
+	headPollInterval    time.Duration
 }
 
 func New(bc *blockchain.Blockchain, starkNetData starknetdata.StarknetData,
@@ -38,6 +43,7 @@ func New(bc *blockchain.Blockchain, starkNetData starknetdata.StarknetData,
 		StarknetData:        starkNetData,
 		log:                 log,
 		pendingPollInterval: pendingPollInterval,
+		headPollInterval:    headPollInterval,
 	}
 }
 
@@ -57,10 +63,12 @@ func (s *Synchronizer) fetcherTask(ctx context.Context, height uint64, verifiers
 		default:
 			block, err := s.StarknetData.BlockByNumber(ctx, height)
 			if err != nil {
+				s.waitIfAtHead(ctx, err)
 				continue
 			}
 			stateUpdate, err := s.StarknetData.StateUpdate(ctx, height)
 			if err != nil {
+				s.waitIfAtHead(ctx, err)
 				continue
 			}
 
@@ -78,6 +86,21 @@ func (s *Synchronizer) fetcherTask(ctx context.Context, height uint64, verifiers
 	}
 }
 
+// waitIfAtHead waits for the head poll interval if err reports that the block doesn't exist yet,
+// i.e. that the sync has reached the head of the chain
+func (s *Synchronizer) waitIfAtHead(ctx context.Context, err error) {
+	if !errors.Is(err, feeder.ErrBlockNotFound) {
+		return
+	}
+
+	timer := time.NewTimer(s.headPollInterval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
 func (s *Synchronizer) fetchUnknownClasses(ctx context.Context, stateUpdate *core.StateUpdate) (map[felt.Felt]core.Class, error) {
 	state, closer, err := s.Blockchain.HeadState()
 	if err != nil {
@@ -3,6 +3,7 @@ package sync
 import (
 	"context"
 	"errors"
+	"runtime"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -212,3 +213,29 @@ func TestPending(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, head.Hash, pending.Block.ParentHash)
 }
+
+func TestWaitAtHead(t *testing.T) {
+	t.Parallel()
+
+	mockCtrl := gomock.NewController(t)
+	t.Cleanup(mockCtrl.Finish)
+
+	var calls atomic.Int32
+	data := mocks.NewMockStarknetData(mockCtrl)
+	data.EXPECT().BlockByNumber(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(context.Context, uint64) (*core.Block, error) {
+			calls.Add(1)
+			return nil, feeder.ErrBlockNotFound
+		}).AnyTimes()
+
+	log := utils.NewNopZapLogger()
+	synchronizer := New(blockchain.New(pebble.NewMemTest(), utils.MAINNET, log), data, log, time.Duration(0))
+	synchronizer.headPollInterval = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	require.NoError(t, synchronizer.Run(ctx))
+	cancel()
+
+	// every fetcher asks once and then waits for the next poll
+	assert.LessOrEqual(t, calls.Load(), int32(runtime.NumCPU()))
+}